@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/maxfouquet/isotope/convert/pkg/diff"
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff [old YAML file] [new YAML file]",
+	Short: "Semantically compare two service graph YAML files",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, err := cmd.PersistentFlags().GetString("output")
+		exitIfError(err)
+
+		oldGraph, err := serviceGraphFromYAMLFile(args[0])
+		exitIfError(err)
+
+		newGraph, err := serviceGraphFromYAMLFile(args[1])
+		exitIfError(err)
+
+		d := diff.ServiceGraphs(oldGraph, newGraph)
+		switch output {
+		case "text":
+			fmt.Print(d)
+		case "json":
+			b, err := json.MarshalIndent(d, "", "  ")
+			exitIfError(err)
+			fmt.Println(string(b))
+		default:
+			exitIfError(fmt.Errorf("unknown output format: %s", output))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.PersistentFlags().StringP(
+		"output", "o", "text", "the output format: text or json")
+}
+
+// serviceGraphFromYAMLFile unmarshals the ServiceGraph from the YAML at path.
+func serviceGraphFromYAMLFile(
+	path string) (serviceGraph graph.ServiceGraph, err error) {
+	yamlContents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	err = yaml.Unmarshal(yamlContents, &serviceGraph)
+	return
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/maxfouquet/isotope/convert/pkg/consts"
+	"github.com/maxfouquet/isotope/convert/pkg/fault"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/pct"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+	"github.com/spf13/cobra"
+)
+
+// faultCmd represents the fault command
+var faultCmd = &cobra.Command{
+	Use:   "fault [service name]",
+	Short: "Inject a fault into every pod of a running mock service",
+	Long: fmt.Sprintf(`Inject a fault into every pod of a running mock service.
+
+Each pod's admin API is reached through the Kubernetes API server, using the
+current kubectl context. --clear removes the fault of --type, or every fault
+if no --type is given.
+
+Fault types: %v`, fault.Types),
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := cmd.PersistentFlags()
+		target := fault.Target{Service: args[0]}
+		var err error
+		target.Namespace, err = flags.GetString("namespace")
+		exitIfError(err)
+		target.AdminPort, err = flags.GetInt32("admin-port")
+		exitIfError(err)
+		faultType, err := flags.GetString("type")
+		exitIfError(err)
+
+		clearFaults, err := flags.GetBool("clear")
+		exitIfError(err)
+		if clearFaults {
+			pods, err := fault.Clear(target, fault.Type(faultType))
+			if len(pods) > 0 {
+				fmt.Printf("cleared faults from %v\n", pods)
+			}
+			exitIfError(err)
+			return
+		}
+
+		f := fault.Fault{Type: fault.Type(faultType)}
+		latency, err := flags.GetDuration("latency")
+		exitIfError(err)
+		f.Latency = policy.Duration(latency)
+		errorRate, err := flags.GetString("error-rate")
+		exitIfError(err)
+		if errorRate != "" {
+			f.ErrorRate, err = pct.FromString(errorRate)
+			exitIfError(err)
+		}
+		f.Status, err = flags.GetInt("status")
+		exitIfError(err)
+		duration, err := flags.GetDuration("duration")
+		exitIfError(err)
+		f.Duration = policy.Duration(duration)
+
+		// The pods injected into before a failure are reported so that the
+		// fault can be cleared from them.
+		pods, err := fault.Apply(target, f)
+		if len(pods) > 0 {
+			fmt.Printf("injected %s fault into %v\n", f.Type, pods)
+		}
+		exitIfError(err)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(faultCmd)
+	flags := faultCmd.PersistentFlags()
+	flags.String(
+		"namespace", consts.ServiceGraphNamespace,
+		"the namespace of the service graph")
+	flags.Int32(
+		"admin-port", consts.ServiceAdminPort,
+		"the port of the services' admin API")
+	flags.String("type", "", "the type of fault")
+	flags.Duration("latency", 0, "the delay added by a latency fault")
+	flags.String(
+		"error-rate", "", `the chance of an error for an errorRate fault, like "5%"`)
+	flags.Int("status", 0, "the HTTP status of a status fault")
+	flags.Duration(
+		"duration", 0,
+		"how long the fault lasts (0 lasts until cleared)")
+	flags.Bool("clear", false, "remove faults instead of injecting one")
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+)
+
+// fmtCmd represents the fmt command
+var fmtCmd = &cobra.Command{
+	Use:   "fmt [YAML file]...",
+	Short: "Rewrite service graph YAML files in canonical form",
+	Long: `Rewrite service graph YAML files in canonical form.
+
+Services are sorted by name, defaults are expanded into every service, calls
+are written in their long form, sizes and percentages are normalized, and the
+current apiVersion and kind are set. Files of an older apiVersion are migrated.
+By default, the result is printed to stdout.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		write, err := cmd.PersistentFlags().GetBool("write")
+		exitIfError(err)
+
+		list, err := cmd.PersistentFlags().GetBool("list")
+		exitIfError(err)
+
+		for _, path := range args {
+			original, err := ioutil.ReadFile(path)
+			exitIfError(err)
+
+			formatted, err := formatServiceGraphYAML(original)
+			exitIfError(err)
+
+			isFormatted := bytes.Equal(original, formatted)
+			if list && !isFormatted {
+				fmt.Println(path)
+			}
+			if write && !isFormatted {
+				exitIfError(ioutil.WriteFile(path, formatted, 0644))
+			}
+			if !list && !write {
+				fmt.Print(string(formatted))
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fmtCmd)
+	fmtCmd.PersistentFlags().BoolP(
+		"write", "w", false, "write the result to the source file")
+	fmtCmd.PersistentFlags().BoolP(
+		"list", "l", false, "list the files whose formatting differs")
+}
+
+func formatServiceGraphYAML(yamlContents []byte) ([]byte, error) {
+	var serviceGraph graph.ServiceGraph
+	err := yaml.Unmarshal(yamlContents, &serviceGraph)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(graph.Canonical(serviceGraph))
+}
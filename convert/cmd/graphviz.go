@@ -23,7 +23,25 @@ var graphvizCmd = &cobra.Command{
 		err = yaml.Unmarshal(yamlContents, &serviceGraph)
 		exitIfError(err)
 
-		dotLang, err := graphviz.ServiceGraphToDotLanguage(serviceGraph)
+		heatPath, err := cmd.PersistentFlags().GetString("heat")
+		exitIfError(err)
+
+		heatMetric, err := cmd.PersistentFlags().GetString("heat-metric")
+		exitIfError(err)
+
+		g, err := graphviz.ServiceGraphToGraph(serviceGraph)
+		exitIfError(err)
+
+		if heatPath != "" {
+			metrics, err := readMetrics(heatPath)
+			exitIfError(err)
+
+			g, err = graphviz.ApplyHeat(
+				g, metrics, graphviz.HeatMetric(heatMetric))
+			exitIfError(err)
+		}
+
+		dotLang, err := graphviz.GraphToDotLanguage(g)
 		exitIfError(err)
 
 		outFileName := args[1]
@@ -34,4 +52,19 @@ var graphvizCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(graphvizCmd)
+	graphvizCmd.PersistentFlags().String(
+		"heat", "",
+		"a YAML or JSON metrics file used to color services by --heat-metric")
+	graphvizCmd.PersistentFlags().String(
+		"heat-metric", string(graphviz.HeatLatency),
+		"the metric to color services by: latency or errorRate")
+}
+
+func readMetrics(path string) (metrics graphviz.Metrics, err error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	err = yaml.Unmarshal(contents, &metrics)
+	return
 }
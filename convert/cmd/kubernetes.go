@@ -3,41 +3,33 @@ package cmd
 import (
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 	"strings"
 
 	"github.com/maxfouquet/isotope/convert/pkg/graph"
 	"github.com/maxfouquet/isotope/convert/pkg/kubernetes"
 	"github.com/ghodss/yaml"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	apiv1 "k8s.io/api/core/v1"
 )
 
 // kubernetesCmd represents the kubernetes command
 var kubernetesCmd = &cobra.Command{
-	Use:   "kubernetes",
+	Use:   "kubernetes [YAML file] [output file]",
 	Short: "Convert service graph YAML to manifests for performance testing",
-	Args:  cobra.ExactArgs(4),
+	Long: `Convert service graph YAML to manifests for performance testing.
+
+The cluster layout is described by a generation profile in YAML or TOML,
+given by --profile. Flags override the settings of the profile.`,
+	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		inPath := args[0]
 		outPath := args[1]
 
-		serviceNodeSelectorStr := args[2]
-		serviceNodeSelector, err := extractNodeSelector(
-			serviceNodeSelectorStr)
-		exitIfError(err)
-
-		clientNodeSelectorStr := args[3]
-		clientNodeSelector, err := extractNodeSelector(clientNodeSelectorStr)
-		exitIfError(err)
-
-		serviceImage, err := cmd.PersistentFlags().GetString("service-image")
-		exitIfError(err)
-
-		serviceMaxIdleConnectionsPerHost, err :=
-			cmd.PersistentFlags().GetInt("service-max-idle-connections-per-host")
-		exitIfError(err)
-
-		clientImage, err := cmd.PersistentFlags().GetString("client-image")
+		profile, err := profileFromFlags(cmd.PersistentFlags())
 		exitIfError(err)
+		exitIfError(profile.Validate())
 
 		yamlContents, err := ioutil.ReadFile(inPath)
 		exitIfError(err)
@@ -46,8 +38,7 @@ var kubernetesCmd = &cobra.Command{
 		exitIfError(yaml.Unmarshal(yamlContents, &serviceGraph))
 
 		manifests, err := kubernetes.ServiceGraphToKubernetesManifests(
-			serviceGraph, serviceNodeSelector, serviceImage,
-			serviceMaxIdleConnectionsPerHost, clientNodeSelector, clientImage)
+			serviceGraph, profile)
 		exitIfError(err)
 
 		exitIfError(writeManifest(outPath, manifests))
@@ -56,13 +47,181 @@ var kubernetesCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(kubernetesCmd)
-	kubernetesCmd.PersistentFlags().String(
+	flags := kubernetesCmd.PersistentFlags()
+	flags.String(
+		"profile", "",
+		"the generation profile (.yaml, .yml or .toml) describing the cluster")
+	flags.String(
+		"mesh", "", fmt.Sprintf("the service mesh to deploy into (one of %v)",
+			kubernetes.Meshes))
+	flags.Bool(
+		"scope-sidecars", false,
+		"limit each Istio sidecar's configuration to the services it calls")
+	flags.Bool(
+		"access-policies", false,
+		"admit calls to each service only from its callers")
+	flags.String(
+		"config-maps", "",
+		"how the service graph is split across config maps "+
+			"(single, per-service or sharded)")
+	flags.String("namespace", "", "the namespace of the service graph")
+	flags.StringSlice(
+		"label", nil, "a key=value label to add to every resource (repeatable)")
+	flags.StringSlice(
+		"annotation", nil,
+		"a key=value annotation to add to every resource (repeatable)")
+	flags.String(
 		"service-image", "", "the image to deploy for all services in the graph")
-	kubernetesCmd.PersistentFlags().Int(
+	flags.String(
+		"service-image-pull-policy", "", "the pull policy of the service image")
+	flags.Int32("service-port", 0, "the port every service listens on")
+	flags.Int(
 		"service-max-idle-connections-per-host", 0,
 		"maximum number of connections to keep open per host on each service")
-	kubernetesCmd.PersistentFlags().String(
+	flags.StringSlice(
+		"service-node-selector", nil,
+		"a key=value node selector for services (repeatable)")
+	flags.String(
 		"client-image", "", "the image to use for the load testing client job")
+	flags.String(
+		"client-image-pull-policy", "", "the pull policy of the client image")
+	flags.StringSlice(
+		"client-node-selector", nil,
+		"a key=value node selector for the client (repeatable)")
+}
+
+// profileFromFlags reads the profile given by --profile, or the default
+// profile, and overrides it with the other flags which were set.
+func profileFromFlags(flags *pflag.FlagSet) (
+	profile kubernetes.Profile, err error) {
+	profilePath, err := flags.GetString("profile")
+	if err != nil {
+		return
+	}
+	profile = kubernetes.DefaultProfile()
+	if profilePath != "" {
+		profile, err = readProfile(profilePath)
+		if err != nil {
+			return
+		}
+	}
+
+	overrides := []struct {
+		flag  string
+		apply func() error
+	}{
+		{"mesh", func() error {
+			mesh, err := flags.GetString("mesh")
+			profile.Mesh = kubernetes.MeshName(mesh)
+			return err
+		}},
+		{"scope-sidecars", func() (err error) {
+			profile.ScopeSidecars, err = flags.GetBool("scope-sidecars")
+			return
+		}},
+		{"access-policies", func() (err error) {
+			profile.AccessPolicies, err = flags.GetBool("access-policies")
+			return
+		}},
+		{"config-maps", func() error {
+			layout, err := flags.GetString("config-maps")
+			profile.ConfigMaps = kubernetes.ConfigMapLayout(layout)
+			return err
+		}},
+		{"namespace", func() (err error) {
+			profile.Namespace.Name, err = flags.GetString("namespace")
+			return
+		}},
+		{"label", func() error {
+			return addKeyValues(flags, "label", &profile.Labels)
+		}},
+		{"annotation", func() error {
+			return addKeyValues(flags, "annotation", &profile.Annotations)
+		}},
+		{"service-image", func() (err error) {
+			profile.Service.Image, err = flags.GetString("service-image")
+			return
+		}},
+		{"service-image-pull-policy", func() error {
+			policy, err := flags.GetString("service-image-pull-policy")
+			profile.Service.ImagePullPolicy = apiv1.PullPolicy(policy)
+			return err
+		}},
+		{"service-port", func() (err error) {
+			profile.Service.Port, err = flags.GetInt32("service-port")
+			return
+		}},
+		{"service-max-idle-connections-per-host", func() (err error) {
+			profile.Service.MaxIdleConnectionsPerHost, err = flags.GetInt(
+				"service-max-idle-connections-per-host")
+			return
+		}},
+		{"service-node-selector", func() error {
+			return addKeyValues(
+				flags, "service-node-selector", &profile.Service.NodeSelector)
+		}},
+		{"client-image", func() (err error) {
+			profile.Client.Image, err = flags.GetString("client-image")
+			return
+		}},
+		{"client-image-pull-policy", func() error {
+			policy, err := flags.GetString("client-image-pull-policy")
+			profile.Client.ImagePullPolicy = apiv1.PullPolicy(policy)
+			return err
+		}},
+		{"client-node-selector", func() error {
+			return addKeyValues(
+				flags, "client-node-selector", &profile.Client.NodeSelector)
+		}},
+	}
+	for _, override := range overrides {
+		if !flags.Changed(override.flag) {
+			continue
+		}
+		err = override.apply()
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// readProfile reads a YAML or TOML profile, depending on the extension of
+// path.
+func readProfile(path string) (kubernetes.Profile, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return kubernetes.Profile{}, err
+	}
+	switch filepath.Ext(path) {
+	case ".toml":
+		return kubernetes.ProfileFromTOML(contents)
+	case ".yaml", ".yml":
+		return kubernetes.ProfileFromYAML(contents)
+	default:
+		return kubernetes.Profile{}, fmt.Errorf(
+			"%s is not a .yaml, .yml or .toml file", path)
+	}
+}
+
+// addKeyValues adds each key=value of the flag named name to m.
+func addKeyValues(
+	flags *pflag.FlagSet, name string, m *map[string]string) error {
+	keyValues, err := flags.GetStringSlice(name)
+	if err != nil {
+		return err
+	}
+	if *m == nil {
+		*m = make(map[string]string, len(keyValues))
+	}
+	for _, keyValue := range keyValues {
+		k, v, err := splitByEquals(keyValue)
+		if err != nil {
+			return err
+		}
+		(*m)[k] = v
+	}
+	return nil
 }
 
 func writeManifest(path string, manifest []byte) error {
@@ -70,22 +229,12 @@ func writeManifest(path string, manifest []byte) error {
 }
 
 func splitByEquals(s string) (k string, v string, err error) {
-	parts := strings.Split(s, "=")
+	parts := strings.SplitN(s, "=", 2)
 	if len(parts) != 2 {
-		err = fmt.Errorf("%s is not a valid node selector", s)
+		err = fmt.Errorf("%s is not of the form key=value", s)
 		return
 	}
 	k = parts[0]
 	v = parts[1]
 	return
 }
-
-func extractNodeSelector(s string) (map[string]string, error) {
-	nodeSelector := make(map[string]string, 1)
-	k, v, err := splitByEquals(s)
-	if err != nil {
-		return nodeSelector, err
-	}
-	nodeSelector[k] = v
-	return nodeSelector, nil
-}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/maxfouquet/isotope/convert/pkg/schema"
+	"github.com/spf13/cobra"
+)
+
+// schemaCmd represents the schema command
+var schemaCmd = &cobra.Command{
+	Use:   "schema [output file]",
+	Short: "Print the JSON Schema for service graph YAML files",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		schemaJSON, err := schema.JSON()
+		exitIfError(err)
+
+		if len(args) == 0 {
+			fmt.Println(string(schemaJSON))
+			return
+		}
+		exitIfError(ioutil.WriteFile(args[0], schemaJSON, 0644))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(schemaCmd)
+}
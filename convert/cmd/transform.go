@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/maxfouquet/isotope/convert/pkg/transform"
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+)
+
+// transformCmd represents the transform command
+var transformCmd = &cobra.Command{
+	Use:   "transform [YAML file] [output file] [operation]...",
+	Short: "Derive a new service graph YAML file from an existing one",
+	Long: `Derive a new service graph YAML file from an existing one.
+
+Operations are applied in the order they are given:
+
+  scaleReplicas=FACTOR   multiply every service's replicas by FACTOR
+  scaleSleeps=FACTOR     multiply every sleep's duration by FACTOR
+  prefix=PREFIX          prepend PREFIX to every service's name
+  extract=SERVICE        keep only SERVICE and the services it reaches
+  merge=FILE[,PREFIX]    add the services of FILE, optionally prefixed`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		serviceGraph, err := serviceGraphFromYAMLFile(args[0])
+		exitIfError(err)
+
+		transformations := make([]transform.Transformation, 0, len(args)-2)
+		for _, op := range args[2:] {
+			transformation, err := parseTransformation(op)
+			exitIfError(err)
+			transformations = append(transformations, transformation)
+		}
+
+		serviceGraph, err = transform.Apply(serviceGraph, transformations...)
+		exitIfError(err)
+
+		yamlContents, err := yaml.Marshal(serviceGraph)
+		exitIfError(err)
+
+		exitIfError(ioutil.WriteFile(args[1], yamlContents, 0644))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(transformCmd)
+}
+
+func parseTransformation(op string) (transform.Transformation, error) {
+	name, arg, err := splitByEquals(op)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid operation", op)
+	}
+	switch name {
+	case "scaleReplicas":
+		factor, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, err
+		}
+		return transform.ScaleReplicas(factor), nil
+	case "scaleSleeps":
+		factor, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, err
+		}
+		return transform.ScaleSleeps(factor), nil
+	case "prefix":
+		return transform.Prefix(arg), nil
+	case "extract":
+		return transform.Extract(arg), nil
+	case "merge":
+		parts := strings.SplitN(arg, ",", 2)
+		other, err := serviceGraphFromYAMLFile(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) == 2 {
+			other, err = transform.Apply(other, transform.Prefix(parts[1]))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return transform.Merge(other), nil
+	default:
+		return nil, fmt.Errorf("unknown operation: %s", name)
+	}
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/maxfouquet/isotope/convert/pkg/verify"
+	"github.com/spf13/cobra"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify [YAML file] [entrypoint URL]",
+	Short: "Check that a deployed service graph behaves as specified",
+	Long: `Check that a deployed service graph behaves as specified.
+
+Sends --requests requests to the entrypoint URL, asking each service for its
+call tree, and compares the trees with the service graph: every service must
+run its script, in order, calling the services it specifies. The rate at which
+each service succeeds must be within --tolerance of the rate implied by the
+failure policies of the graph; its error rates are left out, since the mock
+service does not fail by them. Exits with status 1 if there are mismatches.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := cmd.PersistentFlags()
+		output, err := flags.GetString("output")
+		exitIfError(err)
+		var opts verify.Options
+		opts.Requests, err = flags.GetInt("requests")
+		exitIfError(err)
+		opts.Tolerance, err = flags.GetFloat64("tolerance")
+		exitIfError(err)
+
+		serviceGraph, err := serviceGraphFromYAMLFile(args[0])
+		exitIfError(err)
+
+		report, err := verify.Run(serviceGraph, args[1], opts)
+		exitIfError(err)
+
+		switch output {
+		case "text":
+			fmt.Print(report)
+		case "json":
+			b, err := json.MarshalIndent(report, "", "  ")
+			exitIfError(err)
+			fmt.Println(string(b))
+		default:
+			exitIfError(fmt.Errorf("unknown output format: %s", output))
+		}
+		if !report.OK() {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	flags := verifyCmd.PersistentFlags()
+	flags.IntP("requests", "n", 100, "the number of requests to send")
+	flags.Float64(
+		"tolerance", verify.DefaultTolerance,
+		"the most by which each service's success rate may differ from the "+
+			"expected rate, from 0 to 1")
+	flags.StringP("output", "o", "text", "the output format: text or json")
+}
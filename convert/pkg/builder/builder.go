@@ -0,0 +1,435 @@
+// Package builder constructs service graphs in Go.
+//
+// A graph is described fluently and produces the same graph.ServiceGraph as
+// the equivalent YAML:
+//
+//	g, err := builder.NewGraph().
+//		Defaults(builder.Defaults{RequestSize: 1024}).
+//		Service("a").Entrypoint().Calls("b", 128).Sleep(10 * time.Millisecond).
+//		Service("b").Replicas(2).
+//		Build()
+//
+// Defaults are applied, and the graph validated, when Build is called.
+package builder
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/k8s"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/pct"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/size"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
+)
+
+// Defaults holds the values given to every service, and every call, which
+// does not set its own. It corresponds to the "defaults" block in YAML.
+type Defaults struct {
+	// Type defaults to svctype.ServiceHTTP if unset.
+	Type svctype.ServiceType
+	// NumReplicas defaults to 1 if unset.
+	NumReplicas  int32
+	ErrorRate    pct.Percentage
+	ResponseSize size.ByteSize
+	Script       script.Script
+	RequestSize  size.ByteSize
+	Kubernetes   *k8s.Settings
+	Policy       *policy.Policy
+
+	MaxConcurrency int
+	QueueSize      int
+	Overflow       svc.Overflow
+	RateLimit      *svc.RateLimit
+	LoadShedding   *svc.LoadShedding
+}
+
+// GraphBuilder builds a graph.ServiceGraph.
+type GraphBuilder struct {
+	defaults Defaults
+	services []*ServiceBuilder
+}
+
+// NewGraph starts building an empty graph.
+func NewGraph() *GraphBuilder {
+	return &GraphBuilder{}
+}
+
+// Defaults sets the defaults for every service in the graph, including those
+// already added.
+func (b *GraphBuilder) Defaults(defaults Defaults) *GraphBuilder {
+	b.defaults = defaults
+	return b
+}
+
+// Service adds a service named name to the graph and starts building it.
+func (b *GraphBuilder) Service(name string) *ServiceBuilder {
+	s := &ServiceBuilder{graph: b, name: name}
+	b.services = append(b.services, s)
+	return s
+}
+
+// Build applies the defaults to each service and returns the graph if it is
+// valid.
+func (b *GraphBuilder) Build() (graph.ServiceGraph, error) {
+	defaults := b.defaults
+	if defaults.Type == svctype.ServiceUnknown {
+		defaults.Type = svctype.ServiceHTTP
+	}
+	if defaults.NumReplicas == 0 {
+		defaults.NumReplicas = 1
+	}
+
+	g := graph.ServiceGraph{
+		Services: make([]svc.Service, 0, len(b.services)),
+	}
+	for _, s := range b.services {
+		service, err := s.build(defaults)
+		if err != nil {
+			return graph.ServiceGraph{}, err
+		}
+		g.Services = append(g.Services, service)
+	}
+	if err := graph.Validate(g); err != nil {
+		return graph.ServiceGraph{}, err
+	}
+	return g, nil
+}
+
+// ServiceBuilder builds a single svc.Service. Fields which are not set take
+// their value from the graph's Defaults.
+type ServiceBuilder struct {
+	graph *GraphBuilder
+	name  string
+
+	labels       map[string]string
+	serviceType  *svctype.ServiceType
+	numReplicas  *int32
+	errorRate    *pct.Percentage
+	responseSize *size.ByteSize
+	kubernetes   *k8s.Settings
+	policy       *policy.Policy
+	edgePolicies map[string]policy.Route
+	concurrency  *concurrency
+	rateLimit    *svc.RateLimit
+	loadShedding *svc.LoadShedding
+	isEntrypoint bool
+	script       script.Script
+	hasScript    bool
+}
+
+// Label sets the label key to value on the service.
+func (s *ServiceBuilder) Label(key, value string) *ServiceBuilder {
+	if s.labels == nil {
+		s.labels = map[string]string{}
+	}
+	s.labels[key] = value
+	return s
+}
+
+// Type sets the protocol of the service.
+func (s *ServiceBuilder) Type(t svctype.ServiceType) *ServiceBuilder {
+	s.serviceType = &t
+	return s
+}
+
+// Replicas sets the number of replicas backing the service.
+func (s *ServiceBuilder) Replicas(n int32) *ServiceBuilder {
+	s.numReplicas = &n
+	return s
+}
+
+// ErrorRate sets the chance that the service is modelled to fail.
+func (s *ServiceBuilder) ErrorRate(p pct.Percentage) *ServiceBuilder {
+	s.errorRate = &p
+	return s
+}
+
+// ResponseSize sets the size of the service's response bodies.
+func (s *ServiceBuilder) ResponseSize(z size.ByteSize) *ServiceBuilder {
+	s.responseSize = &z
+	return s
+}
+
+// Kubernetes sets how the service is scheduled and sized on Kubernetes. The
+// settings which are set override the defaults one by one, as a service's
+// "kubernetes" block does in YAML.
+func (s *ServiceBuilder) Kubernetes(settings k8s.Settings) *ServiceBuilder {
+	s.kubernetes = &settings
+	return s
+}
+
+// Policy sets how a service mesh handles calls to the service. The settings
+// which are set override the defaults one by one, as a service's "policy"
+// block does in YAML.
+func (s *ServiceBuilder) Policy(p policy.Policy) *ServiceBuilder {
+	s.policy = &p
+	return s
+}
+
+// Concurrency limits the service to serving max requests at once, with up to
+// queue more waiting, and sets what happens to the requests which overflow
+// the queue. Like a service which sets "maxConcurrency", "queueSize" and
+// "overflow" in YAML, it overrides all three defaults, even with zero values.
+func (s *ServiceBuilder) Concurrency(
+	max, queue int, overflow svc.Overflow) *ServiceBuilder {
+	s.concurrency = &concurrency{max, queue, overflow}
+	return s
+}
+
+// RateLimit limits the rate at which the service accepts requests. Like a
+// service's "rateLimit" block in YAML, it replaces the default rate limit
+// rather than merging with it.
+func (s *ServiceBuilder) RateLimit(r svc.RateLimit) *ServiceBuilder {
+	s.rateLimit = &r
+	return s
+}
+
+// LoadShedding sets how the service rejects requests of low priority while it
+// is slow. Like a service's "loadShedding" block in YAML, it replaces the
+// default rather than merging with it.
+func (s *ServiceBuilder) LoadShedding(l svc.LoadShedding) *ServiceBuilder {
+	s.loadShedding = &l
+	return s
+}
+
+// EdgePolicy overrides the route settings of the service called name for the
+// calls made by this service.
+func (s *ServiceBuilder) EdgePolicy(name string, r policy.Route) *ServiceBuilder {
+	if s.edgePolicies == nil {
+		s.edgePolicies = map[string]policy.Route{}
+	}
+	s.edgePolicies[name] = r
+	return s
+}
+
+// Entrypoint marks the service as an entrypoint into the graph.
+func (s *ServiceBuilder) Entrypoint() *ServiceBuilder {
+	s.isEntrypoint = true
+	return s
+}
+
+// Calls appends a step which sends a request of z bytes to the service named
+// name.
+func (s *ServiceBuilder) Calls(name string, z size.ByteSize) *ServiceBuilder {
+	return s.appendStep(sizedRequest{name, &z})
+}
+
+// Call appends a step which sends a request of the default request size to the
+// service named name.
+func (s *ServiceBuilder) Call(name string) *ServiceBuilder {
+	return s.appendStep(sizedRequest{name, nil})
+}
+
+// Sleep appends a step which pauses for d.
+func (s *ServiceBuilder) Sleep(d time.Duration) *ServiceBuilder {
+	return s.appendStep(script.SleepCommand(d))
+}
+
+// Concurrently appends a step which executes each command added by f at the
+// same time.
+func (s *ServiceBuilder) Concurrently(
+	f func(*ConcurrentBuilder)) *ServiceBuilder {
+	c := &ConcurrentBuilder{}
+	f(c)
+	return s.appendStep(concurrentStep(c.cmd))
+}
+
+// Service finishes this service and starts building another; see
+// GraphBuilder.Service.
+func (s *ServiceBuilder) Service(name string) *ServiceBuilder {
+	return s.graph.Service(name)
+}
+
+// Build builds the whole graph; see GraphBuilder.Build.
+func (s *ServiceBuilder) Build() (graph.ServiceGraph, error) {
+	return s.graph.Build()
+}
+
+func (s *ServiceBuilder) appendStep(cmd script.Command) *ServiceBuilder {
+	s.script = append(s.script, cmd)
+	s.hasScript = true
+	return s
+}
+
+func (s *ServiceBuilder) build(defaults Defaults) (svc.Service, error) {
+	if s.name == "" {
+		return svc.Service{}, svc.ErrEmptyName
+	}
+	service := svc.Service{
+		Name:         s.name,
+		Labels:       s.labels,
+		Type:         defaults.Type,
+		NumReplicas:  defaults.NumReplicas,
+		IsEntrypoint: s.isEntrypoint,
+		ErrorRate:    defaults.ErrorRate,
+		ResponseSize: defaults.ResponseSize,
+		Script:       defaults.Script,
+		Kubernetes:   defaults.Kubernetes,
+		Policy:       defaults.Policy,
+		EdgePolicies: s.edgePolicies,
+
+		MaxConcurrency: defaults.MaxConcurrency,
+		QueueSize:      defaults.QueueSize,
+		Overflow:       defaults.Overflow,
+		RateLimit:      defaults.RateLimit,
+		LoadShedding:   defaults.LoadShedding,
+	}
+	if s.serviceType != nil {
+		service.Type = *s.serviceType
+	}
+	if s.numReplicas != nil {
+		service.NumReplicas = *s.numReplicas
+	}
+	if s.errorRate != nil {
+		service.ErrorRate = *s.errorRate
+	}
+	if s.responseSize != nil {
+		service.ResponseSize = *s.responseSize
+	}
+	if s.kubernetes != nil {
+		service.Kubernetes = &k8s.Settings{}
+		err := mergeSettings(defaults.Kubernetes, s.kubernetes, service.Kubernetes)
+		if err != nil {
+			return svc.Service{}, err
+		}
+	}
+	if s.policy != nil {
+		service.Policy = &policy.Policy{}
+		err := mergeSettings(defaults.Policy, s.policy, service.Policy)
+		if err != nil {
+			return svc.Service{}, err
+		}
+	}
+	if s.concurrency != nil {
+		service.MaxConcurrency = s.concurrency.max
+		service.QueueSize = s.concurrency.queue
+		service.Overflow = s.concurrency.overflow
+	}
+	if s.rateLimit != nil {
+		service.RateLimit = s.rateLimit
+	}
+	if s.loadShedding != nil {
+		service.LoadShedding = s.loadShedding
+	}
+	if s.hasScript {
+		service.Script = resolveCommands(s.script, defaults.RequestSize)
+	}
+	return service, nil
+}
+
+// mergeSettings sets merged to base, with each setting of override taking
+// precedence, in the same way as graph.Decoder merges the "kubernetes" and
+// "policy" blocks of its layers: by the keys of their JSON objects.
+func mergeSettings(base, override, merged interface{}) error {
+	object := map[string]json.RawMessage{}
+	for _, layer := range []interface{}{base, override} {
+		b, err := json.Marshal(layer)
+		if err != nil {
+			return err
+		}
+		// A nil base is null, which leaves object unchanged.
+		if err := json.Unmarshal(b, &object); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, merged)
+}
+
+// ConcurrentBuilder builds the commands of a script.ConcurrentCommand.
+type ConcurrentBuilder struct {
+	cmd script.ConcurrentCommand
+}
+
+// Policy sets how the success of the commands decides the success of the
+// whole; see script.FailurePolicy.
+func (c *ConcurrentBuilder) Policy(p script.FailurePolicy) *ConcurrentBuilder {
+	c.cmd.Policy = p
+	return c
+}
+
+// Quorum sets the script.Quorum policy, which succeeds once k commands do.
+func (c *ConcurrentBuilder) Quorum(k int) *ConcurrentBuilder {
+	c.cmd.Policy = script.Quorum
+	c.cmd.Quorum = k
+	return c
+}
+
+// Hedge sets the script.FirstSuccess policy, which starts each command after
+// the previous fails or d passes.
+func (c *ConcurrentBuilder) Hedge(d time.Duration) *ConcurrentBuilder {
+	c.cmd.Policy = script.FirstSuccess
+	c.cmd.HedgeDelay = d
+	return c
+}
+
+// Calls adds a request of z bytes to the service named name.
+func (c *ConcurrentBuilder) Calls(
+	name string, z size.ByteSize) *ConcurrentBuilder {
+	c.cmd.Commands = append(c.cmd.Commands, sizedRequest{name, &z})
+	return c
+}
+
+// Call adds a request of the default request size to the service named name.
+func (c *ConcurrentBuilder) Call(name string) *ConcurrentBuilder {
+	c.cmd.Commands = append(c.cmd.Commands, sizedRequest{name, nil})
+	return c
+}
+
+// Sleep adds a pause of d.
+func (c *ConcurrentBuilder) Sleep(d time.Duration) *ConcurrentBuilder {
+	c.cmd.Commands = append(c.cmd.Commands, script.SleepCommand(d))
+	return c
+}
+
+// concurrency holds the limits set by ServiceBuilder.Concurrency.
+type concurrency struct {
+	max      int
+	queue    int
+	overflow svc.Overflow
+}
+
+// sizedRequest is a placeholder for a script.RequestCommand whose size is
+// resolved against the defaults when the graph is built.
+type sizedRequest struct {
+	serviceName string
+	size        *size.ByteSize
+}
+
+// concurrentStep is a placeholder for a script.ConcurrentCommand whose
+// commands are resolved when the graph is built.
+type concurrentStep script.ConcurrentCommand
+
+func resolveCommands(
+	cmds []script.Command, defaultRequestSize size.ByteSize) script.Script {
+	resolved := make(script.Script, 0, len(cmds))
+	for _, cmd := range cmds {
+		resolved = append(resolved, resolveCommand(cmd, defaultRequestSize))
+	}
+	return resolved
+}
+
+func resolveCommand(
+	cmd script.Command, defaultRequestSize size.ByteSize) script.Command {
+	switch cmd := cmd.(type) {
+	case sizedRequest:
+		z := defaultRequestSize
+		if cmd.size != nil {
+			z = *cmd.size
+		}
+		return script.RequestCommand{ServiceName: cmd.serviceName, Size: z}
+	case concurrentStep:
+		resolved := script.ConcurrentCommand(cmd)
+		resolved.Commands = resolveCommands(cmd.Commands, defaultRequestSize)
+		return resolved
+	default:
+		return cmd
+	}
+}
@@ -0,0 +1,217 @@
+package builder
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/k8s"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
+)
+
+const equivalentYAML = `
+defaults:
+  errorRate: 10%
+  maxConcurrency: 4
+  numReplicas: 2
+  requestSize: 516
+  responseSize: 128
+  script:
+  - sleep: 100ms
+services:
+- name: a
+  labels:
+    tier: data
+  numReplicas: 5
+- name: b
+  maxConcurrency: 2
+  queueSize: 8
+  overflow: wait
+  script:
+  - call:
+      service: a
+      size: 1KiB
+  - sleep: 10ms
+- name: c
+  type: grpc
+  kubernetes:
+    priorityClassName: high
+  isEntrypoint: true
+  numReplicas: 1
+  errorRate: 20%
+  rateLimit:
+    requestsPerSecond: 50
+  responseSize: 1K
+  script:
+  - - call: a
+    - call: b
+    - sleep: 1ms
+  - sleep: 10ms
+`
+
+func TestGraphBuilder_Build(t *testing.T) {
+	var expected graph.ServiceGraph
+	if err := yaml.Unmarshal([]byte(equivalentYAML), &expected); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := NewGraph().
+		Defaults(Defaults{
+			ErrorRate:      0.1,
+			NumReplicas:    2,
+			RequestSize:    516,
+			ResponseSize:   128,
+			Script:         script.Script{script.SleepCommand(100 * time.Millisecond)},
+			MaxConcurrency: 4,
+		}).
+		Service("a").Label("tier", "data").Replicas(5).
+		Service("b").
+		Concurrency(2, 8, svc.OverflowWait).
+		Calls("a", 1024).Sleep(10 * time.Millisecond).
+		Service("c").
+		Type(svctype.ServiceGRPC).
+		Kubernetes(k8s.Settings{PriorityClassName: "high"}).
+		Entrypoint().
+		Replicas(1).
+		ErrorRate(0.2).
+		RateLimit(svc.RateLimit{RequestsPerSecond: 50}).
+		ResponseSize(1024).
+		Concurrently(func(c *ConcurrentBuilder) {
+			c.Call("a").Call("b").Sleep(time.Millisecond)
+		}).
+		Sleep(10 * time.Millisecond).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("\nexpected: %v\nactual:   %v", expected, actual)
+	}
+}
+
+const mergedDefaultsYAML = `
+defaults:
+  kubernetes:
+    nodeSelector:
+      pool: services
+    priorityClassName: low
+  policy:
+    loadBalancer: LEAST_REQUEST
+    timeout: 1s
+  maxConcurrency: 4
+  queueSize: 8
+  overflow: wait
+  rateLimit:
+    requestsPerSecond: 10
+    burst: 5
+  loadShedding:
+    latencyTarget: 100ms
+    minPriority: 1
+services:
+- name: a
+  kubernetes:
+    priorityClassName: high
+  policy:
+    timeout: 2s
+  maxConcurrency: 2
+  queueSize: 0
+  overflow: reject
+  rateLimit:
+    requestsPerSecond: 20
+  loadShedding:
+    latencyTarget: 50ms
+- name: b
+`
+
+func TestGraphBuilder_Build_MergesDefaults(t *testing.T) {
+	b, err := yaml.YAMLToJSON([]byte(mergedDefaultsYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := graph.Decoder{}.Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := NewGraph().
+		Defaults(Defaults{
+			Kubernetes: &k8s.Settings{
+				NodeSelector:      map[string]string{"pool": "services"},
+				PriorityClassName: "low",
+			},
+			Policy: &policy.Policy{
+				LoadBalancer: policy.LeastRequest,
+				Route:        policy.Route{Timeout: policy.Duration(time.Second)},
+			},
+			MaxConcurrency: 4,
+			QueueSize:      8,
+			Overflow:       svc.OverflowWait,
+			RateLimit:      &svc.RateLimit{RequestsPerSecond: 10, Burst: 5},
+			LoadShedding: &svc.LoadShedding{
+				LatencyTarget: policy.Duration(100 * time.Millisecond),
+				MinPriority:   1,
+			},
+		}).
+		Service("a").
+		Kubernetes(k8s.Settings{PriorityClassName: "high"}).
+		Policy(policy.Policy{
+			Route: policy.Route{Timeout: policy.Duration(2 * time.Second)},
+		}).
+		Concurrency(2, 0, svc.OverflowReject).
+		RateLimit(svc.RateLimit{RequestsPerSecond: 20}).
+		LoadShedding(svc.LoadShedding{
+			LatencyTarget: policy.Duration(50 * time.Millisecond),
+		}).
+		Service("b").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("\nexpected: %v\nactual:   %v", expected, actual)
+	}
+}
+
+func TestGraphBuilder_Build_Invalid(t *testing.T) {
+	tests := []struct {
+		builder *GraphBuilder
+		err     error
+	}{
+		{
+			NewGraph().Service("a").Call("b").graph,
+			graph.ErrRequestToUndefinedService{ServiceName: "b"},
+		},
+		{
+			NewGraph().Service("a").Service("a").graph,
+			graph.ErrDuplicateService{ServiceName: "a"},
+		},
+		{
+			NewGraph().Service("").graph,
+			svc.ErrEmptyName,
+		},
+		{
+			NewGraph().Service("a").Concurrency(0, 4, svc.OverflowWait).graph,
+			graph.ErrInvalidConcurrency{
+				ServiceName: "a",
+				Reason:      "queueSize and overflow require maxConcurrency",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			_, err := test.builder.Build()
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Package calltree describes what a mock service executed to serve a request,
+// as returned in the response body when the request asks for it.
+package calltree
+
+import (
+	"net/http"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+)
+
+// HeaderKey is the HTTP header which asks a mock service to respond with the
+// Tree of the request instead of echoing it. Mock services forward it to the
+// services they call, so the entrypoint returns the whole execution tree. It
+// must be in Train-Case.
+const HeaderKey = "Path-Traces"
+
+// Requested returns true if header asks for the call tree.
+func Requested(header http.Header) bool {
+	return header.Get(HeaderKey) != ""
+}
+
+// Tree is what a service executed to serve one request.
+type Tree struct {
+	// Service is the name of the service.
+	Service string `json:"service"`
+	// Hostname is the hostname of the pod which served the request.
+	Hostname string `json:"hostname,omitempty"`
+	// Status is the HTTP status with which the service responded.
+	Status int `json:"status"`
+	// Duration is the time from receiving the request to responding.
+	Duration policy.Duration `json:"duration"`
+	// Steps are the steps of the service's script which were executed, in
+	// order. A step which fails ends the script.
+	Steps []Step `json:"steps,omitempty"`
+}
+
+// Step is an executed step of a script. Exactly one of Sleep, Call and
+// Concurrent is set.
+type Step struct {
+	// Sleep is the time the step was set to sleep for.
+	Sleep *policy.Duration `json:"sleep,omitempty"`
+	// Call is the call the step made.
+	Call *Call `json:"call,omitempty"`
+	// Concurrent are the steps which were executed concurrently.
+	Concurrent []Step `json:"concurrent,omitempty"`
+
+	// Duration is the time the step took.
+	Duration policy.Duration `json:"duration"`
+	// Error is why the step failed, if it did.
+	Error string `json:"error,omitempty"`
+	// Canceled is true if the step was stopped, or never started, because the
+	// outcome of its concurrent group was already decided.
+	Canceled bool `json:"canceled,omitempty"`
+}
+
+// Call is a request to another service.
+type Call struct {
+	// Service is the name of the service called.
+	Service string `json:"service"`
+	// Status is the HTTP status of the response, or 0 if there was none.
+	Status int `json:"status,omitempty"`
+	// Tree is the call tree returned by the service called, or nil if the
+	// response did not hold one, such as when it was sent by a proxy or an
+	// injected fault.
+	Tree *Tree `json:"tree,omitempty"`
+}
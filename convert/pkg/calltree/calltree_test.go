@@ -0,0 +1,77 @@
+package calltree
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+)
+
+func TestRequested(t *testing.T) {
+	tests := []struct {
+		header   http.Header
+		expected bool
+	}{
+		{http.Header{}, false},
+		{http.Header{HeaderKey: []string{"true"}}, true},
+		{http.Header{HeaderKey: []string{""}}, false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			if actual := Requested(test.header); test.expected != actual {
+				t.Errorf("expected %v; actual %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestTree_JSON(t *testing.T) {
+	sleep := policy.Duration(10 * time.Millisecond)
+	tree := Tree{
+		Service:  "a",
+		Hostname: "a-5d8f7c-x2x9z",
+		Status:   http.StatusInternalServerError,
+		Duration: policy.Duration(25 * time.Millisecond),
+		Steps: []Step{
+			{Sleep: &sleep, Duration: sleep},
+			{
+				Concurrent: []Step{
+					{
+						Call: &Call{
+							Service: "b",
+							Status:  http.StatusOK,
+							Tree:    &Tree{Service: "b", Status: http.StatusOK},
+						},
+						Duration: policy.Duration(5 * time.Millisecond),
+					},
+					{
+						Call:     &Call{Service: "c"},
+						Duration: policy.Duration(time.Millisecond),
+						Error:    "connection refused",
+					},
+				},
+				Duration: policy.Duration(5 * time.Millisecond),
+				Error:    "connection refused",
+			},
+		},
+	}
+
+	b, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual Tree
+	if err := json.Unmarshal(b, &actual); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tree, actual) {
+		t.Errorf("expected %+v; actual %+v", tree, actual)
+	}
+}
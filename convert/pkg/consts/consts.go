@@ -7,6 +7,13 @@ const (
 	// ServicePort is the port the service will run on.
 	ServicePort = 8080
 
+	// ServiceAdminPort is the port of the service's admin API, which injects
+	// faults and reports readiness.
+	ServiceAdminPort = 8081
+	// ServiceMetricsPath is the path on the service port at which the service's
+	// Prometheus metrics are available.
+	ServiceMetricsPath = "/metrics"
+
 	// ServiceGraphNamespace is the name of the namespace that all service graph
 	// related components will live in.
 	ServiceGraphNamespace = "service-graph"
@@ -0,0 +1,322 @@
+// Package diff compares two service graphs semantically, ignoring the order
+// in which services are declared.
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+)
+
+// Diff describes the differences between an old and a new ServiceGraph.
+type Diff struct {
+	AddedServices   []string      `json:"addedServices,omitempty"`
+	RemovedServices []string      `json:"removedServices,omitempty"`
+	ChangedServices []ServiceDiff `json:"changedServices,omitempty"`
+	AddedEdges      []Edge        `json:"addedEdges,omitempty"`
+	RemovedEdges    []Edge        `json:"removedEdges,omitempty"`
+	Depth           IntChange     `json:"depth"`
+	Amplification   IntChange     `json:"amplification"`
+}
+
+// ServiceDiff describes the differences between two versions of a service.
+type ServiceDiff struct {
+	Name   string        `json:"name"`
+	Fields []FieldChange `json:"fields,omitempty"`
+	Script []StepChange  `json:"script,omitempty"`
+}
+
+// FieldChange describes a change in the value of a service's field.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// StepChange describes a script step which was added or removed.
+type StepChange struct {
+	// Index is the index of the step in the old script if it was removed or in
+	// the new script if it was added.
+	Index int    `json:"index"`
+	Added bool   `json:"added"`
+	Step  string `json:"step"`
+}
+
+// Edge is a directed call from one service to another.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (e Edge) String() string {
+	return fmt.Sprintf("%s -> %s", e.From, e.To)
+}
+
+// IntChange holds the old and new values of a property of the graph.
+type IntChange struct {
+	Old int `json:"old"`
+	New int `json:"new"`
+}
+
+// ServiceGraphs computes the differences from old to new.
+func ServiceGraphs(old, new graph.ServiceGraph) Diff {
+	oldServices := servicesByName(old)
+	newServices := servicesByName(new)
+
+	var d Diff
+	for _, name := range sortedNames(newServices) {
+		if _, ok := oldServices[name]; !ok {
+			d.AddedServices = append(d.AddedServices, name)
+		}
+	}
+	for _, name := range sortedNames(oldServices) {
+		oldService := oldServices[name]
+		newService, ok := newServices[name]
+		if !ok {
+			d.RemovedServices = append(d.RemovedServices, name)
+			continue
+		}
+		serviceDiff := services(oldService, newService)
+		if len(serviceDiff.Fields) > 0 || len(serviceDiff.Script) > 0 {
+			d.ChangedServices = append(d.ChangedServices, serviceDiff)
+		}
+	}
+
+	oldEdges := edges(old)
+	newEdges := edges(new)
+	for _, e := range newEdges {
+		if !containsEdge(oldEdges, e) {
+			d.AddedEdges = append(d.AddedEdges, e)
+		}
+	}
+	for _, e := range oldEdges {
+		if !containsEdge(newEdges, e) {
+			d.RemovedEdges = append(d.RemovedEdges, e)
+		}
+	}
+
+	d.Depth = IntChange{graph.Depth(old), graph.Depth(new)}
+	d.Amplification = IntChange{
+		graph.Amplification(old), graph.Amplification(new)}
+	return d
+}
+
+// IsEmpty returns true if the two graphs compared are semantically equal.
+func (d Diff) IsEmpty() bool {
+	return len(d.AddedServices) == 0 && len(d.RemovedServices) == 0 &&
+		len(d.ChangedServices) == 0 && len(d.AddedEdges) == 0 &&
+		len(d.RemovedEdges) == 0
+}
+
+// String formats d as human-readable text.
+func (d Diff) String() string {
+	var b bytes.Buffer
+	if d.IsEmpty() {
+		b.WriteString("no differences\n")
+		return b.String()
+	}
+	if len(d.AddedServices) > 0 {
+		fmt.Fprintf(&b, "services added: %s\n", strings.Join(d.AddedServices, ", "))
+	}
+	if len(d.RemovedServices) > 0 {
+		fmt.Fprintf(
+			&b, "services removed: %s\n", strings.Join(d.RemovedServices, ", "))
+	}
+	for _, serviceDiff := range d.ChangedServices {
+		fmt.Fprintf(&b, "service %s:\n", serviceDiff.Name)
+		for _, change := range serviceDiff.Fields {
+			fmt.Fprintf(&b, "  %s: %s -> %s\n", change.Field, change.Old, change.New)
+		}
+		if len(serviceDiff.Script) > 0 {
+			b.WriteString("  script:\n")
+		}
+		for _, change := range serviceDiff.Script {
+			sign := "-"
+			if change.Added {
+				sign = "+"
+			}
+			fmt.Fprintf(&b, "    %s [%d] %s\n", sign, change.Index, change.Step)
+		}
+	}
+	for _, e := range d.AddedEdges {
+		fmt.Fprintf(&b, "edge added: %s\n", e)
+	}
+	for _, e := range d.RemovedEdges {
+		fmt.Fprintf(&b, "edge removed: %s\n", e)
+	}
+	fmt.Fprintf(&b, "depth: %d -> %d\n", d.Depth.Old, d.Depth.New)
+	fmt.Fprintf(
+		&b, "amplification: %d -> %d\n", d.Amplification.Old, d.Amplification.New)
+	return b.String()
+}
+
+func services(old, new svc.Service) ServiceDiff {
+	d := ServiceDiff{Name: old.Name}
+	appendIfChanged := func(field string, old, new interface{}) {
+		if o, n := fmt.Sprint(old), fmt.Sprint(new); o != n {
+			d.Fields = append(d.Fields, FieldChange{field, o, n})
+		}
+	}
+	appendIfChanged("labels", old.Labels, new.Labels)
+	appendIfChanged("type", old.Type, new.Type)
+	appendIfChanged("numReplicas", old.NumReplicas, new.NumReplicas)
+	appendIfChanged("isEntrypoint", old.IsEntrypoint, new.IsEntrypoint)
+	appendIfChanged("errorRate", old.ErrorRate, new.ErrorRate)
+	appendIfChanged("responseSize", old.ResponseSize, new.ResponseSize)
+	appendIfChanged(
+		"kubernetes", jsonString(old.Kubernetes), jsonString(new.Kubernetes))
+	appendIfChanged("policy", jsonString(old.Policy), jsonString(new.Policy))
+	appendIfChanged(
+		"edgePolicies",
+		jsonString(old.EdgePolicies), jsonString(new.EdgePolicies))
+	appendIfChanged("maxConcurrency", old.MaxConcurrency, new.MaxConcurrency)
+	appendIfChanged("queueSize", old.QueueSize, new.QueueSize)
+	appendIfChanged("overflow", old.Overflow, new.Overflow)
+	appendIfChanged(
+		"rateLimit", jsonString(old.RateLimit), jsonString(new.RateLimit))
+	appendIfChanged(
+		"loadShedding",
+		jsonString(old.LoadShedding), jsonString(new.LoadShedding))
+	d.Script = scripts(old.Script, new.Script)
+	return d
+}
+
+// jsonString formats v as compact JSON, for values such as pointers whose
+// default formatting does not describe their contents.
+func jsonString(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// scripts returns the steps removed from old and added in new, based on the
+// longest common subsequence of steps.
+func scripts(old, new script.Script) (changes []StepChange) {
+	oldSteps := stepStrings(old)
+	newSteps := stepStrings(new)
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// oldSteps[i:] and newSteps[j:].
+	lcs := make([][]int, len(oldSteps)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newSteps)+1)
+	}
+	for i := len(oldSteps) - 1; i >= 0; i-- {
+		for j := len(newSteps) - 1; j >= 0; j-- {
+			if oldSteps[i] == newSteps[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(oldSteps) || j < len(newSteps) {
+		switch {
+		case i < len(oldSteps) && j < len(newSteps) && oldSteps[i] == newSteps[j]:
+			i++
+			j++
+		case j < len(newSteps) &&
+			(i == len(oldSteps) || lcs[i][j+1] >= lcs[i+1][j]):
+			changes = append(changes, StepChange{j, true, newSteps[j]})
+			j++
+		default:
+			changes = append(changes, StepChange{i, false, oldSteps[i]})
+			i++
+		}
+	}
+	return
+}
+
+func stepStrings(s script.Script) []string {
+	steps := make([]string, 0, len(s))
+	for _, cmd := range s {
+		steps = append(steps, StepString(cmd))
+	}
+	return steps
+}
+
+// StepString formats a script command as a short, human-readable string.
+func StepString(cmd script.Command) string {
+	switch cmd := cmd.(type) {
+	case script.SleepCommand:
+		return fmt.Sprintf("sleep %s", cmd)
+	case script.RequestCommand:
+		return fmt.Sprintf("call %s (%s)", cmd.ServiceName, cmd.Size)
+	case script.ConcurrentCommand:
+		subSteps := make([]string, 0, len(cmd.Commands))
+		for _, subCmd := range cmd.Commands {
+			subSteps = append(subSteps, StepString(subCmd))
+		}
+		policy := ""
+		switch cmd.Policy {
+		case "":
+		case script.Quorum:
+			policy = fmt.Sprintf(" (quorum of %d)", cmd.Quorum)
+		case script.FirstSuccess:
+			if cmd.HedgeDelay > 0 {
+				policy = fmt.Sprintf(" (firstSuccess, hedged after %s)", cmd.HedgeDelay)
+			} else {
+				policy = " (firstSuccess)"
+			}
+		default:
+			policy = fmt.Sprintf(" (%s)", cmd.Policy)
+		}
+		return fmt.Sprintf(
+			"concurrently%s [%s]", policy, strings.Join(subSteps, ", "))
+	default:
+		return fmt.Sprintf("%v", cmd)
+	}
+}
+
+func edges(g graph.ServiceGraph) []Edge {
+	es := make([]Edge, 0, len(g.Services))
+	for _, service := range g.Services {
+		for _, callee := range graph.Callees(service) {
+			es = append(es, Edge{service.Name, callee})
+		}
+	}
+	sort.Slice(es, func(i, j int) bool {
+		if es[i].From == es[j].From {
+			return es[i].To < es[j].To
+		}
+		return es[i].From < es[j].From
+	})
+	return es
+}
+
+func containsEdge(es []Edge, e Edge) bool {
+	i := sort.Search(len(es), func(i int) bool {
+		return es[i].From > e.From ||
+			(es[i].From == e.From && es[i].To >= e.To)
+	})
+	return i < len(es) && es[i] == e
+}
+
+func servicesByName(g graph.ServiceGraph) map[string]svc.Service {
+	services := make(map[string]svc.Service, len(g.Services))
+	for _, service := range g.Services {
+		services[service.Name] = service
+	}
+	return services
+}
+
+func sortedNames(services map[string]svc.Service) []string {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,84 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
+)
+
+func TestServiceGraphs(t *testing.T) {
+	old := graph.ServiceGraph{Services: []svc.Service{
+		{Name: "a", Type: svctype.ServiceHTTP, NumReplicas: 1},
+		{Name: "x", Type: svctype.ServiceHTTP, NumReplicas: 1},
+		{
+			Name:         "b",
+			Type:         svctype.ServiceHTTP,
+			NumReplicas:  1,
+			IsEntrypoint: true,
+			Script: script.Script{
+				script.RequestCommand{ServiceName: "a", Size: 1024},
+				script.SleepCommand(10 * time.Millisecond),
+				script.RequestCommand{ServiceName: "x"},
+			},
+		},
+	}}
+	new := graph.ServiceGraph{Services: []svc.Service{
+		{
+			Name:         "b",
+			Type:         svctype.ServiceHTTP,
+			NumReplicas:  3,
+			IsEntrypoint: true,
+			Script: script.Script{
+				script.RequestCommand{ServiceName: "a", Size: 1024},
+				script.SleepCommand(20 * time.Millisecond),
+				script.RequestCommand{ServiceName: "c"},
+			},
+		},
+		{
+			Name:        "c",
+			Type:        svctype.ServiceGRPC,
+			NumReplicas: 1,
+			Script:      script.Script{script.RequestCommand{ServiceName: "a"}},
+		},
+		{Name: "a", Type: svctype.ServiceHTTP, NumReplicas: 1, ErrorRate: 0.1},
+	}}
+
+	expected := Diff{
+		AddedServices:   []string{"c"},
+		RemovedServices: []string{"x"},
+		ChangedServices: []ServiceDiff{
+			{
+				Name:   "a",
+				Fields: []FieldChange{{"errorRate", "0.00%", "10.00%"}},
+			},
+			{
+				Name:   "b",
+				Fields: []FieldChange{{"numReplicas", "1", "3"}},
+				Script: []StepChange{
+					{1, true, "sleep 20ms"},
+					{2, true, "call c (0B)"},
+					{1, false, "sleep 10ms"},
+					{2, false, "call x (0B)"},
+				},
+			},
+		},
+		AddedEdges:    []Edge{{"b", "c"}, {"c", "a"}},
+		RemovedEdges:  []Edge{{"b", "x"}},
+		Depth:         IntChange{2, 3},
+		Amplification: IntChange{2, 3},
+	}
+
+	actual := ServiceGraphs(old, new)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("\nexpected: %+v\nactual:   %+v", expected, actual)
+	}
+
+	if d := ServiceGraphs(new, new); !d.IsEmpty() {
+		t.Errorf("expected no differences; actual %v", d)
+	}
+}
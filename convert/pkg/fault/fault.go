@@ -0,0 +1,98 @@
+// Package fault describes the faults which may be injected into running mock
+// services through their admin API, and applies them to every pod of a
+// service.
+package fault
+
+import (
+	"fmt"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/pct"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+)
+
+const (
+	// FaultsPath is the admin API endpoint of a mock service's faults. A
+	// Fault is injected by POSTing it as JSON, and every fault is cleared by
+	// a DELETE. "FaultsPath/<type>" clears the fault of one type.
+	FaultsPath = "/faults"
+	// ReadyPath is the admin API endpoint which reports a mock service's
+	// readiness. It fails while an Unready fault is injected.
+	ReadyPath = "/ready"
+)
+
+// Type is a kind of fault. A service has at most one fault of each type.
+type Type string
+
+const (
+	// Latency delays every request by Latency.
+	Latency Type = "latency"
+	// ErrorRate responds to the ErrorRate percentage of requests with a 500.
+	ErrorRate Type = "errorRate"
+	// Status responds to every request with Status.
+	Status Type = "status"
+	// Drop closes the connection of every request without a response.
+	Drop Type = "drop"
+	// Hang holds every request open, without a response, until the fault ends
+	// or the caller gives up.
+	Hang Type = "hang"
+	// Unready fails the service's readiness checks.
+	Unready Type = "unready"
+)
+
+// Types lists every Type.
+var Types = []Type{Latency, ErrorRate, Status, Drop, Hang, Unready}
+
+// Fault is a change to a service's behaviour which lasts for Duration.
+type Fault struct {
+	Type Type `json:"type"`
+
+	// Latency is the delay added by a Latency fault.
+	Latency policy.Duration `json:"latency,omitempty"`
+
+	// ErrorRate is the chance of an error for an ErrorRate fault.
+	ErrorRate pct.Percentage `json:"errorRate,omitempty"`
+
+	// Status is the HTTP status of a Status fault.
+	Status int `json:"status,omitempty"`
+
+	// Duration is how long the fault lasts. If zero, it lasts until cleared.
+	Duration policy.Duration `json:"duration,omitempty"`
+}
+
+// Validate returns nil if f is valid; that is, if it has a known type, sets
+// the parameter of its type and has a non-negative duration.
+func (f Fault) Validate() error {
+	if f.Duration < 0 {
+		return InvalidFaultError{f.Type, "duration must not be negative"}
+	}
+	switch f.Type {
+	case Latency:
+		if f.Latency <= 0 {
+			return InvalidFaultError{f.Type, "latency must be positive"}
+		}
+	case ErrorRate:
+		if f.ErrorRate <= 0 {
+			return InvalidFaultError{f.Type, "errorRate must be positive"}
+		}
+	case Status:
+		if f.Status < 100 || f.Status > 599 {
+			return InvalidFaultError{
+				f.Type, fmt.Sprintf("%d is not a valid HTTP status", f.Status)}
+		}
+	case Drop, Hang, Unready:
+	default:
+		return InvalidFaultError{
+			f.Type, fmt.Sprintf("type must be one of %v", Types)}
+	}
+	return nil
+}
+
+// InvalidFaultError is returned when a Fault is malformed.
+type InvalidFaultError struct {
+	Type   Type
+	Reason string
+}
+
+func (e InvalidFaultError) Error() string {
+	return fmt.Sprintf("invalid %q fault: %s", e.Type, e.Reason)
+}
@@ -0,0 +1,108 @@
+package fault
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+)
+
+func TestFault_Validate(t *testing.T) {
+	tests := []struct {
+		fault Fault
+		err   error
+	}{
+		{Fault{Type: Latency, Latency: policy.Duration(time.Second)}, nil},
+		{Fault{Type: Hang, Duration: policy.Duration(time.Minute)}, nil},
+		{Fault{Type: Latency}, InvalidFaultError{Latency, "latency must be positive"}},
+		{
+			Fault{Type: Status, Status: 99},
+			InvalidFaultError{Status, "99 is not a valid HTTP status"},
+		},
+		{
+			Fault{Type: Unready, Duration: -1},
+			InvalidFaultError{Unready, "duration must not be negative"},
+		},
+		{
+			Fault{Type: "explode"},
+			InvalidFaultError{
+				"explode",
+				"type must be one of [latency errorRate status drop hang unready]"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(string(test.fault.Type), func(t *testing.T) {
+			t.Parallel()
+
+			if err := test.fault.Validate(); test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	defer func(original func([]byte, ...string) ([]byte, error)) {
+		kubectl = original
+	}(kubectl)
+	var calls []string
+	kubectl = func(stdin []byte, args ...string) ([]byte, error) {
+		calls = append(calls, strings.Join(args, " ")+" < "+string(stdin))
+		if args[0] == "get" {
+			return []byte("a-1 a-2"), nil
+		}
+		return nil, nil
+	}
+
+	pods, err := Apply(
+		Target{"service-graph", "a", 8081},
+		Fault{Type: Status, Status: 503})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"a-1", "a-2"}; !reflect.DeepEqual(expected, pods) {
+		t.Errorf("expected %v; actual %v", expected, pods)
+	}
+	expected := []string{
+		"get pods --namespace service-graph --selector name=a " +
+			"--output jsonpath={.items[*].metadata.name} < ",
+		"create --raw /api/v1/namespaces/service-graph/pods/a-1:8081/proxy/faults " +
+			`-f - < {"type":"status","status":503}`,
+		"create --raw /api/v1/namespaces/service-graph/pods/a-2:8081/proxy/faults " +
+			`-f - < {"type":"status","status":503}`,
+	}
+	if !reflect.DeepEqual(expected, calls) {
+		t.Errorf("expected %v; actual %v", expected, calls)
+	}
+}
+
+func TestApply_PodFails(t *testing.T) {
+	defer func(original func([]byte, ...string) ([]byte, error)) {
+		kubectl = original
+	}(kubectl)
+	podErr := errors.New("connection refused")
+	kubectl = func(stdin []byte, args ...string) ([]byte, error) {
+		switch {
+		case args[0] == "get":
+			return []byte("a-1 a-2 a-3"), nil
+		case strings.Contains(args[2], "/a-2:"):
+			return nil, podErr
+		}
+		return nil, nil
+	}
+
+	pods, err := Apply(
+		Target{"service-graph", "a", 8081},
+		Fault{Type: Status, Status: 503})
+	if expected := (PodError{"a-2", podErr}); err != expected {
+		t.Errorf("expected %v; actual %v", expected, err)
+	}
+	if expected := []string{"a-1"}; !reflect.DeepEqual(expected, pods) {
+		t.Errorf("expected %v; actual %v", expected, pods)
+	}
+}
@@ -0,0 +1,117 @@
+package fault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// kubectl runs kubectl with args and stdin, returning its standard output. It
+// is a variable so that tests can replace it.
+var kubectl = func(stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("kubectl", args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf(
+			"kubectl %s: %v: %s",
+			strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// Target identifies the pods of a service and the port of their admin API.
+type Target struct {
+	Namespace string
+	Service   string
+	AdminPort int32
+}
+
+// Apply injects f into every pod of the target. The admin API of each pod is
+// reached through the Kubernetes API server's proxy, using the credentials of
+// the current kubectl context. It returns the names of the pods changed, which
+// are only some of them if it fails part way.
+func Apply(target Target, f Fault) ([]string, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	return forEachPod(target, func(pod string) error {
+		_, err := kubectl(
+			body, "create", "--raw", proxyPath(target, pod, FaultsPath), "-f", "-")
+		return err
+	})
+}
+
+// Clear removes the fault of type t from every pod of the target, or every
+// fault if t is empty. It returns the names of the pods changed, which are only
+// some of them if it fails part way.
+func Clear(target Target, t Type) ([]string, error) {
+	path := FaultsPath
+	if t != "" {
+		path = fmt.Sprintf("%s/%s", FaultsPath, t)
+	}
+	return forEachPod(target, func(pod string) error {
+		_, err := kubectl(nil, "delete", "--raw", proxyPath(target, pod, path))
+		return err
+	})
+}
+
+// forEachPod calls f for each pod of target, stopping at the first error. It
+// returns the pods for which f succeeded.
+func forEachPod(target Target, f func(pod string) error) ([]string, error) {
+	out, err := kubectl(
+		nil, "get", "pods",
+		"--namespace", target.Namespace,
+		"--selector", "name="+target.Service,
+		"--output", "jsonpath={.items[*].metadata.name}")
+	if err != nil {
+		return nil, err
+	}
+	pods := strings.Fields(string(out))
+	if len(pods) == 0 {
+		return nil, NoPodsError{target}
+	}
+	changed := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		if err := f(pod); err != nil {
+			return changed, PodError{pod, err}
+		}
+		changed = append(changed, pod)
+	}
+	return changed, nil
+}
+
+func proxyPath(target Target, pod string, path string) string {
+	return fmt.Sprintf(
+		"/api/v1/namespaces/%s/pods/%s:%d/proxy%s",
+		target.Namespace, pod, target.AdminPort, path)
+}
+
+// NoPodsError is returned when a service has no pods to inject faults into.
+type NoPodsError struct {
+	Target Target
+}
+
+func (e NoPodsError) Error() string {
+	return fmt.Sprintf(
+		`service "%s" has no pods in namespace "%s"`,
+		e.Target.Service, e.Target.Namespace)
+}
+
+// PodError is returned when the admin API of a pod fails.
+type PodError struct {
+	Pod string
+	Err error
+}
+
+func (e PodError) Error() string {
+	return fmt.Sprintf(`pod "%s": %v`, e.Pod, e.Err)
+}
@@ -0,0 +1,172 @@
+package graph
+
+import (
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+)
+
+// Entrypoints returns the names of the services which receive requests from
+// outside of the graph. These are the services with IsEntrypoint set or, if
+// there are none, the services which no other service calls.
+func Entrypoints(g ServiceGraph) []string {
+	names := make([]string, 0, 1)
+	for _, service := range g.Services {
+		if service.IsEntrypoint {
+			names = append(names, service.Name)
+		}
+	}
+	if len(names) > 0 {
+		return names
+	}
+
+	called := map[string]bool{}
+	for _, service := range g.Services {
+		for _, callee := range Callees(service) {
+			called[callee] = true
+		}
+	}
+	for _, service := range g.Services {
+		if !called[service.Name] {
+			names = append(names, service.Name)
+		}
+	}
+	return names
+}
+
+// Callees returns the names of the services service calls, in order of first
+// appearance in its script.
+func Callees(service svc.Service) []string {
+	seen := map[string]bool{}
+	names := make([]string, 0, len(service.Script))
+	var walk func(cmds []script.Command)
+	walk = func(cmds []script.Command) {
+		for _, cmd := range cmds {
+			switch cmd := cmd.(type) {
+			case script.RequestCommand:
+				if !seen[cmd.ServiceName] {
+					seen[cmd.ServiceName] = true
+					names = append(names, cmd.ServiceName)
+				}
+			case script.ConcurrentCommand:
+				walk(cmd.Commands)
+			}
+		}
+	}
+	walk(service.Script)
+	return names
+}
+
+// Depth returns the number of services on the longest call chain starting at
+// an entrypoint. A graph whose entrypoints make no calls has a depth of 1.
+// Calls which would complete a cycle are not followed. The result of each
+// service is computed only once unless a cycle is reached from it, as it then
+// depends on the chain the service was reached by.
+func Depth(g ServiceGraph) int {
+	services := servicesByName(g)
+	visiting := map[string]bool{}
+	depths := make(map[string]int, len(services))
+	// depthOf also returns whether a call which would complete a cycle was
+	// not followed.
+	var depthOf func(name string) (int, bool)
+	depthOf = func(name string) (int, bool) {
+		if d, ok := depths[name]; ok {
+			return d, false
+		}
+		service, ok := services[name]
+		if !ok {
+			return 0, false
+		}
+		if visiting[name] {
+			return 0, true
+		}
+		visiting[name] = true
+		deepest, cyclic := 0, false
+		for _, callee := range Callees(service) {
+			d, calleeCyclic := depthOf(callee)
+			if d > deepest {
+				deepest = d
+			}
+			cyclic = cyclic || calleeCyclic
+		}
+		delete(visiting, name)
+		if !cyclic {
+			depths[name] = 1 + deepest
+		}
+		return 1 + deepest, cyclic
+	}
+
+	depth := 0
+	for _, name := range Entrypoints(g) {
+		if d, _ := depthOf(name); d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
+
+// Amplification returns the largest number of requests sent between services
+// as a result of a single request to one entrypoint, assuming every call
+// succeeds. Calls which would complete a cycle are not followed. The result
+// of each service is computed only once unless a cycle is reached from it, as
+// it then depends on the chain the service was reached by.
+func Amplification(g ServiceGraph) int {
+	services := servicesByName(g)
+	visiting := map[string]bool{}
+	counts := make(map[string]int, len(services))
+	// requestsFrom and requestsIn also return whether a call which would
+	// complete a cycle was not followed.
+	var requestsFrom func(name string) (int, bool)
+	var requestsIn func(cmds []script.Command) (int, bool)
+	requestsIn = func(cmds []script.Command) (n int, cyclic bool) {
+		for _, cmd := range cmds {
+			var m int
+			var cmdCyclic bool
+			switch cmd := cmd.(type) {
+			case script.RequestCommand:
+				if visiting[cmd.ServiceName] {
+					cyclic = true
+					continue
+				}
+				m, cmdCyclic = requestsFrom(cmd.ServiceName)
+				m++
+			case script.ConcurrentCommand:
+				m, cmdCyclic = requestsIn(cmd.Commands)
+			}
+			n += m
+			cyclic = cyclic || cmdCyclic
+		}
+		return
+	}
+	requestsFrom = func(name string) (int, bool) {
+		if n, ok := counts[name]; ok {
+			return n, false
+		}
+		service, ok := services[name]
+		if !ok {
+			return 0, false
+		}
+		visiting[name] = true
+		n, cyclic := requestsIn(service.Script)
+		delete(visiting, name)
+		if !cyclic {
+			counts[name] = n
+		}
+		return n, cyclic
+	}
+
+	amplification := 0
+	for _, name := range Entrypoints(g) {
+		if n, _ := requestsFrom(name); n > amplification {
+			amplification = n
+		}
+	}
+	return amplification
+}
+
+func servicesByName(g ServiceGraph) map[string]svc.Service {
+	services := make(map[string]svc.Service, len(g.Services))
+	for _, service := range g.Services {
+		services[service.Name] = service
+	}
+	return services
+}
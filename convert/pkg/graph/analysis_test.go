@@ -0,0 +1,79 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+)
+
+// cyclicGraph returns a graph in which the entrypoint e calls each of callees
+// in order, a and b call each other and a also calls c, which calls d.
+func cyclicGraph(callees ...string) ServiceGraph {
+	return ServiceGraph{[]svc.Service{
+		{Name: "e", IsEntrypoint: true, Script: requests(callees...)},
+		{Name: "a", Script: requests("b", "c")},
+		{Name: "b", Script: requests("a")},
+		{Name: "c", Script: requests("d")},
+		{Name: "d"},
+	}}
+}
+
+// requests returns a script which calls each of names in turn.
+func requests(names ...string) script.Script {
+	s := make(script.Script, 0, len(names))
+	for _, name := range names {
+		s = append(s, script.RequestCommand{ServiceName: name})
+	}
+	return s
+}
+
+func TestAnalysis(t *testing.T) {
+	tests := []struct {
+		graph         ServiceGraph
+		entrypoints   []string
+		depth         int
+		amplification int
+	}{
+		{graphWithOneService, []string{"a"}, 1, 0},
+		// c calls a and b; b calls a.
+		{graphWithDefaultsAndManyServices, []string{"c"}, 3, 3},
+		{
+			ServiceGraph{[]svc.Service{
+				{Name: "a", Script: script.Script{script.RequestCommand{ServiceName: "b"}}},
+				{Name: "b", Script: script.Script{script.RequestCommand{ServiceName: "a"}}},
+				{Name: "c", IsEntrypoint: true, Script: script.Script{
+					script.RequestCommand{ServiceName: "a"},
+					script.RequestCommand{ServiceName: "a"},
+				}},
+			}},
+			[]string{"c"},
+			3,
+			4,
+		},
+		// The longest chain is e, b, a, c, d whichever e calls first.
+		{cyclicGraph("a", "b"), []string{"e"}, 5, 8},
+		{cyclicGraph("b", "a"), []string{"e"}, 5, 8},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			if entrypoints := Entrypoints(test.graph); !reflect.DeepEqual(
+				test.entrypoints, entrypoints) {
+				t.Errorf("expected %v; actual %v", test.entrypoints, entrypoints)
+			}
+			if depth := Depth(test.graph); test.depth != depth {
+				t.Errorf("expected %v; actual %v", test.depth, depth)
+			}
+			if amplification := Amplification(test.graph); test.amplification !=
+				amplification {
+				t.Errorf(
+					"expected %v; actual %v", test.amplification, amplification)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/k8s"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/pct"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/size"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
+)
+
+// Defaults holds the settings given to every service which does not set its
+// own. It is the "defaults" object of a service graph document.
+type Defaults struct {
+	Type         svctype.ServiceType `json:"type,omitempty"`
+	NumReplicas  int32               `json:"numReplicas,omitempty"`
+	ErrorRate    pct.Percentage      `json:"errorRate,omitempty"`
+	ResponseSize size.ByteSize       `json:"responseSize,omitempty"`
+	Script       script.Script       `json:"script,omitempty"`
+	// RequestSize is the size of each call which does not specify one.
+	RequestSize size.ByteSize  `json:"requestSize,omitempty"`
+	Kubernetes  *k8s.Settings  `json:"kubernetes,omitempty"`
+	Policy      *policy.Policy `json:"policy,omitempty"`
+
+	MaxConcurrency int          `json:"maxConcurrency,omitempty"`
+	QueueSize      int          `json:"queueSize,omitempty"`
+	Overflow       svc.Overflow `json:"overflow,omitempty"`
+
+	RateLimit    *svc.RateLimit    `json:"rateLimit,omitempty"`
+	LoadShedding *svc.LoadShedding `json:"loadShedding,omitempty"`
+}
+
+// BuiltinDefaults returns the defaults used by a Decoder which has none: HTTP
+// services with one replica.
+func BuiltinDefaults() Defaults {
+	return Defaults{
+		Type:        svctype.ServiceHTTP,
+		NumReplicas: 1,
+	}
+}
+
+// defaultsKeys are the JSON keys that a layer of defaults may set.
+var defaultsKeys = []string{
+	"type", "numReplicas", "errorRate", "responseSize", "script", "requestSize",
+	"kubernetes", "policy", "maxConcurrency", "queueSize", "overflow",
+	"rateLimit", "loadShedding"}
+
+// nestedKeys are the JSON keys whose objects are merged key by key, rather
+// than replaced, by later layers. For example, a group may set Kubernetes
+// resources while a service it selects sets only tolerations.
+var nestedKeys = map[string]bool{"kubernetes": true, "policy": true}
+
+// Decoder decodes service graph documents. Settings are resolved for each
+// service in layers, each overriding the last:
+//
+//  1. the Decoder's Defaults
+//  2. the document's "defaults"
+//  3. the "defaults" of each of the document's "groups" which selects the
+//     service, in the order the groups are declared
+//  4. the service's own settings
+//
+// A group selects a service if every key and value in its "selector" is one of
+// the service's "labels". A group with no selector selects every service.
+//
+// A Decoder holds no global state, so documents may be decoded concurrently.
+// The zero value is ready to use.
+type Decoder struct {
+	// Defaults is the lowest layer of defaults. If nil, BuiltinDefaults() is
+	// used.
+	Defaults *Defaults
+}
+
+// Decode converts b into a valid ServiceGraph. See Validate() for the details
+// on what it means to be "valid". Documents of an older apiVersion are
+// migrated to APIVersion first.
+func (d Decoder) Decode(b []byte) (g ServiceGraph, err error) {
+	b, err = migrateJSONServiceGraph(b)
+	if err != nil {
+		return
+	}
+
+	var doc serviceGraphJSONDocument
+	err = json.Unmarshal(b, &doc)
+	if err != nil {
+		return
+	}
+
+	baseDefaults, err := d.baseDefaultsLayer()
+	if err != nil {
+		return
+	}
+	docDefaults, err := parseDefaultsLayer(doc.Defaults)
+	if err != nil {
+		return
+	}
+	groups, err := parseGroups(doc.Groups)
+	if err != nil {
+		return
+	}
+
+	g.Services = make([]svc.Service, 0, len(doc.Services))
+	for _, rawService := range doc.Services {
+		var serviceLayer jsonObject
+		err = json.Unmarshal(rawService, &serviceLayer)
+		if err != nil {
+			return ServiceGraph{}, err
+		}
+		// requestSize is only meaningful as a default.
+		delete(serviceLayer, "requestSize")
+
+		var labels map[string]string
+		if rawLabels, ok := serviceLayer["labels"]; ok {
+			err = json.Unmarshal(rawLabels, &labels)
+			if err != nil {
+				return ServiceGraph{}, err
+			}
+		}
+
+		layers := []jsonObject{baseDefaults, docDefaults}
+		for _, group := range groups {
+			if group.selects(labels) {
+				layers = append(layers, group.defaults)
+			}
+		}
+		layers = append(layers, serviceLayer)
+
+		merged, err := mergeLayers(layers...)
+		if err != nil {
+			return ServiceGraph{}, err
+		}
+		service, err := decodeService(merged)
+		if err != nil {
+			return ServiceGraph{}, err
+		}
+		g.Services = append(g.Services, service)
+	}
+
+	err = Validate(g)
+	if err != nil {
+		return ServiceGraph{}, err
+	}
+	return
+}
+
+func (d Decoder) baseDefaultsLayer() (jsonObject, error) {
+	defaults := BuiltinDefaults()
+	if d.Defaults != nil {
+		defaults = *d.Defaults
+	}
+	b, err := json.Marshal(defaults)
+	if err != nil {
+		return nil, err
+	}
+	var layer jsonObject
+	err = json.Unmarshal(b, &layer)
+	return layer, err
+}
+
+// parseDefaultsLayer checks that b is a valid Defaults object and returns the
+// keys that it sets.
+func parseDefaultsLayer(b json.RawMessage) (jsonObject, error) {
+	if len(b) == 0 {
+		return nil, nil
+	}
+	var defaults Defaults
+	err := json.Unmarshal(b, &defaults)
+	if err != nil {
+		return nil, err
+	}
+	var object jsonObject
+	err = json.Unmarshal(b, &object)
+	if err != nil {
+		return nil, err
+	}
+	layer := make(jsonObject, len(defaultsKeys))
+	for _, key := range defaultsKeys {
+		if value, ok := object[key]; ok {
+			layer[key] = value
+		}
+	}
+	return layer, nil
+}
+
+// group applies a layer of defaults to the services it selects.
+type group struct {
+	name     string
+	selector map[string]string
+	defaults jsonObject
+}
+
+// selects returns true if every key and value in g's selector is in labels.
+func (g group) selects(labels map[string]string) bool {
+	for key, value := range g.selector {
+		if labelValue, ok := labels[key]; !ok || labelValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+func parseGroups(groupsJSON []groupJSON) ([]group, error) {
+	groups := make([]group, 0, len(groupsJSON))
+	names := make(map[string]bool, len(groupsJSON))
+	for _, g := range groupsJSON {
+		if g.Name == "" {
+			return nil, ErrEmptyGroupName
+		}
+		if names[g.Name] {
+			return nil, ErrDuplicateGroup{g.Name}
+		}
+		names[g.Name] = true
+		defaults, err := parseDefaultsLayer(g.Defaults)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group{g.Name, g.Selector, defaults})
+	}
+	return groups, nil
+}
+
+// decodeService converts the merged layers of settings for a service into a
+// svc.Service. Calls in its script which omit a size are given the resolved
+// requestSize.
+func decodeService(merged jsonObject) (service svc.Service, err error) {
+	var decoder script.Decoder
+	if rawSize, ok := merged["requestSize"]; ok {
+		err = json.Unmarshal(rawSize, &decoder.RequestSize)
+		if err != nil {
+			return
+		}
+		delete(merged, "requestSize")
+	}
+	rawScript, hasScript := merged["script"]
+	delete(merged, "script")
+
+	b, err := json.Marshal(merged)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, &service)
+	if err != nil {
+		return
+	}
+
+	if hasScript && string(rawScript) != "null" {
+		service.Script, err = decoder.DecodeScript(rawScript)
+	}
+	return
+}
+
+// jsonObject is a JSON object whose values are yet to be decoded.
+type jsonObject map[string]json.RawMessage
+
+// mergeLayers returns the union of layers. Later layers take precedence. The
+// objects of nestedKeys are merged in the same way.
+func mergeLayers(layers ...jsonObject) (jsonObject, error) {
+	merged := jsonObject{}
+	for _, layer := range layers {
+		for key, value := range layer {
+			previous, ok := merged[key]
+			if !ok || !nestedKeys[key] {
+				merged[key] = value
+				continue
+			}
+			var previousObject, object jsonObject
+			if err := json.Unmarshal(previous, &previousObject); err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(value, &object); err != nil {
+				return nil, err
+			}
+			nestedMerged, err := mergeLayers(previousObject, object)
+			if err != nil {
+				return nil, err
+			}
+			merged[key], err = json.Marshal(nestedMerged)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return merged, nil
+}
+
+type serviceGraphJSONDocument struct {
+	Defaults json.RawMessage   `json:"defaults"`
+	Groups   []groupJSON       `json:"groups"`
+	Services []json.RawMessage `json:"services"`
+}
+
+type groupJSON struct {
+	Name     string            `json:"name"`
+	Selector map[string]string `json:"selector"`
+	Defaults json.RawMessage   `json:"defaults"`
+}
+
+type serviceGraphJSONHeader struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+}
+
+// migrateJSONServiceGraph checks the apiVersion and kind of b and upgrades it
+// to APIVersion if necessary.
+func migrateJSONServiceGraph(b []byte) ([]byte, error) {
+	header := serviceGraphJSONHeader{APIVersion: APIVersion, Kind: Kind}
+	err := json.Unmarshal(b, &header)
+	if err != nil {
+		return nil, err
+	}
+	if header.Kind != Kind {
+		return nil, InvalidKindError{header.Kind}
+	}
+	return migrate(b, header.APIVersion, APIVersion, migrations)
+}
+
+// ErrEmptyGroupName is returned when a group in a service graph has no name.
+var ErrEmptyGroupName = errors.New("groups must have a name")
+
+// ErrDuplicateGroup is returned when more than one group has the same name.
+type ErrDuplicateGroup struct {
+	GroupName string
+}
+
+func (e ErrDuplicateGroup) Error() string {
+	return fmt.Sprintf(`group "%s" is defined more than once`, e.GroupName)
+}
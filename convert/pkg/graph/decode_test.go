@@ -0,0 +1,454 @@
+package graph
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/k8s"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
+)
+
+func TestDecoder_Decode(t *testing.T) {
+	tests := []struct {
+		name    string
+		decoder Decoder
+		input   string
+		graph   ServiceGraph
+	}{
+		{
+			"builtin defaults",
+			Decoder{},
+			`{"services": [{"name": "a"}]}`,
+			graphWithOneService,
+		},
+		{
+			"decoder defaults",
+			Decoder{&Defaults{Type: svctype.ServiceGRPC, NumReplicas: 3}},
+			`{"services": [{"name": "a"}]}`,
+			ServiceGraph{[]svc.Service{
+				{Name: "a", Type: svctype.ServiceGRPC, NumReplicas: 3},
+			}},
+		},
+		{
+			"document defaults override decoder defaults",
+			Decoder{&Defaults{Type: svctype.ServiceGRPC, NumReplicas: 3}},
+			`{"defaults": {"numReplicas": 2}, "services": [{"name": "a"}]}`,
+			ServiceGraph{[]svc.Service{
+				{Name: "a", Type: svctype.ServiceGRPC, NumReplicas: 2},
+			}},
+		},
+		{
+			"service overrides defaults",
+			Decoder{&Defaults{NumReplicas: 3}},
+			`{
+				"defaults": {"numReplicas": 2},
+				"services": [{"name": "a", "numReplicas": 1}]
+			}`,
+			ServiceGraph{[]svc.Service{
+				{Name: "a", Type: svctype.ServiceHTTP, NumReplicas: 1},
+			}},
+		},
+		{
+			"request size applies to default script",
+			Decoder{&Defaults{RequestSize: 64}},
+			`{
+				"defaults": {"script": [{"call": "b"}]},
+				"services": [{"name": "a"}, {"name": "b", "script": []}]
+			}`,
+			ServiceGraph{[]svc.Service{
+				{
+					Name:        "a",
+					Type:        svctype.ServiceHTTP,
+					NumReplicas: 1,
+					Script: script.Script{
+						script.RequestCommand{ServiceName: "b", Size: 64},
+					},
+				},
+				{
+					Name:        "b",
+					Type:        svctype.ServiceHTTP,
+					NumReplicas: 1,
+					Script:      script.Script{},
+				},
+			}},
+		},
+		{
+			"groups select services by label",
+			Decoder{},
+			`{
+				"defaults": {"numReplicas": 2},
+				"groups": [
+					{"name": "all", "defaults": {"responseSize": 10}},
+					{
+						"name": "frontend",
+						"selector": {"tier": "frontend"},
+						"defaults": {"type": "grpc", "numReplicas": 3}
+					},
+					{
+						"name": "frontend-eu",
+						"selector": {"tier": "frontend", "region": "eu"},
+						"defaults": {"numReplicas": 4}
+					}
+				],
+				"services": [
+					{"name": "a", "labels": {"tier": "frontend"}},
+					{"name": "b", "labels": {"tier": "frontend", "region": "eu"}},
+					{"name": "c", "labels": {"tier": "data"}},
+					{
+						"name": "d",
+						"labels": {"tier": "frontend"},
+						"numReplicas": 1
+					}
+				]
+			}`,
+			ServiceGraph{[]svc.Service{
+				{
+					Name:         "a",
+					Labels:       map[string]string{"tier": "frontend"},
+					Type:         svctype.ServiceGRPC,
+					NumReplicas:  3,
+					ResponseSize: 10,
+				},
+				{
+					Name: "b",
+					Labels: map[string]string{
+						"tier": "frontend", "region": "eu"},
+					Type:         svctype.ServiceGRPC,
+					NumReplicas:  4,
+					ResponseSize: 10,
+				},
+				{
+					Name:         "c",
+					Labels:       map[string]string{"tier": "data"},
+					Type:         svctype.ServiceHTTP,
+					NumReplicas:  2,
+					ResponseSize: 10,
+				},
+				{
+					Name:         "d",
+					Labels:       map[string]string{"tier": "frontend"},
+					Type:         svctype.ServiceGRPC,
+					NumReplicas:  1,
+					ResponseSize: 10,
+				},
+			}},
+		},
+		{
+			"group request size applies to default script",
+			Decoder{},
+			`{
+				"defaults": {"script": [{"call": "b"}], "requestSize": 1},
+				"groups": [{
+					"name": "big",
+					"selector": {"size": "big"},
+					"defaults": {"requestSize": 100}
+				}],
+				"services": [
+					{"name": "a", "labels": {"size": "big"}},
+					{"name": "b", "script": []}
+				]
+			}`,
+			ServiceGraph{[]svc.Service{
+				{
+					Name:        "a",
+					Labels:      map[string]string{"size": "big"},
+					Type:        svctype.ServiceHTTP,
+					NumReplicas: 1,
+					Script: script.Script{
+						script.RequestCommand{ServiceName: "b", Size: 100},
+					},
+				},
+				{
+					Name:        "b",
+					Type:        svctype.ServiceHTTP,
+					NumReplicas: 1,
+					Script:      script.Script{},
+				},
+			}},
+		},
+		{
+			"kubernetes settings are merged by key",
+			Decoder{},
+			`{
+				"defaults": {"kubernetes": {"priorityClassName": "low"}},
+				"groups": [{
+					"name": "critical",
+					"defaults": {"kubernetes": {"priorityClassName": "high"}}
+				}],
+				"services": [{
+					"name": "a",
+					"kubernetes": {"nodeSelector": {"pool": "a"}}
+				}]
+			}`,
+			ServiceGraph{[]svc.Service{
+				{
+					Name:        "a",
+					Type:        svctype.ServiceHTTP,
+					NumReplicas: 1,
+					Kubernetes: &k8s.Settings{
+						NodeSelector:      map[string]string{"pool": "a"},
+						PriorityClassName: "high",
+					},
+				},
+			}},
+		},
+		{
+			"policies are merged by key",
+			Decoder{},
+			`{
+				"defaults": {"policy": {"timeout": "1s", "mtls": "STRICT"}},
+				"services": [
+					{
+						"name": "a",
+						"script": [{"call": "b"}],
+						"edgePolicies": {"b": {"timeout": "3s"}}
+					},
+					{"name": "b", "policy": {"loadBalancer": "RANDOM"}}
+				]
+			}`,
+			ServiceGraph{[]svc.Service{
+				{
+					Name:        "a",
+					Type:        svctype.ServiceHTTP,
+					NumReplicas: 1,
+					Script: script.Script{
+						script.RequestCommand{ServiceName: "b"},
+					},
+					Policy: &policy.Policy{
+						Route: policy.Route{Timeout: policy.Duration(time.Second)},
+						MTLS:  policy.MTLSStrict,
+					},
+					EdgePolicies: map[string]policy.Route{
+						"b": {Timeout: policy.Duration(3 * time.Second)},
+					},
+				},
+				{
+					Name:        "b",
+					Type:        svctype.ServiceHTTP,
+					NumReplicas: 1,
+					Policy: &policy.Policy{
+						Route:        policy.Route{Timeout: policy.Duration(time.Second)},
+						LoadBalancer: policy.Random,
+						MTLS:         policy.MTLSStrict,
+					},
+				},
+			}},
+		},
+		{
+			"concurrency limits are defaults",
+			Decoder{},
+			`{
+				"defaults": {"maxConcurrency": 8, "queueSize": 16},
+				"groups": [{
+					"name": "patient",
+					"selector": {"tier": "backend"},
+					"defaults": {"overflow": "wait"}
+				}],
+				"services": [
+					{"name": "a"},
+					{"name": "b", "labels": {"tier": "backend"}, "queueSize": 0}
+				]
+			}`,
+			ServiceGraph{[]svc.Service{
+				{
+					Name:           "a",
+					Type:           svctype.ServiceHTTP,
+					NumReplicas:    1,
+					MaxConcurrency: 8,
+					QueueSize:      16,
+				},
+				{
+					Name:           "b",
+					Labels:         map[string]string{"tier": "backend"},
+					Type:           svctype.ServiceHTTP,
+					NumReplicas:    1,
+					MaxConcurrency: 8,
+					Overflow:       svc.OverflowWait,
+				},
+			}},
+		},
+		{
+			"rate limits and load shedding are replaced whole",
+			Decoder{},
+			`{
+				"defaults": {
+					"rateLimit": {"requestsPerSecond": 100, "burst": 10},
+					"loadShedding": {"latencyTarget": "50ms", "minPriority": 2}
+				},
+				"services": [
+					{"name": "a"},
+					{"name": "b", "rateLimit": {"requestsPerSecond": 5, "perCaller": true}}
+				]
+			}`,
+			ServiceGraph{[]svc.Service{
+				{
+					Name:        "a",
+					Type:        svctype.ServiceHTTP,
+					NumReplicas: 1,
+					RateLimit:   &svc.RateLimit{RequestsPerSecond: 100, Burst: 10},
+					LoadShedding: &svc.LoadShedding{
+						LatencyTarget: policy.Duration(50 * time.Millisecond),
+						MinPriority:   2,
+					},
+				},
+				{
+					Name:        "b",
+					Type:        svctype.ServiceHTTP,
+					NumReplicas: 1,
+					RateLimit:   &svc.RateLimit{RequestsPerSecond: 5, PerCaller: true},
+					LoadShedding: &svc.LoadShedding{
+						LatencyTarget: policy.Duration(50 * time.Millisecond),
+						MinPriority:   2,
+					},
+				},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			graph, err := test.decoder.Decode([]byte(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(test.graph, graph) {
+				t.Errorf("expected %v; actual %v", test.graph, graph)
+			}
+		})
+	}
+}
+
+func TestDecoder_Decode_Error(t *testing.T) {
+	tests := []struct {
+		input string
+		err   error
+	}{
+		{
+			`{"groups": [{"selector": {"a": "b"}}], "services": []}`,
+			ErrEmptyGroupName,
+		},
+		{
+			`{"groups": [{"name": "g"}, {"name": "g"}], "services": []}`,
+			ErrDuplicateGroup{"g"},
+		},
+		{
+			`{"services": [{"name": "a", "labels": {"tier": "front end"}}]}`,
+			ErrInvalidLabel{
+				"a", "tier",
+				"a valid label must be an empty string or consist of alphanumeric " +
+					"characters, '-', '_' or '.', and must start and end with an " +
+					"alphanumeric character (e.g. 'MyValue',  or 'my_value',  or " +
+					"'12345', regex used for validation is " +
+					"'(([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9])?')",
+			},
+		},
+		{
+			`{"services": [{
+				"name": "a",
+				"kubernetes": {"topologySpreadConstraints": [{
+					"maxSkew": 0,
+					"topologyKey": "zone",
+					"whenUnsatisfiable": "DoNotSchedule"
+				}]}
+			}]}`,
+			ErrInvalidKubernetesSettings{
+				"a",
+				k8s.InvalidTopologySpreadConstraintError{
+					Constraint: k8s.TopologySpreadConstraint{
+						TopologyKey:       "zone",
+						WhenUnsatisfiable: k8s.DoNotSchedule,
+					},
+					Reason: "maxSkew must be positive",
+				},
+			},
+		},
+		{
+			`{"services": [{"name": "a", "policy": {"mtls": "OPTIONAL"}}]}`,
+			ErrInvalidPolicy{
+				"a",
+				policy.InvalidPolicyError{
+					Field:  "mtls",
+					Reason: "must be one of STRICT, PERMISSIVE or DISABLE",
+				},
+			},
+		},
+		{
+			`{"services": [
+				{"name": "a", "edgePolicies": {"b": {"timeout": "1s"}}},
+				{"name": "b"}
+			]}`,
+			ErrEdgePolicyWithoutCall{"a", "b"},
+		},
+		{
+			`{"services": [{"name": "a", "maxConcurrency": -1}]}`,
+			ErrInvalidConcurrency{"a", "maxConcurrency must not be negative"},
+		},
+		{
+			`{"services": [{"name": "a", "queueSize": 4}]}`,
+			ErrInvalidConcurrency{
+				"a", "queueSize and overflow require maxConcurrency"},
+		},
+		{
+			`{"services": [{"name": "a", "maxConcurrency": 1, "overflow": "drop"}]}`,
+			ErrInvalidConcurrency{"a", `overflow must be "reject" or "wait"`},
+		},
+		{
+			`{"services": [{"name": "a", "rateLimit": {"requestsPerSecond": 0}}]}`,
+			ErrInvalidRateLimit{"a", "requestsPerSecond must be positive"},
+		},
+		{
+			`{"services": [{"name": "a", "loadShedding": {"minPriority": 1}}]}`,
+			ErrInvalidLoadShedding{"a", "latencyTarget must be positive"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.input, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Decoder{}.Decode([]byte(test.input))
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestDecoder_Decode_Concurrent(t *testing.T) {
+	inputs := []struct {
+		input   string
+		decoder Decoder
+		size    int
+	}{
+		{`{"defaults": {"requestSize": 1}, "services": [{"name": "a", "script": [{"call": "a"}]}]}`, Decoder{}, 1},
+		{`{"services": [{"name": "a", "script": [{"call": "a"}]}]}`, Decoder{&Defaults{RequestSize: 2}}, 2},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		input := inputs[i%len(inputs)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			graph, err := input.decoder.Decode([]byte(input.input))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			request := graph.Services[0].Script[0].(script.RequestCommand)
+			if int(request.Size) != input.size {
+				t.Errorf("expected size %d; actual %d", input.size, request.Size)
+			}
+		}()
+	}
+	wg.Wait()
+}
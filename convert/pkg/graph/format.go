@@ -0,0 +1,20 @@
+package graph
+
+import (
+	"sort"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+)
+
+// Canonical returns a copy of g with its services sorted by name. Marshalling
+// the result produces the canonical form of g: every default is expanded,
+// every call is written in its long form, and every size and percentage is
+// normalized.
+func Canonical(g ServiceGraph) ServiceGraph {
+	services := make([]svc.Service, len(g.Services))
+	copy(services, g.Services)
+	sort.SliceStable(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+	return ServiceGraph{Services: services}
+}
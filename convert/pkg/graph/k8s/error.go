@@ -0,0 +1,16 @@
+package k8s
+
+import "fmt"
+
+// InvalidTopologySpreadConstraintError is returned when a
+// TopologySpreadConstraint is malformed.
+type InvalidTopologySpreadConstraintError struct {
+	Constraint TopologySpreadConstraint
+	Reason     string
+}
+
+func (e InvalidTopologySpreadConstraintError) Error() string {
+	return fmt.Sprintf(
+		"invalid topology spread constraint on %q: %s",
+		e.Constraint.TopologyKey, e.Reason)
+}
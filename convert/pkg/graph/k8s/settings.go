@@ -0,0 +1,87 @@
+// Package k8s describes how a service is deployed to Kubernetes.
+package k8s
+
+import (
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Settings describes how a service's Deployment is scheduled and sized.
+type Settings struct {
+	// Resources are the CPU and memory requests and limits of the service's
+	// container.
+	Resources *apiv1.ResourceRequirements `json:"resources,omitempty"`
+
+	// SidecarResources are the CPU and memory requests and limits of the
+	// service mesh's proxy, set through the mesh's pod annotations.
+	SidecarResources *apiv1.ResourceRequirements `json:"sidecarResources,omitempty"`
+
+	// NodeSelector is merged with, and overrides, the node selector given to
+	// every service.
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations allow the service's pods onto nodes with matching taints.
+	Tolerations []apiv1.Toleration `json:"tolerations,omitempty"`
+
+	// Affinity constrains which nodes the service's pods are scheduled on
+	// relative to labels on nodes and other pods.
+	Affinity *apiv1.Affinity `json:"affinity,omitempty"`
+
+	// TopologySpreadConstraints control how the service's pods are spread
+	// across topology domains such as zones.
+	TopologySpreadConstraints []TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+	// PriorityClassName is the name of the PriorityClass of the service's pods.
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+}
+
+// TopologySpreadConstraint mirrors the Kubernetes type of the same name, which
+// is newer than the vendored Kubernetes API.
+type TopologySpreadConstraint struct {
+	// MaxSkew is the greatest permitted difference between the number of
+	// matching pods in any two topology domains.
+	MaxSkew int32 `json:"maxSkew"`
+
+	// TopologyKey is the node label whose values define topology domains.
+	TopologyKey string `json:"topologyKey"`
+
+	// WhenUnsatisfiable is either DoNotSchedule or ScheduleAnyway.
+	WhenUnsatisfiable UnsatisfiableConstraintAction `json:"whenUnsatisfiable"`
+
+	// LabelSelector selects the pods to count. If nil, the service's own pods
+	// are selected.
+	LabelSelector *metav1.LabelSelector `json:"labelSelector,omitempty"`
+}
+
+// UnsatisfiableConstraintAction is the action taken by the scheduler when a
+// TopologySpreadConstraint cannot be satisfied.
+type UnsatisfiableConstraintAction string
+
+const (
+	// DoNotSchedule leaves the pod unscheduled.
+	DoNotSchedule UnsatisfiableConstraintAction = "DoNotSchedule"
+	// ScheduleAnyway schedules the pod, preferring nodes that reduce the skew.
+	ScheduleAnyway UnsatisfiableConstraintAction = "ScheduleAnyway"
+)
+
+// Validate returns nil if s is valid; that is, if each of its topology spread
+// constraints has a positive maxSkew, a topologyKey and a known
+// whenUnsatisfiable action.
+func (s Settings) Validate() error {
+	for _, c := range s.TopologySpreadConstraints {
+		if c.MaxSkew < 1 {
+			return InvalidTopologySpreadConstraintError{
+				c, "maxSkew must be positive"}
+		}
+		if c.TopologyKey == "" {
+			return InvalidTopologySpreadConstraintError{
+				c, "topologyKey must be set"}
+		}
+		if c.WhenUnsatisfiable != DoNotSchedule &&
+			c.WhenUnsatisfiable != ScheduleAnyway {
+			return InvalidTopologySpreadConstraintError{
+				c, "whenUnsatisfiable must be DoNotSchedule or ScheduleAnyway"}
+		}
+	}
+	return nil
+}
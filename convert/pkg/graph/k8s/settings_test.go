@@ -0,0 +1,48 @@
+package k8s
+
+import "testing"
+
+func TestSettings_Validate(t *testing.T) {
+	valid := TopologySpreadConstraint{
+		MaxSkew:           1,
+		TopologyKey:       "zone",
+		WhenUnsatisfiable: ScheduleAnyway,
+	}
+	noKey := valid
+	noKey.TopologyKey = ""
+	unknownAction := valid
+	unknownAction.WhenUnsatisfiable = "Never"
+
+	tests := []struct {
+		constraint TopologySpreadConstraint
+		err        error
+	}{
+		{valid, nil},
+		{
+			noKey,
+			InvalidTopologySpreadConstraintError{noKey, "topologyKey must be set"},
+		},
+		{
+			unknownAction,
+			InvalidTopologySpreadConstraintError{
+				unknownAction,
+				"whenUnsatisfiable must be DoNotSchedule or ScheduleAnyway"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			settings := Settings{
+				TopologySpreadConstraints: []TopologySpreadConstraint{
+					test.constraint},
+			}
+			err := settings.Validate()
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+		})
+	}
+}
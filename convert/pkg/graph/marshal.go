@@ -0,0 +1,23 @@
+package graph
+
+import (
+	"encoding/json"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+)
+
+// MarshalJSON encodes g as a JSON object tagged with the current APIVersion
+// and Kind.
+func (g ServiceGraph) MarshalJSON() ([]byte, error) {
+	return json.Marshal(versionedServiceGraph{
+		APIVersion: APIVersion,
+		Kind:       Kind,
+		Services:   g.Services,
+	})
+}
+
+type versionedServiceGraph struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Services   []svc.Service `json:"services"`
+}
@@ -0,0 +1,36 @@
+package graph
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestServiceGraph_MarshalJSON(t *testing.T) {
+	b, err := json.Marshal(Canonical(graphWithDefaultsAndManyServices))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"apiVersion":"v1alpha1","kind":"MockServiceGraph","services":[` +
+		`{"name":"a","type":"http","numReplicas":5,"errorRate":0.1,` +
+		`"responseSize":"128B","script":[{"sleep":"100ms"}]},` +
+		`{"name":"b","type":"http","numReplicas":2,"errorRate":0.1,` +
+		`"responseSize":"128B","script":[` +
+		`{"call":{"service":"a","size":"1KiB"}},{"sleep":"10ms"}]},` +
+		`{"name":"c","type":"grpc","numReplicas":1,"errorRate":0.2,` +
+		`"responseSize":"1KiB","script":[` +
+		`[{"call":{"service":"a","size":"516B"}},` +
+		`{"call":{"service":"b","size":"516B"}}],{"sleep":"10ms"}]}]}`
+	if expected != string(b) {
+		t.Errorf("expected %s; actual %s", expected, b)
+	}
+
+	var roundTripped ServiceGraph
+	if err = json.Unmarshal(b, &roundTripped); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(graphWithDefaultsAndManyServices, roundTripped) {
+		t.Errorf(
+			"expected %v; actual %v", graphWithDefaultsAndManyServices, roundTripped)
+	}
+}
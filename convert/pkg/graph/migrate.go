@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// APIVersion is the current version of the service graph schema. Documents
+	// without an apiVersion are assumed to be of this version.
+	APIVersion = "v1alpha1"
+	// Kind is the kind of every service graph document.
+	Kind = "MockServiceGraph"
+)
+
+// Migration upgrades a decoded service graph document from one apiVersion to
+// the next.
+type Migration struct {
+	From string
+	To   string
+	// Migrate modifies doc, a JSON object decoded by encoding/json, in place.
+	// It need not update doc's apiVersion.
+	Migrate func(doc map[string]interface{}) error
+}
+
+// migrations lists every Migration, oldest first. The To of the last
+// migration must be APIVersion.
+var migrations []Migration
+
+// migrate upgrades the JSON document b from apiVersion to the target version
+// by applying each applicable migration in turn.
+func migrate(
+	b []byte, apiVersion string, target string, migrations []Migration) (
+	[]byte, error) {
+	if apiVersion == target {
+		return b, nil
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	version := apiVersion
+	for _, m := range migrations {
+		if m.From != version {
+			continue
+		}
+		if err := m.Migrate(doc); err != nil {
+			return nil, MigrationError{m.From, m.To, err}
+		}
+		version = m.To
+		doc["apiVersion"] = version
+		if version == target {
+			return json.Marshal(doc)
+		}
+	}
+	return nil, UnknownAPIVersionError{apiVersion}
+}
+
+// UnknownAPIVersionError is returned when a document's apiVersion is neither
+// APIVersion nor upgradable to it.
+type UnknownAPIVersionError struct {
+	APIVersion string
+}
+
+func (e UnknownAPIVersionError) Error() string {
+	return fmt.Sprintf(
+		"unknown apiVersion: %s (must be %s)", e.APIVersion, APIVersion)
+}
+
+// InvalidKindError is returned when a document's kind is not Kind.
+type InvalidKindError struct {
+	Kind string
+}
+
+func (e InvalidKindError) Error() string {
+	return fmt.Sprintf("invalid kind: %s (must be %s)", e.Kind, Kind)
+}
+
+// MigrationError is returned when a Migration fails.
+type MigrationError struct {
+	From string
+	To   string
+	Err  error
+}
+
+func (e MigrationError) Error() string {
+	return fmt.Sprintf("migrating from %s to %s: %v", e.From, e.To, e.Err)
+}
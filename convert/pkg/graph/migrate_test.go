@@ -0,0 +1,126 @@
+package graph
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestServiceGraph_UnmarshalJSON_Header(t *testing.T) {
+	tests := []struct {
+		input []byte
+		err   error
+	}{
+		{[]byte(`{"services": [{"name": "a"}]}`), nil},
+		{
+			[]byte(`{
+				"apiVersion": "v1alpha1",
+				"kind": "MockServiceGraph",
+				"services": [{"name": "a"}]
+			}`),
+			nil,
+		},
+		{
+			[]byte(`{"apiVersion": "v0", "services": [{"name": "a"}]}`),
+			UnknownAPIVersionError{"v0"},
+		},
+		{
+			[]byte(`{"kind": "ServiceGraph", "services": [{"name": "a"}]}`),
+			InvalidKindError{"ServiceGraph"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			var graph ServiceGraph
+			err := json.Unmarshal(test.input, &graph)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if err == nil && !reflect.DeepEqual(graphWithOneService, graph) {
+				t.Errorf("expected %v; actual %v", graphWithOneService, graph)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	errBroken := errors.New("broken")
+	testMigrations := []Migration{
+		{
+			From: "v1",
+			To:   "v2",
+			Migrate: func(doc map[string]interface{}) error {
+				doc["services"] = doc["nodes"]
+				delete(doc, "nodes")
+				return nil
+			},
+		},
+		{
+			From: "v2",
+			To:   "v3",
+			Migrate: func(doc map[string]interface{}) error {
+				doc["kind"] = Kind
+				return nil
+			},
+		},
+		{
+			From: "v0",
+			To:   "v1",
+			Migrate: func(doc map[string]interface{}) error {
+				return errBroken
+			},
+		},
+	}
+
+	tests := []struct {
+		input      []byte
+		apiVersion string
+		output     []byte
+		err        error
+	}{
+		{
+			[]byte(`{"nodes":[]}`),
+			"v1",
+			[]byte(`{"apiVersion":"v3","kind":"MockServiceGraph","services":[]}`),
+			nil,
+		},
+		{
+			[]byte(`{"services":[]}`),
+			"v3",
+			[]byte(`{"services":[]}`),
+			nil,
+		},
+		{
+			[]byte(`{}`),
+			"v0",
+			nil,
+			MigrationError{"v0", "v1", errBroken},
+		},
+		{
+			[]byte(`{}`),
+			"v4",
+			nil,
+			UnknownAPIVersionError{"v4"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.apiVersion, func(t *testing.T) {
+			t.Parallel()
+
+			output, err := migrate(test.input, test.apiVersion, "v3", testMigrations)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if string(test.output) != string(output) {
+				t.Errorf("expected %s; actual %s", test.output, output)
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package policy
+
+import "fmt"
+
+// InvalidPolicyError is returned when a field of a Policy or Route is invalid.
+type InvalidPolicyError struct {
+	Field  string
+	Reason string
+}
+
+func (e InvalidPolicyError) Error() string {
+	return fmt.Sprintf("invalid policy: %s %s", e.Field, e.Reason)
+}
@@ -0,0 +1,236 @@
+// Package policy describes the traffic policies a service mesh applies to
+// calls to a service.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/pct"
+)
+
+// Policy describes how the mesh handles calls to a service.
+type Policy struct {
+	// Route applies to every call to the service, unless the caller's edge
+	// policy overrides it.
+	Route
+
+	// OutlierDetection ejects replicas of the service which keep failing.
+	OutlierDetection *OutlierDetection `json:"outlierDetection,omitempty"`
+
+	// ConnectionPool limits the connections and requests to the service.
+	ConnectionPool *ConnectionPool `json:"connectionPool,omitempty"`
+
+	// LoadBalancer is the algorithm which picks a replica for each call.
+	LoadBalancer LoadBalancer `json:"loadBalancer,omitempty"`
+
+	// MTLS is the mutual TLS mode of the service's proxy.
+	MTLS MTLSMode `json:"mtls,omitempty"`
+}
+
+// Route describes the handling of calls which may differ between callers.
+type Route struct {
+	// Timeout is the time a caller waits for a response, including retries.
+	Timeout Duration `json:"timeout,omitempty"`
+
+	// Retries are the attempts made by the mesh when a call fails.
+	Retries *Retries `json:"retries,omitempty"`
+
+	// Fault injects delays and errors into calls.
+	Fault *Fault `json:"fault,omitempty"`
+}
+
+// IsZero returns true if r sets nothing.
+func (r Route) IsZero() bool {
+	return r.Timeout == 0 && r.Retries == nil && r.Fault == nil
+}
+
+// Override returns r with the settings of o in place of its own.
+func (r Route) Override(o Route) Route {
+	if o.Timeout != 0 {
+		r.Timeout = o.Timeout
+	}
+	if o.Retries != nil {
+		r.Retries = o.Retries
+	}
+	if o.Fault != nil {
+		r.Fault = o.Fault
+	}
+	return r
+}
+
+// Retries describes how failed calls are retried.
+type Retries struct {
+	Attempts      int32    `json:"attempts"`
+	PerTryTimeout Duration `json:"perTryTimeout,omitempty"`
+
+	// RetryOn lists the failures to retry, such as "5xx,connect-failure".
+	RetryOn string `json:"retryOn,omitempty"`
+}
+
+// Fault describes the faults injected into calls.
+type Fault struct {
+	Delay *DelayFault `json:"delay,omitempty"`
+	Abort *AbortFault `json:"abort,omitempty"`
+}
+
+// DelayFault delays a percentage of calls by a fixed duration.
+type DelayFault struct {
+	Percentage pct.Percentage `json:"percentage"`
+	FixedDelay Duration       `json:"fixedDelay"`
+}
+
+// AbortFault fails a percentage of calls with an HTTP status.
+type AbortFault struct {
+	Percentage pct.Percentage `json:"percentage"`
+	HTTPStatus int32          `json:"httpStatus"`
+}
+
+// OutlierDetection describes when replicas are ejected from the load
+// balancing pool.
+type OutlierDetection struct {
+	Consecutive5xxErrors int32    `json:"consecutive5xxErrors,omitempty"`
+	Interval             Duration `json:"interval,omitempty"`
+	BaseEjectionTime     Duration `json:"baseEjectionTime,omitempty"`
+	MaxEjectionPercent   int32    `json:"maxEjectionPercent,omitempty"`
+}
+
+// ConnectionPool limits the connections and requests to a service.
+type ConnectionPool struct {
+	MaxConnections           int32    `json:"maxConnections,omitempty"`
+	ConnectTimeout           Duration `json:"connectTimeout,omitempty"`
+	HTTP1MaxPendingRequests  int32    `json:"http1MaxPendingRequests,omitempty"`
+	HTTP2MaxRequests         int32    `json:"http2MaxRequests,omitempty"`
+	MaxRequestsPerConnection int32    `json:"maxRequestsPerConnection,omitempty"`
+	MaxRetries               int32    `json:"maxRetries,omitempty"`
+}
+
+// LoadBalancer is a load balancing algorithm.
+type LoadBalancer string
+
+const (
+	// RoundRobin picks each replica in turn.
+	RoundRobin LoadBalancer = "ROUND_ROBIN"
+	// LeastRequest picks the replica with the fewest outstanding requests.
+	LeastRequest LoadBalancer = "LEAST_REQUEST"
+	// Random picks a replica at random.
+	Random LoadBalancer = "RANDOM"
+	// Passthrough sends calls to the address the caller resolved.
+	Passthrough LoadBalancer = "PASSTHROUGH"
+)
+
+// MTLSMode is the mutual TLS mode of a service's proxy.
+type MTLSMode string
+
+const (
+	// MTLSStrict accepts only mutual TLS traffic.
+	MTLSStrict MTLSMode = "STRICT"
+	// MTLSPermissive accepts both mutual TLS and plaintext traffic.
+	MTLSPermissive MTLSMode = "PERMISSIVE"
+	// MTLSDisable accepts only plaintext traffic.
+	MTLSDisable MTLSMode = "DISABLE"
+)
+
+// Duration is a time.Duration encoded as a JSON string such as "1.5s".
+type Duration time.Duration
+
+// MarshalJSON encodes the Duration as a JSON string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON converts a JSON string to a Duration.
+func (d *Duration) UnmarshalJSON(b []byte) (err error) {
+	var durationStr string
+	err = json.Unmarshal(b, &durationStr)
+	if err != nil {
+		return
+	}
+	duration, err := time.ParseDuration(durationStr)
+	if err != nil {
+		return
+	}
+	*d = Duration(duration)
+	return
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Validate returns nil if p is valid; that is, if its route is valid, its
+// durations and limits are not negative and its load balancer and mutual TLS
+// mode are known.
+func (p Policy) Validate() error {
+	if err := p.Route.Validate(); err != nil {
+		return err
+	}
+	if o := p.OutlierDetection; o != nil {
+		if o.Consecutive5xxErrors < 0 {
+			return InvalidPolicyError{
+				"outlierDetection.consecutive5xxErrors", "must not be negative"}
+		}
+		if o.Interval < 0 || o.BaseEjectionTime < 0 {
+			return InvalidPolicyError{
+				"outlierDetection", "durations must not be negative"}
+		}
+		if o.MaxEjectionPercent < 0 || o.MaxEjectionPercent > 100 {
+			return InvalidPolicyError{
+				"outlierDetection.maxEjectionPercent", "must be between 0 and 100"}
+		}
+	}
+	if c := p.ConnectionPool; c != nil {
+		if c.MaxConnections < 0 || c.HTTP1MaxPendingRequests < 0 ||
+			c.HTTP2MaxRequests < 0 || c.MaxRequestsPerConnection < 0 ||
+			c.MaxRetries < 0 || c.ConnectTimeout < 0 {
+			return InvalidPolicyError{"connectionPool", "must not be negative"}
+		}
+	}
+	switch p.LoadBalancer {
+	case "", RoundRobin, LeastRequest, Random, Passthrough:
+	default:
+		return InvalidPolicyError{
+			"loadBalancer", fmt.Sprintf(
+				"must be one of %s, %s, %s or %s",
+				RoundRobin, LeastRequest, Random, Passthrough)}
+	}
+	switch p.MTLS {
+	case "", MTLSStrict, MTLSPermissive, MTLSDisable:
+	default:
+		return InvalidPolicyError{
+			"mtls", fmt.Sprintf(
+				"must be one of %s, %s or %s",
+				MTLSStrict, MTLSPermissive, MTLSDisable)}
+	}
+	return nil
+}
+
+// Validate returns nil if r is valid; that is, if its durations and retry
+// attempts are not negative and each HTTP status it aborts with is valid.
+func (r Route) Validate() error {
+	if r.Timeout < 0 {
+		return InvalidPolicyError{"timeout", "must not be negative"}
+	}
+	if r.Retries != nil {
+		if r.Retries.Attempts < 0 {
+			return InvalidPolicyError{"retries.attempts", "must not be negative"}
+		}
+		if r.Retries.PerTryTimeout < 0 {
+			return InvalidPolicyError{
+				"retries.perTryTimeout", "must not be negative"}
+		}
+	}
+	if r.Fault != nil {
+		if r.Fault.Delay != nil && r.Fault.Delay.FixedDelay <= 0 {
+			return InvalidPolicyError{"fault.delay.fixedDelay", "must be positive"}
+		}
+		if abort := r.Fault.Abort; abort != nil &&
+			(abort.HTTPStatus < 200 || abort.HTTPStatus > 599) {
+			return InvalidPolicyError{
+				"fault.abort.httpStatus",
+				fmt.Sprintf("%d is not a valid HTTP status", abort.HTTPStatus)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package policy
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPolicy_UnmarshalJSON(t *testing.T) {
+	input := `{
+		"timeout": "2s",
+		"retries": {"attempts": 3, "perTryTimeout": "500ms"},
+		"fault": {"abort": {"percentage": "1%", "httpStatus": 503}},
+		"loadBalancer": "LEAST_REQUEST",
+		"mtls": "STRICT"
+	}`
+	expected := Policy{
+		Route: Route{
+			Timeout: Duration(2 * time.Second),
+			Retries: &Retries{
+				Attempts:      3,
+				PerTryTimeout: Duration(500 * time.Millisecond),
+			},
+			Fault: &Fault{Abort: &AbortFault{Percentage: 0.01, HTTPStatus: 503}},
+		},
+		LoadBalancer: LeastRequest,
+		MTLS:         MTLSStrict,
+	}
+
+	var actual Policy
+	if err := json.Unmarshal([]byte(input), &actual); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %+v; actual %+v", expected, actual)
+	}
+
+	b, err := json.Marshal(actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var roundTripped Policy
+	if err := json.Unmarshal(b, &roundTripped); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, roundTripped) {
+		t.Errorf("expected %+v; actual %+v", expected, roundTripped)
+	}
+}
+
+func TestRoute_Override(t *testing.T) {
+	base := Route{Timeout: Duration(time.Second), Retries: &Retries{Attempts: 2}}
+	edge := Route{Timeout: Duration(3 * time.Second)}
+	expected := Route{
+		Timeout: Duration(3 * time.Second), Retries: &Retries{Attempts: 2}}
+	if actual := base.Override(edge); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %+v; actual %+v", expected, actual)
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	tests := []struct {
+		policy Policy
+		err    error
+	}{
+		{Policy{}, nil},
+		{
+			Policy{
+				Route:        Route{Fault: &Fault{Delay: &DelayFault{Percentage: 0.1}}},
+				LoadBalancer: RoundRobin,
+			},
+			InvalidPolicyError{"fault.delay.fixedDelay", "must be positive"},
+		},
+		{
+			Policy{Route: Route{Fault: &Fault{Abort: &AbortFault{HTTPStatus: 99}}}},
+			InvalidPolicyError{
+				"fault.abort.httpStatus", "99 is not a valid HTTP status"},
+		},
+		{
+			Policy{OutlierDetection: &OutlierDetection{MaxEjectionPercent: 101}},
+			InvalidPolicyError{
+				"outlierDetection.maxEjectionPercent", "must be between 0 and 100"},
+		},
+		{
+			Policy{LoadBalancer: "FASTEST"},
+			InvalidPolicyError{
+				"loadBalancer",
+				"must be one of ROUND_ROBIN, LEAST_REQUEST, RANDOM or PASSTHROUGH"},
+		},
+		{
+			Policy{MTLS: "OPTIONAL"},
+			InvalidPolicyError{
+				"mtls", "must be one of STRICT, PERMISSIVE or DISABLE"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			err := test.policy.Validate()
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package graph
+
+import (
+	"github.com/maxfouquet/isotope/convert/pkg/graph/pct"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+)
+
+// SuccessProbabilities computes, and caches, the probability that a call to
+// each service in a graph responds successfully. A service succeeds if it does
+// not fail by its own ErrorRate and every step of its script succeeds, where
+// concurrent steps succeed by their failure policy.
+type SuccessProbabilities struct {
+	services map[string]svc.Service
+	cache    map[string]pct.Percentage
+	visiting map[string]bool
+}
+
+// NewSuccessProbabilities returns the SuccessProbabilities of the services in
+// sg.
+func NewSuccessProbabilities(sg ServiceGraph) SuccessProbabilities {
+	return SuccessProbabilities{
+		services: servicesByName(sg),
+		cache:    make(map[string]pct.Percentage, len(sg.Services)),
+		visiting: map[string]bool{},
+	}
+}
+
+// OfService returns the probability that a call to the service named name
+// succeeds.
+func (p SuccessProbabilities) OfService(name string) pct.Percentage {
+	if probability, ok := p.cache[name]; ok {
+		return probability
+	}
+	service, ok := p.services[name]
+	// Cycles are broken by assuming the service already on the stack succeeds.
+	if !ok || p.visiting[name] {
+		return 1
+	}
+	p.visiting[name] = true
+	probability := 1 - service.ErrorRate
+	for _, cmd := range service.Script {
+		probability *= p.OfCommand(cmd)
+	}
+	delete(p.visiting, name)
+	p.cache[name] = probability
+	return probability
+}
+
+// OfCommand returns the probability that cmd succeeds.
+func (p SuccessProbabilities) OfCommand(cmd script.Command) pct.Percentage {
+	switch cmd := cmd.(type) {
+	case script.RequestCommand:
+		return p.OfService(cmd.ServiceName)
+	case script.ConcurrentCommand:
+		return p.ofConcurrentCommand(cmd)
+	default:
+		return 1
+	}
+}
+
+// ofConcurrentCommand returns the probability that at least as many of cmd's
+// commands succeed as its policy requires, assuming they succeed
+// independently.
+func (p SuccessProbabilities) ofConcurrentCommand(
+	cmd script.ConcurrentCommand) pct.Percentage {
+	// atLeast[k] is the probability that at least k of the commands so far
+	// succeed.
+	atLeast := make([]pct.Percentage, len(cmd.Commands)+1)
+	atLeast[0] = 1
+	for i, subCmd := range cmd.Commands {
+		probability := p.OfCommand(subCmd)
+		for k := i + 1; k > 0; k-- {
+			atLeast[k] = atLeast[k]*(1-probability) + atLeast[k-1]*probability
+		}
+	}
+	required := cmd.Required()
+	if required > len(cmd.Commands) {
+		return 0
+	}
+	return atLeast[required]
+}
@@ -9,8 +9,9 @@ import (
 type Command interface{}
 
 const (
-	sleepCommandKey   = "sleep"
-	requestCommandKey = "call"
+	sleepCommandKey      = "sleep"
+	requestCommandKey    = "call"
+	concurrentCommandKey = "concurrent"
 )
 
 func commandsToMarshallable(cmds []Command) ([]interface{}, error) {
@@ -32,61 +33,31 @@ func commandToMarshallable(cmd Command) (marshallable interface{}, err error) {
 	case RequestCommand:
 		marshallable = map[string]RequestCommand{requestCommandKey: cmd}
 	case ConcurrentCommand:
-		marshallable, err = commandsToMarshallable(cmd)
+		marshallable, err = concurrentCommandToMarshallable(cmd)
 	default:
 		err = InvalidCommandTypeError{cmd}
 	}
 	return
 }
 
-func parseJSONCommands(b []byte) ([]Command, error) {
-	var wrappedCmds []unmarshallableCommand
-	err := json.Unmarshal(b, &wrappedCmds)
-	if err != nil {
-		return nil, err
-	}
-
-	cmds := make([]Command, 0, len(wrappedCmds))
-	for _, wrappedCmd := range wrappedCmds {
-		cmd := wrappedCmd.Command
-		cmds = append(cmds, cmd)
+// concurrentCommandToMarshallable converts cmd to a JSON array of its commands
+// if it has no policy, and otherwise to a concurrentCommandKey object.
+func concurrentCommandToMarshallable(
+	cmd ConcurrentCommand) (interface{}, error) {
+	cmds, err := commandsToMarshallable(cmd.Commands)
+	if err != nil || cmd.Policy == "" {
+		return cmds, err
 	}
-	return cmds, nil
-}
-
-// unmarshallableCommand wraps a Command so that it may act as a receiver.
-type unmarshallableCommand struct{ Command }
-
-func (c *unmarshallableCommand) UnmarshalJSON(b []byte) error {
-	isJSONArray := b[0] == '['
-	if isJSONArray {
-		var concurrentCommand ConcurrentCommand
-		err := json.Unmarshal(b, &concurrentCommand)
-		if err != nil {
-			return err
-		}
-		c.Command = concurrentCommand
-	} else {
-		key, err := parseJSONCommandKey(b)
-		if err != nil {
-			return err
-		}
-		switch key {
-		case sleepCommandKey:
-			c.Command, err = parseSleepCommandFromJSONMap(b)
-			if err != nil {
-				return err
-			}
-		case requestCommandKey:
-			c.Command, err = parseRequestCommandFromJSONMap(b)
-			if err != nil {
-				return err
-			}
-		default:
-			return UnknownCommandKeyError{key}
-		}
+	marshallable := struct {
+		Policy     FailurePolicy `json:"policy"`
+		Quorum     int           `json:"quorum,omitempty"`
+		HedgeDelay string        `json:"hedgeDelay,omitempty"`
+		Commands   []interface{} `json:"commands"`
+	}{Policy: cmd.Policy, Quorum: cmd.Quorum, Commands: cmds}
+	if cmd.HedgeDelay != 0 {
+		marshallable.HedgeDelay = cmd.HedgeDelay.String()
 	}
-	return nil
+	return map[string]interface{}{concurrentCommandKey: marshallable}, nil
 }
 
 func parseJSONCommandKey(b []byte) (s string, err error) {
@@ -105,30 +76,6 @@ func parseJSONCommandKey(b []byte) (s string, err error) {
 	return
 }
 
-// b must contain a single key whose value is an unmarshallable SleepCommand.
-func parseSleepCommandFromJSONMap(b []byte) (cmd SleepCommand, err error) {
-	var m map[string]SleepCommand
-	err = json.Unmarshal(b, &m)
-	if err != nil {
-		return
-	}
-	for _, cmd = range m {
-	}
-	return
-}
-
-// b must contain a single key whose value is an unmarshallable RequestCommand.
-func parseRequestCommandFromJSONMap(b []byte) (cmd RequestCommand, err error) {
-	var m map[string]RequestCommand
-	err = json.Unmarshal(b, &m)
-	if err != nil {
-		return
-	}
-	for _, cmd = range m {
-	}
-	return
-}
-
 // InvalidCommandTypeError is returned when a type-switch on a Command does not
 // reveal a known Command.
 type InvalidCommandTypeError struct {
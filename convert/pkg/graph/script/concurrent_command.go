@@ -1,16 +1,125 @@
 package script
 
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// FailurePolicy decides whether a ConcurrentCommand succeeds from which of its
+// commands succeed.
+type FailurePolicy string
+
+const (
+	// All waits for every command and succeeds if they all succeed.
+	All FailurePolicy = "all"
+	// Any waits for every command and succeeds if any one succeeds.
+	Any FailurePolicy = "any"
+	// Quorum succeeds as soon as Quorum commands succeed, and fails as soon as
+	// that is impossible. The commands still running are cancelled.
+	Quorum FailurePolicy = "quorum"
+	// FirstSuccess hedges: it starts the commands in order, each after the
+	// previous fails or HedgeDelay passes, and succeeds as soon as one
+	// succeeds. The commands still running are cancelled, and the rest are not
+	// started.
+	FirstSuccess FailurePolicy = "firstSuccess"
+	// BestEffort waits for every command and succeeds even if they all fail.
+	BestEffort FailurePolicy = "bestEffort"
+)
+
 // ConcurrentCommand describes a set of commands that should be executed
 // simultaneously.
-type ConcurrentCommand []Command
+type ConcurrentCommand struct {
+	Commands []Command
+
+	// Policy decides whether the command succeeds. If empty, it is All.
+	Policy FailurePolicy
+
+	// Quorum is the number of commands which must succeed under the Quorum
+	// policy.
+	Quorum int
+
+	// HedgeDelay is how long the FirstSuccess policy waits for a command to
+	// succeed before starting the next. If 0, every command starts at once.
+	HedgeDelay time.Duration
+}
+
+// Required returns the number of c's commands which must succeed for c to
+// succeed.
+func (c ConcurrentCommand) Required() int {
+	switch c.Policy {
+	case Any, FirstSuccess:
+		return 1
+	case Quorum:
+		return c.Quorum
+	case BestEffort:
+		return 0
+	default:
+		return len(c.Commands)
+	}
+}
+
+// CancelsLosers returns true if c stops the commands still running once it is
+// known whether c succeeds.
+func (c ConcurrentCommand) CancelsLosers() bool {
+	return c.Policy == Quorum || c.Policy == FirstSuccess
+}
+
+// Validate returns an error if c's policy is unknown or its settings do not
+// suit its policy.
+func (c ConcurrentCommand) Validate() error {
+	switch c.Policy {
+	case "", All, Any, Quorum, FirstSuccess, BestEffort:
+	default:
+		return InvalidConcurrentCommandError{fmt.Sprintf(
+			"policy must be one of %s, %s, %s, %s or %s",
+			All, Any, Quorum, FirstSuccess, BestEffort)}
+	}
+	if c.Policy == Quorum {
+		if c.Quorum < 1 || c.Quorum > len(c.Commands) {
+			return InvalidConcurrentCommandError{fmt.Sprintf(
+				"quorum must be between 1 and the number of commands, %d",
+				len(c.Commands))}
+		}
+	} else if c.Quorum != 0 {
+		return InvalidConcurrentCommandError{"quorum requires the quorum policy"}
+	}
+	if c.Required() > len(c.Commands) {
+		return InvalidConcurrentCommandError{fmt.Sprintf(
+			"the %s policy requires at least one command", c.Policy)}
+	}
+	if c.HedgeDelay < 0 {
+		return InvalidConcurrentCommandError{"hedgeDelay must not be negative"}
+	}
+	if c.HedgeDelay != 0 && c.Policy != FirstSuccess {
+		return InvalidConcurrentCommandError{
+			"hedgeDelay requires the firstSuccess policy"}
+	}
+	return nil
+}
 
 // UnmarshalJSON converts b to a ConcurrentCommand. b must be a JSON array of
-// commands.
+// commands, or the JSON object described by concurrentCommandJSON.
 func (c *ConcurrentCommand) UnmarshalJSON(b []byte) (err error) {
-	cmds, err := parseJSONCommands(b)
-	if err != nil {
-		return
-	}
-	*c = ConcurrentCommand(cmds)
+	*c, err = Decoder{}.decodeConcurrentCommand(b)
 	return
 }
+
+// concurrentCommandJSON is the JSON object of a ConcurrentCommand with a
+// policy, under the key concurrentCommandKey.
+type concurrentCommandJSON struct {
+	Policy     FailurePolicy     `json:"policy,omitempty"`
+	Quorum     int               `json:"quorum,omitempty"`
+	HedgeDelay string            `json:"hedgeDelay,omitempty"`
+	Commands   []json.RawMessage `json:"commands"`
+}
+
+// InvalidConcurrentCommandError is returned when a ConcurrentCommand's policy
+// or its settings are invalid.
+type InvalidConcurrentCommandError struct {
+	Reason string
+}
+
+func (e InvalidConcurrentCommandError) Error() string {
+	return fmt.Sprintf("invalid concurrent command: %s", e.Reason)
+}
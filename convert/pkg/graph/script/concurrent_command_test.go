@@ -15,21 +15,39 @@ func TestConcurrentCommand_UnmarshalJSON(t *testing.T) {
 	}{
 		{
 			[]byte(`[]`),
-			ConcurrentCommand{},
+			ConcurrentCommand{Commands: []Command{}},
 			nil,
 		},
 		{
 			[]byte(`[{"sleep": "1s"}]`),
-			ConcurrentCommand{
+			ConcurrentCommand{Commands: []Command{
 				SleepCommand(1 * time.Second),
-			},
+			}},
 			nil,
 		},
 		{
 			[]byte(`[{"call": "A"}, {"sleep": "10ms"}]`),
-			ConcurrentCommand{
+			ConcurrentCommand{Commands: []Command{
 				RequestCommand{ServiceName: "A"},
 				SleepCommand(10 * time.Millisecond),
+			}},
+			nil,
+		},
+		{
+			[]byte(`{"policy": "quorum", "quorum": 1, "commands": [{"call": "A"}]}`),
+			ConcurrentCommand{
+				Commands: []Command{RequestCommand{ServiceName: "A"}},
+				Policy:   Quorum,
+				Quorum:   1,
+			},
+			nil,
+		},
+		{
+			[]byte(`{"policy": "firstSuccess", "hedgeDelay": "5ms", "commands": []}`),
+			ConcurrentCommand{
+				Commands:   []Command{},
+				Policy:     FirstSuccess,
+				HedgeDelay: 5 * time.Millisecond,
 			},
 			nil,
 		},
@@ -51,3 +69,99 @@ func TestConcurrentCommand_UnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestConcurrentCommand_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		command ConcurrentCommand
+		json    string
+	}{
+		{
+			ConcurrentCommand{Commands: []Command{RequestCommand{ServiceName: "A"}}},
+			`[[{"call":{"service":"A","size":"0B"}}]]`,
+		},
+		{
+			ConcurrentCommand{
+				Commands: []Command{
+					RequestCommand{ServiceName: "A"},
+					RequestCommand{ServiceName: "B"},
+				},
+				Policy:     FirstSuccess,
+				HedgeDelay: 10 * time.Millisecond,
+			},
+			`[{"concurrent":{"policy":"firstSuccess","hedgeDelay":"10ms",` +
+				`"commands":[{"call":{"service":"A","size":"0B"}},` +
+				`{"call":{"service":"B","size":"0B"}}]}}]`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.json, func(t *testing.T) {
+			t.Parallel()
+
+			b, err := json.Marshal(Script{test.command})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.json != string(b) {
+				t.Errorf("expected %s; actual %s", test.json, b)
+			}
+
+			var roundTripped Script
+			if err := json.Unmarshal(b, &roundTripped); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(Script{test.command}, roundTripped) {
+				t.Errorf("expected %v; actual %v", test.command, roundTripped)
+			}
+		})
+	}
+}
+
+func TestConcurrentCommand_Validate(t *testing.T) {
+	two := []Command{RequestCommand{ServiceName: "A"}, SleepCommand(0)}
+	tests := []struct {
+		command ConcurrentCommand
+		err     error
+	}{
+		{ConcurrentCommand{Commands: two}, nil},
+		{ConcurrentCommand{Commands: two, Policy: Quorum, Quorum: 2}, nil},
+		{ConcurrentCommand{Commands: two, Policy: FirstSuccess, HedgeDelay: 1}, nil},
+		{ConcurrentCommand{Commands: []Command{}, Policy: BestEffort}, nil},
+		{
+			ConcurrentCommand{Commands: two, Policy: "most"},
+			InvalidConcurrentCommandError{
+				"policy must be one of all, any, quorum, firstSuccess or bestEffort"},
+		},
+		{
+			ConcurrentCommand{Commands: two, Policy: Quorum, Quorum: 3},
+			InvalidConcurrentCommandError{
+				"quorum must be between 1 and the number of commands, 2"},
+		},
+		{
+			ConcurrentCommand{Commands: two, Quorum: 1},
+			InvalidConcurrentCommandError{"quorum requires the quorum policy"},
+		},
+		{
+			ConcurrentCommand{Commands: []Command{}, Policy: Any},
+			InvalidConcurrentCommandError{
+				"the any policy requires at least one command"},
+		},
+		{
+			ConcurrentCommand{Commands: two, HedgeDelay: 1},
+			InvalidConcurrentCommandError{
+				"hedgeDelay requires the firstSuccess policy"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			if err := test.command.Validate(); test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+		})
+	}
+}
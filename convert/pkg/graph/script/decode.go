@@ -0,0 +1,127 @@
+package script
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/size"
+)
+
+// Decoder decodes scripts from JSON, filling in the values commands omit. It
+// holds no global state, so any number of Decoders may be used concurrently.
+// The zero value decodes calls without a size as zero-byte requests.
+type Decoder struct {
+	// RequestSize is the size of each RequestCommand which does not specify
+	// one.
+	RequestSize size.ByteSize
+}
+
+// DecodeScript converts b to a Script. b must be a JSON array of Commands.
+func (d Decoder) DecodeScript(b []byte) (Script, error) {
+	cmds, err := d.decodeCommands(b)
+	if err != nil {
+		return nil, err
+	}
+	return Script(cmds), nil
+}
+
+func (d Decoder) decodeCommands(b []byte) ([]Command, error) {
+	var rawCmds []json.RawMessage
+	err := json.Unmarshal(b, &rawCmds)
+	if err != nil {
+		return nil, err
+	}
+
+	cmds := make([]Command, 0, len(rawCmds))
+	for _, rawCmd := range rawCmds {
+		cmd, err := d.decodeCommand(rawCmd)
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds, nil
+}
+
+func (d Decoder) decodeCommand(b []byte) (Command, error) {
+	isJSONArray := b[0] == '['
+	if isJSONArray {
+		return d.decodeConcurrentCommand(b)
+	}
+
+	key, err := parseJSONCommandKey(b)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]json.RawMessage
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+	switch key {
+	case sleepCommandKey:
+		var cmd SleepCommand
+		err = json.Unmarshal(m[key], &cmd)
+		return cmd, err
+	case requestCommandKey:
+		return d.decodeRequestCommand(m[key])
+	case concurrentCommandKey:
+		return d.decodeConcurrentCommand(m[key])
+	default:
+		return nil, UnknownCommandKeyError{key}
+	}
+}
+
+// decodeConcurrentCommand converts b to a ConcurrentCommand. If b is a JSON
+// array, its elements are the command's commands. If b is a JSON object, its
+// properties are mapped to the command.
+func (d Decoder) decodeConcurrentCommand(
+	b []byte) (cmd ConcurrentCommand, err error) {
+	isJSONArray := b[0] == '['
+	if isJSONArray {
+		cmd.Commands, err = d.decodeCommands(b)
+		return
+	}
+	var object concurrentCommandJSON
+	err = json.Unmarshal(b, &object)
+	if err != nil {
+		return
+	}
+	cmd.Policy = object.Policy
+	cmd.Quorum = object.Quorum
+	if object.HedgeDelay != "" {
+		cmd.HedgeDelay, err = time.ParseDuration(object.HedgeDelay)
+		if err != nil {
+			return
+		}
+	}
+	cmd.Commands = make([]Command, 0, len(object.Commands))
+	for _, rawCmd := range object.Commands {
+		subCmd, err := d.decodeCommand(rawCmd)
+		if err != nil {
+			return ConcurrentCommand{}, err
+		}
+		cmd.Commands = append(cmd.Commands, subCmd)
+	}
+	return
+}
+
+// decodeRequestCommand converts b to a RequestCommand. If b is a JSON string,
+// it is set as the command's ServiceName. If b is a JSON object, its
+// properties are mapped to the command.
+func (d Decoder) decodeRequestCommand(b []byte) (cmd RequestCommand, err error) {
+	cmd.Size = d.RequestSize
+	isJSONString := b[0] == '"'
+	if isJSONString {
+		err = json.Unmarshal(b, &cmd.ServiceName)
+		return
+	}
+	// Wrap the RequestCommand to dodge the custom UnmarshalJSON.
+	unmarshallable := unmarshallableRequestCommand(cmd)
+	err = json.Unmarshal(b, &unmarshallable)
+	if err != nil {
+		return
+	}
+	cmd = RequestCommand(unmarshallable)
+	return
+}
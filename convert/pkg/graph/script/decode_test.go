@@ -0,0 +1,54 @@
+package script
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestDecoder_DecodeScript_RequestSize(t *testing.T) {
+	decoder := Decoder{RequestSize: 512}
+
+	tests := []struct {
+		input   []byte
+		command RequestCommand
+		err     error
+	}{
+		{
+			[]byte(`"A"`),
+			RequestCommand{ServiceName: "A", Size: 512},
+			nil,
+		},
+		{
+			[]byte(`{"service": "A"}`),
+			RequestCommand{ServiceName: "A", Size: 512},
+			nil,
+		},
+		{
+			[]byte(`{"service": "a", "size": 128}`),
+			RequestCommand{ServiceName: "a", Size: 128},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			input := []byte(fmt.Sprintf(`[{"call": %s}, [{"call": %s}]]`,
+				test.input, test.input))
+			script, err := decoder.DecodeScript(input)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			expected := Script{
+				test.command,
+				ConcurrentCommand{Commands: []Command{test.command}},
+			}
+			if !reflect.DeepEqual(expected, script) {
+				t.Errorf("expected %v; actual %v", expected, script)
+			}
+		})
+	}
+}
@@ -1,8 +1,6 @@
 package script
 
 import (
-	"encoding/json"
-
 	"github.com/maxfouquet/isotope/convert/pkg/graph/size"
 )
 
@@ -14,33 +12,11 @@ type RequestCommand struct {
 	Size size.ByteSize `json:"size"`
 }
 
-var (
-	// DefaultRequestCommand is used by UnmarshalJSON to set defaults.
-	DefaultRequestCommand RequestCommand
-)
-
 // UnmarshalJSON converts b to a RequestCommand. If b is a JSON string, it is
 // set as c's ServiceName. If b is a JSON object, it's properties are mapped to
-// c.
+// c. Use a Decoder to give a default Size.
 func (c *RequestCommand) UnmarshalJSON(b []byte) (err error) {
-	*c = DefaultRequestCommand
-	isJSONString := b[0] == '"'
-	if isJSONString {
-		var s string
-		err = json.Unmarshal(b, &s)
-		if err != nil {
-			return
-		}
-		c.ServiceName = s
-	} else {
-		// Wrap the RequestCommand to dodge the custom UnmarshalJSON.
-		unmarshallableRequestCommand := unmarshallableRequestCommand(*c)
-		err = json.Unmarshal(b, &unmarshallableRequestCommand)
-		if err != nil {
-			return
-		}
-		*c = RequestCommand(unmarshallableRequestCommand)
-	}
+	*c, err = Decoder{}.decodeRequestCommand(b)
 	return
 }
 
@@ -17,11 +17,8 @@ func (s Script) MarshalJSON() ([]byte, error) {
 }
 
 // UnmarshalJSON converts b to a Script. b must be a JSON array of Commands.
+// Use a Decoder to give calls a default size.
 func (s *Script) UnmarshalJSON(b []byte) (err error) {
-	cmds, err := parseJSONCommands(b)
-	if err != nil {
-		return
-	}
-	*s = Script(cmds)
+	*s, err = Decoder{}.DecodeScript(b)
 	return
 }
@@ -8,8 +8,6 @@ import (
 )
 
 func TestScript_UnmarshalJSON(t *testing.T) {
-	DefaultRequestCommand = RequestCommand{}
-
 	tests := []struct {
 		input  []byte
 		script Script
@@ -38,10 +36,10 @@ func TestScript_UnmarshalJSON(t *testing.T) {
 		{
 			[]byte(`[[{"call": "A"}, {"call": "B"}], {"sleep": "10ms"}]`),
 			Script{
-				ConcurrentCommand{
+				ConcurrentCommand{Commands: []Command{
 					RequestCommand{ServiceName: "A"},
 					RequestCommand{ServiceName: "B"},
-				},
+				}},
 				SleepCommand(10 * time.Millisecond),
 			},
 			nil,
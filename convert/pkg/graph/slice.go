@@ -0,0 +1,54 @@
+package graph
+
+import (
+	"fmt"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+)
+
+// Slice returns the smallest valid ServiceGraph from which the service named
+// name can be emulated: the service itself, followed by the name and type of
+// each service it calls and, if it limits the rate of each caller, of each
+// service which calls it, so that it can tell its callers apart.
+func Slice(g ServiceGraph, name string) (ServiceGraph, error) {
+	services := servicesByName(g)
+	service, ok := services[name]
+	if !ok {
+		return ServiceGraph{}, ErrServiceNotFound{name}
+	}
+	others := Callees(service)
+	if service.RateLimit != nil && service.RateLimit.PerCaller {
+		for _, caller := range g.Services {
+			for _, callee := range Callees(caller) {
+				if callee == name {
+					others = append(others, caller.Name)
+					break
+				}
+			}
+		}
+	}
+	slice := ServiceGraph{Services: make([]svc.Service, 0, len(others)+1)}
+	slice.Services = append(slice.Services, service)
+	added := map[string]bool{name: true}
+	for _, other := range others {
+		if added[other] {
+			continue
+		}
+		added[other] = true
+		slice.Services = append(slice.Services, svc.Service{
+			Name: other,
+			Type: services[other].Type,
+		})
+	}
+	return slice, nil
+}
+
+// ErrServiceNotFound is returned when a service graph has no service with the
+// requested name.
+type ErrServiceNotFound struct {
+	ServiceName string
+}
+
+func (e ErrServiceNotFound) Error() string {
+	return fmt.Sprintf(`service "%s" is not in the service graph`, e.ServiceName)
+}
@@ -0,0 +1,76 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
+)
+
+func TestSlice(t *testing.T) {
+	a := svc.Service{
+		Name:        "a",
+		NumReplicas: 3,
+		Script: script.Script{
+			script.RequestCommand{ServiceName: "b"},
+			script.ConcurrentCommand{Commands: []script.Command{
+				script.RequestCommand{ServiceName: "a"},
+				script.RequestCommand{ServiceName: "b"},
+			}},
+		},
+	}
+	g := ServiceGraph{[]svc.Service{
+		a,
+		{
+			Name:        "b",
+			Type:        svctype.ServiceGRPC,
+			NumReplicas: 2,
+			Script:      script.Script{script.RequestCommand{ServiceName: "c"}},
+		},
+		{Name: "c"},
+	}}
+
+	actual, err := Slice(g, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ServiceGraph{[]svc.Service{
+		a,
+		{Name: "b", Type: svctype.ServiceGRPC},
+	}}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v; actual %v", expected, actual)
+	}
+	if err := Validate(actual); err != nil {
+		t.Errorf("expected a valid slice; actual %v", err)
+	}
+
+	// A service which limits the rate of each caller tells them apart.
+	perCaller := svc.Service{
+		Name:      "c",
+		RateLimit: &svc.RateLimit{RequestsPerSecond: 1, PerCaller: true},
+	}
+	g.Services[2] = perCaller
+	g.Services = append(g.Services, svc.Service{
+		Name:   "d",
+		Script: script.Script{script.RequestCommand{ServiceName: "c"}},
+	})
+	actual, err = Slice(g, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = ServiceGraph{[]svc.Service{
+		perCaller,
+		{Name: "b", Type: svctype.ServiceGRPC},
+		{Name: "d"},
+	}}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v; actual %v", expected, actual)
+	}
+
+	if _, err := Slice(g, "e"); err != (ErrServiceNotFound{"e"}) {
+		t.Errorf("expected %v; actual %v", ErrServiceNotFound{"e"}, err)
+	}
+}
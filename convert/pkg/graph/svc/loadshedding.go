@@ -0,0 +1,21 @@
+package svc
+
+import "github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+
+// PriorityHeaderKey is the header which sets the priority of a request. It is
+// forwarded to the calls the request causes. Requests without it have
+// priority 0.
+const PriorityHeaderKey = "Isotope-Priority"
+
+// LoadShedding rejects requests of low priority while a service is slow.
+// Shed requests are answered 503 Service Unavailable.
+type LoadShedding struct {
+	// LatencyTarget is the mean time to serve a request over the last second
+	// above which requests are shed.
+	LatencyTarget policy.Duration `json:"latencyTarget"`
+
+	// MinPriority is the lowest priority of the requests which are served
+	// while the service is slow. If 0, it is 1, so only requests without a
+	// priority are shed.
+	MinPriority int `json:"minPriority,omitempty"`
+}
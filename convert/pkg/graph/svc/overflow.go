@@ -0,0 +1,12 @@
+package svc
+
+// Overflow is what a service does with a request which arrives when it is
+// serving MaxConcurrency requests and QueueSize more are waiting.
+type Overflow string
+
+const (
+	// OverflowReject responds to the request with 503 Service Unavailable.
+	OverflowReject Overflow = "reject"
+	// OverflowWait queues the request anyway, so the queue is unbounded.
+	OverflowWait Overflow = "wait"
+)
@@ -0,0 +1,17 @@
+package svc
+
+// RateLimit limits the rate at which a service accepts requests with a token
+// bucket. Requests which find the bucket empty are answered 429 Too Many
+// Requests.
+type RateLimit struct {
+	// RequestsPerSecond is the rate at which the bucket refills.
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+
+	// Burst is the size of the bucket: the most requests accepted at once
+	// after a lull. If 0, it is RequestsPerSecond rounded up.
+	Burst int `json:"burst,omitempty"`
+
+	// PerCaller gives each calling service in the graph a bucket of its own,
+	// rather than sharing one between them. Other callers share one.
+	PerCaller bool `json:"perCaller,omitempty"`
+}
@@ -1,7 +1,9 @@
 package svc
 
 import (
+	"github.com/maxfouquet/isotope/convert/pkg/graph/k8s"
 	"github.com/maxfouquet/isotope/convert/pkg/graph/pct"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
 	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
 	"github.com/maxfouquet/isotope/convert/pkg/graph/size"
 	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
@@ -12,6 +14,11 @@ type Service struct {
 	// Name is the DNS-addressable name of the service.
 	Name string `json:"name"`
 
+	// Labels are arbitrary key/value pairs, such as "tier: frontend". They
+	// select the service into groups and are added to its Kubernetes metadata
+	// and Prometheus metrics.
+	Labels map[string]string `json:"labels,omitempty"`
+
 	// Type describes what protocol the service supports (e.g. HTTP, gRPC).
 	Type svctype.ServiceType `json:"type,omitempty"`
 
@@ -22,8 +29,9 @@ type Service struct {
 	// graph, representing a public service.
 	IsEntrypoint bool `json:"isEntrypoint,omitempty"`
 
-	// ErrorRate is the percentage chance between 0 and 1 that this service
-	// should respond with a 500 server error rather than 200 OK.
+	// ErrorRate is the percentage chance between 0 and 1 that this service is
+	// modelled to fail, which weighs its calls in Graphviz output. The mock
+	// service does not fail by it; inject an errorRate fault for that.
 	ErrorRate pct.Percentage `json:"errorRate,omitempty"`
 
 	// ResponseSize is the number of bytes in the response body.
@@ -31,4 +39,35 @@ type Service struct {
 
 	// Script is sequentially called each time the service is called.
 	Script script.Script `json:"script,omitempty"`
+
+	// MaxConcurrency is the most requests the service serves at once. If 0,
+	// there is no limit.
+	MaxConcurrency int `json:"maxConcurrency,omitempty"`
+
+	// QueueSize is the most requests which wait for one of MaxConcurrency to
+	// finish before Overflow applies.
+	QueueSize int `json:"queueSize,omitempty"`
+
+	// Overflow is what happens to requests which arrive when the queue is
+	// full. If empty, they are rejected.
+	Overflow Overflow `json:"overflow,omitempty"`
+
+	// RateLimit limits the rate at which the service accepts requests. If nil,
+	// there is no limit.
+	RateLimit *RateLimit `json:"rateLimit,omitempty"`
+
+	// LoadShedding rejects requests of low priority while the service is slow.
+	// If nil, no requests are shed.
+	LoadShedding *LoadShedding `json:"loadShedding,omitempty"`
+
+	// Kubernetes describes how the service is scheduled and sized when
+	// deployed to Kubernetes.
+	Kubernetes *k8s.Settings `json:"kubernetes,omitempty"`
+
+	// Policy describes how a service mesh handles calls to the service.
+	Policy *policy.Policy `json:"policy,omitempty"`
+
+	// EdgePolicies override the route settings of Policy for the calls this
+	// service makes, keyed by the name of the service called.
+	EdgePolicies map[string]policy.Route `json:"edgePolicies,omitempty"`
 }
@@ -7,15 +7,16 @@ import (
 	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
 )
 
-var (
-	// DefaultService is used by UnmarshalJSON and describes the default settings.
-	DefaultService = Service{Type: svctype.ServiceHTTP, NumReplicas: 1}
-)
+// Default returns the settings of a service which specifies nothing but its
+// name.
+func Default() Service {
+	return Service{Type: svctype.ServiceHTTP, NumReplicas: 1}
+}
 
 // UnmarshalJSON converts b to a Service, applying the default values from
-// DefaultService.
+// Default. Defaults from a service graph are applied by graph.Decoder.
 func (svc *Service) UnmarshalJSON(b []byte) (err error) {
-	unmarshallable := unmarshallableService(DefaultService)
+	unmarshallable := unmarshallableService(Default())
 	err = json.Unmarshal(b, &unmarshallable)
 	if err != nil {
 		return
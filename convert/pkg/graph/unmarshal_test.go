@@ -30,6 +30,11 @@ func TestServiceGraph_UnmarshalJSON(t *testing.T) {
 			ServiceGraph{},
 			ErrNestedConcurrentCommand,
 		},
+		{
+			jsonWithDuplicateService,
+			ServiceGraph{},
+			ErrDuplicateService{"a"},
+		},
 	}
 
 	for _, test := range tests {
@@ -139,10 +144,10 @@ var (
 			ErrorRate:    0.2,
 			ResponseSize: 1024,
 			Script: script.Script([]script.Command{
-				script.ConcurrentCommand{
+				script.ConcurrentCommand{Commands: []script.Command{
 					script.RequestCommand{ServiceName: "a", Size: 516},
 					script.RequestCommand{ServiceName: "b", Size: 516},
-				},
+				}},
 				script.SleepCommand(10 * time.Millisecond),
 			}),
 		},
@@ -157,6 +162,11 @@ var (
 			]
 		}
 	`)
+	jsonWithDuplicateService = []byte(`
+		{
+			"services": [{"name": "a"}, {"name": "b"}, {"name": "a"}]
+		}
+	`)
 	jsonWithNestedConcurrentCommand = []byte(`
 		{
 			"services": [
@@ -3,24 +3,69 @@ package graph
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
-// validate returns nil if g is valid.
+// Validate returns nil if g is valid.
 // g is valid if a ServiceGraph:
+// - Each of its services has a unique name.
+// - Each of its services' labels is a valid Kubernetes label.
+// - Each of its services' Kubernetes settings are valid.
+// - Each of its services' policies are valid.
+// - Each of its services' concurrency limits are valid.
+// - Each of its services' rate limits and load shedding are valid.
 // - Each of its services only makes requests to other defined services.
+// - Each of its services' edge policies is for a service it calls.
 // - ConcurrentCommands do not contain other ConcurrentCommands.
-func validate(g ServiceGraph) (err error) {
+// - ConcurrentCommands have valid failure policies.
+func Validate(g ServiceGraph) (err error) {
 	svcNames := map[string]bool{}
 	for _, svc := range g.Services {
+		if svcNames[svc.Name] {
+			return ErrDuplicateService{svc.Name}
+		}
 		svcNames[svc.Name] = true
+		err = validateLabels(svc.Name, svc.Labels)
+		if err != nil {
+			return
+		}
+		if svc.Kubernetes != nil {
+			if innerErr := svc.Kubernetes.Validate(); innerErr != nil {
+				return ErrInvalidKubernetesSettings{svc.Name, innerErr}
+			}
+		}
+		if svc.Policy != nil {
+			if innerErr := svc.Policy.Validate(); innerErr != nil {
+				return ErrInvalidPolicy{svc.Name, innerErr}
+			}
+		}
+		err = validateConcurrency(svc)
+		if err != nil {
+			return
+		}
+		err = validateRateLimit(svc)
+		if err != nil {
+			return
+		}
+		err = validateLoadShedding(svc)
+		if err != nil {
+			return
+		}
 	}
 	for _, svc := range g.Services {
 		err = validateCommands(svc.Script, svcNames)
 		if err != nil {
 			return
 		}
+		err = validateEdgePolicies(svc)
+		if err != nil {
+			return
+		}
 	}
 	return
 }
@@ -33,13 +78,104 @@ func validateCommands(cmds []script.Command, svcNames map[string]bool) error {
 				return ErrRequestToUndefinedService{cmd.ServiceName}
 			}
 		case script.ConcurrentCommand:
-			err := validateCommands(cmd, svcNames)
+			err := validateCommands(cmd.Commands, svcNames)
 			if err != nil {
 				return err
 			}
-			if containsConcurrentCommand([]script.Command(cmd)) {
+			if containsConcurrentCommand(cmd.Commands) {
 				return ErrNestedConcurrentCommand
 			}
+			err = cmd.Validate()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateEdgePolicies(service svc.Service) error {
+	if len(service.EdgePolicies) == 0 {
+		return nil
+	}
+	called := map[string]bool{}
+	for _, callee := range Callees(service) {
+		called[callee] = true
+	}
+	names := make([]string, 0, len(service.EdgePolicies))
+	for name := range service.EdgePolicies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !called[name] {
+			return ErrEdgePolicyWithoutCall{service.Name, name}
+		}
+		if err := service.EdgePolicies[name].Validate(); err != nil {
+			return ErrInvalidPolicy{service.Name, err}
+		}
+	}
+	return nil
+}
+
+func validateConcurrency(service svc.Service) error {
+	switch {
+	case service.MaxConcurrency < 0:
+		return ErrInvalidConcurrency{service.Name, "maxConcurrency must not be negative"}
+	case service.QueueSize < 0:
+		return ErrInvalidConcurrency{service.Name, "queueSize must not be negative"}
+	case service.MaxConcurrency == 0 &&
+		(service.QueueSize > 0 || service.Overflow != ""):
+		return ErrInvalidConcurrency{
+			service.Name, "queueSize and overflow require maxConcurrency"}
+	}
+	switch service.Overflow {
+	case "", svc.OverflowReject, svc.OverflowWait:
+		return nil
+	default:
+		return ErrInvalidConcurrency{service.Name, fmt.Sprintf(
+			`overflow must be "%s" or "%s"`, svc.OverflowReject, svc.OverflowWait)}
+	}
+}
+
+func validateRateLimit(service svc.Service) error {
+	limit := service.RateLimit
+	switch {
+	case limit == nil:
+		return nil
+	case limit.RequestsPerSecond <= 0:
+		return ErrInvalidRateLimit{service.Name, "requestsPerSecond must be positive"}
+	case limit.Burst < 0:
+		return ErrInvalidRateLimit{service.Name, "burst must not be negative"}
+	}
+	return nil
+}
+
+func validateLoadShedding(service svc.Service) error {
+	shedding := service.LoadShedding
+	switch {
+	case shedding == nil:
+		return nil
+	case shedding.LatencyTarget <= 0:
+		return ErrInvalidLoadShedding{service.Name, "latencyTarget must be positive"}
+	case shedding.MinPriority < 0:
+		return ErrInvalidLoadShedding{service.Name, "minPriority must not be negative"}
+	}
+	return nil
+}
+
+func validateLabels(serviceName string, labels map[string]string) error {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		reasons := append(
+			validation.IsQualifiedName(key),
+			validation.IsValidLabelValue(labels[key])...)
+		if len(reasons) > 0 {
+			return ErrInvalidLabel{serviceName, key, strings.Join(reasons, "; ")}
 		}
 	}
 	return nil
@@ -64,6 +200,101 @@ func (e ErrRequestToUndefinedService) Error() string {
 	return fmt.Sprintf(`cannot call undefined service "%s"`, e.ServiceName)
 }
 
+// ErrDuplicateService is returned when more than one service has the same
+// name.
+type ErrDuplicateService struct {
+	ServiceName string
+}
+
+func (e ErrDuplicateService) Error() string {
+	return fmt.Sprintf(`service "%s" is defined more than once`, e.ServiceName)
+}
+
+// ErrInvalidLabel is returned when a service has a label which is not a valid
+// Kubernetes label.
+type ErrInvalidLabel struct {
+	ServiceName string
+	Key         string
+	Reason      string
+}
+
+func (e ErrInvalidLabel) Error() string {
+	return fmt.Sprintf(
+		`service "%s" has invalid label "%s": %s`, e.ServiceName, e.Key, e.Reason)
+}
+
+// ErrInvalidKubernetesSettings is returned when a service's Kubernetes
+// settings are invalid.
+type ErrInvalidKubernetesSettings struct {
+	ServiceName string
+	Err         error
+}
+
+func (e ErrInvalidKubernetesSettings) Error() string {
+	return fmt.Sprintf(
+		`service "%s" has invalid Kubernetes settings: %v`, e.ServiceName, e.Err)
+}
+
+// ErrInvalidPolicy is returned when a service's policy, or one of its edge
+// policies, is invalid.
+type ErrInvalidPolicy struct {
+	ServiceName string
+	Err         error
+}
+
+func (e ErrInvalidPolicy) Error() string {
+	return fmt.Sprintf(
+		`service "%s" has an invalid policy: %v`, e.ServiceName, e.Err)
+}
+
+// ErrInvalidConcurrency is returned when a service's concurrency limits are
+// invalid.
+type ErrInvalidConcurrency struct {
+	ServiceName string
+	Reason      string
+}
+
+func (e ErrInvalidConcurrency) Error() string {
+	return fmt.Sprintf(
+		`service "%s" has invalid concurrency limits: %s`, e.ServiceName, e.Reason)
+}
+
+// ErrInvalidRateLimit is returned when a service's rate limit is invalid.
+type ErrInvalidRateLimit struct {
+	ServiceName string
+	Reason      string
+}
+
+func (e ErrInvalidRateLimit) Error() string {
+	return fmt.Sprintf(
+		`service "%s" has an invalid rate limit: %s`, e.ServiceName, e.Reason)
+}
+
+// ErrInvalidLoadShedding is returned when a service's load shedding is
+// invalid.
+type ErrInvalidLoadShedding struct {
+	ServiceName string
+	Reason      string
+}
+
+func (e ErrInvalidLoadShedding) Error() string {
+	return fmt.Sprintf(
+		`service "%s" has invalid load shedding: %s`, e.ServiceName, e.Reason)
+}
+
+// ErrEdgePolicyWithoutCall is returned when a service has an edge policy for
+// a service it never calls.
+type ErrEdgePolicyWithoutCall struct {
+	ServiceName       string
+	CalledServiceName string
+}
+
+func (e ErrEdgePolicyWithoutCall) Error() string {
+	return fmt.Sprintf(
+		`service "%s" has an edge policy for "%s", which it does not call`,
+		e.ServiceName, e.CalledServiceName)
+}
+
 // ErrNestedConcurrentCommand is returned when a ConcurrentCommand contains
 // a ConcurrentCommand.
 var ErrNestedConcurrentCommand = errors.New(
@@ -7,6 +7,7 @@ import (
 	"text/template"
 
 	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/pct"
 	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
 	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
 )
@@ -39,10 +40,11 @@ func GraphToDotLanguage(g Graph) (dotLang string, err error) {
 
 // ServiceGraphToGraph converts a service graph to a graphviz graph.
 func ServiceGraphToGraph(sg graph.ServiceGraph) (Graph, error) {
+	probabilities := graph.NewSuccessProbabilities(sg)
 	nodes := make([]Node, 0, len(sg.Services))
 	edges := make([]Edge, 0, len(sg.Services))
 	for _, service := range sg.Services {
-		node, connections, err := toGraphvizNode(service)
+		node, connections, err := toGraphvizNode(service, probabilities)
 		if err != nil {
 			return Graph{}, err
 		}
@@ -69,7 +71,18 @@ type Node struct {
 	Type         string
 	ErrorRate    string
 	ResponseSize string
-	Steps        [][]string
+	IsEntrypoint bool
+	// Color is the background color of the node's header, if any. It is set by
+	// ApplyHeat.
+	Color string
+	Steps []Step
+}
+
+// Step represents a single step of a node's script. A Step with more than one
+// command was a ConcurrentCommand and is drawn as a cluster.
+type Step struct {
+	Commands     []string
+	IsConcurrent bool
 }
 
 // Edge represents a directed edge in the Graphviz graph.
@@ -77,6 +90,10 @@ type Edge struct {
 	From      string
 	To        string
 	StepIndex int
+	// Size is the size of the request payload.
+	Size string
+	// Probability is the chance that the call is made each time From is called.
+	Probability string
 }
 
 const graphvizTemplate = `digraph {
@@ -85,70 +102,100 @@ const graphvizTemplate = `digraph {
     fontname = "courier"
     shape = plaintext
   ];
+  edge [
+    fontsize = "12"
+    fontname = "courier"
+  ];
 
   {{ range .Nodes -}}
-  {{ .Name }} [label=<
-<TABLE BORDER="0" CELLBORDER="1" CELLSPACING="0">
-  <TR><TD><B>{{ .Name }}</B><BR />Type: {{ .Type }}<BR />Err: {{ .ErrorRate }}</TD></TR>
-  {{- range $i, $cmds := .Steps }}
+  "{{ .Name }}" [label=<
+<TABLE BORDER="{{ if .IsEntrypoint }}3{{ else }}0{{ end }}" CELLBORDER="1" CELLSPACING="0">
+  <TR><TD{{ if .Color }} BGCOLOR="{{ .Color }}"{{ end }}><B>{{ .Name }}</B>
+  {{- if .IsEntrypoint }}<BR /><I>entrypoint</I>{{ end -}}
+  <BR />Type: {{ .Type }}<BR />Err: {{ .ErrorRate }}</TD></TR>
+  {{- range $i, $step := .Steps }}
   <TR><TD PORT="{{ $i }}">
-  {{- range $j, $cmd := $cmds -}}
+  {{- if $step.IsConcurrent -}}
+  <TABLE BORDER="1" STYLE="dashed" CELLBORDER="0" CELLSPACING="0">
+    <TR><TD><I>concurrent</I></TD></TR>
+    {{- range $step.Commands }}
+    <TR><TD>{{ . }}</TD></TR>
+    {{- end }}
+  </TABLE>
+  {{- else -}}
+  {{- range $j, $cmd := $step.Commands -}}
     {{- if $j -}}<BR />{{- end -}}
     {{- $cmd -}}
   {{- end -}}
+  {{- end -}}
   </TD></TR>
   {{- end }}
 </TABLE>>];
 
   {{ end }}
 
+  {{- if .Nodes }}
+  { rank = source;
+  {{- range .Nodes }}{{ if .IsEntrypoint }} "{{ .Name }}";{{ end }}{{ end }} }
+  {{- end }}
+
   {{- range .Edges }}
-  {{ .From -}}:{{- .StepIndex }} -> {{ .To }}
+  "{{ .From -}}":{{- .StepIndex }} -> "{{ .To }}" [label="{{ .Size }}\np={{ .Probability }}"]
   {{- end }}
 }
 `
 
 func getEdgesFromExe(
-	exe script.Command, idx int, fromServiceName string) (edges []Edge) {
+	exe script.Command, idx int, fromServiceName string,
+	probability pct.Percentage) (edges []Edge) {
 	switch cmd := exe.(type) {
 	case script.ConcurrentCommand:
-		for _, subCmd := range cmd {
-			subEdges := getEdgesFromExe(subCmd, idx, fromServiceName)
+		for _, subCmd := range cmd.Commands {
+			subEdges := getEdgesFromExe(subCmd, idx, fromServiceName, probability)
 			for _, e := range subEdges {
 				edges = append(edges, e)
 			}
 		}
 	case script.RequestCommand:
 		e := Edge{
-			From:      fromServiceName,
-			To:        cmd.ServiceName,
-			StepIndex: idx,
+			From:        fromServiceName,
+			To:          cmd.ServiceName,
+			StepIndex:   idx,
+			Size:        cmd.Size.String(),
+			Probability: probability.String(),
 		}
 		edges = append(edges, e)
 	}
 	return
 }
 
-func toGraphvizNode(service svc.Service) (Node, []Edge, error) {
-	steps := make([][]string, 0, len(service.Script))
+func toGraphvizNode(
+	service svc.Service, probabilities graph.SuccessProbabilities) (
+	Node, []Edge, error) {
+	steps := make([]Step, 0, len(service.Script))
 	edges := make([]Edge, 0, len(service.Script))
+	// reached is the probability that the current step is executed, i.e. that
+	// every previous step succeeded.
+	reached := pct.Percentage(1)
 	for idx, exe := range service.Script {
-		step, err := executableToStringSlice(exe)
+		step, err := executableToStep(exe)
 		if err != nil {
 			return Node{}, nil, err
 		}
 		steps = append(steps, step)
 
-		stepEdges := getEdgesFromExe(exe, idx, service.Name)
+		stepEdges := getEdgesFromExe(exe, idx, service.Name, reached)
 		for _, e := range stepEdges {
 			edges = append(edges, e)
 		}
+		reached *= probabilities.OfCommand(exe)
 	}
 	n := Node{
 		Name:         service.Name,
 		Type:         service.Type.String(),
 		ErrorRate:    service.ErrorRate.String(),
 		ResponseSize: service.ResponseSize.String(),
+		IsEntrypoint: service.IsEntrypoint,
 		Steps:        steps,
 	}
 	return n, edges, nil
@@ -168,13 +215,13 @@ func nonConcurrentCommandToString(exe script.Command) (s string, err error) {
 	return
 }
 
-func executableToStringSlice(exe script.Command) (ss []string, err error) {
+func executableToStep(exe script.Command) (step Step, err error) {
 	appendNonConcurrentExe := func(exe script.Command) error {
 		s, err := nonConcurrentCommandToString(exe)
 		if err != nil {
 			return err
 		}
-		ss = append(ss, s)
+		step.Commands = append(step.Commands, s)
 		return nil
 	}
 	switch cmd := exe.(type) {
@@ -183,7 +230,8 @@ func executableToStringSlice(exe script.Command) (ss []string, err error) {
 	case script.RequestCommand:
 		err = appendNonConcurrentExe(exe)
 	case script.ConcurrentCommand:
-		for _, exe := range cmd {
+		step.IsConcurrent = true
+		for _, exe := range cmd.Commands {
 			err = appendNonConcurrentExe(exe)
 			if err != nil {
 				return
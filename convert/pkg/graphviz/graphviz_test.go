@@ -20,9 +20,11 @@ func TestServiceGraphToGraph(t *testing.T) {
 				Type:         "HTTP",
 				ErrorRate:    "0.01%",
 				ResponseSize: "10KiB",
-				Steps: [][]string{
-					[]string{
-						"SLEEP 100ms",
+				Steps: []Step{
+					Step{
+						Commands: []string{
+							"SLEEP 100ms",
+						},
 					},
 				},
 			},
@@ -31,19 +33,23 @@ func TestServiceGraphToGraph(t *testing.T) {
 				Type:         "gRPC",
 				ErrorRate:    "0.00%",
 				ResponseSize: "10KiB",
-				Steps:        [][]string{},
+				Steps:        []Step{},
 			},
 			Node{
 				Name:         "c",
 				Type:         "HTTP",
 				ErrorRate:    "0.00%",
 				ResponseSize: "10KiB",
-				Steps: [][]string{
-					[]string{
-						"CALL \"a\" 10KiB",
+				Steps: []Step{
+					Step{
+						Commands: []string{
+							"CALL \"a\" 10KiB",
+						},
 					},
-					[]string{
-						"CALL \"b\" 1KiB",
+					Step{
+						Commands: []string{
+							"CALL \"b\" 1KiB",
+						},
 					},
 				},
 			},
@@ -52,45 +58,63 @@ func TestServiceGraphToGraph(t *testing.T) {
 				Type:         "HTTP",
 				ErrorRate:    "0.00%",
 				ResponseSize: "10KiB",
-				Steps: [][]string{
-					[]string{
-						"CALL \"a\" 1KiB",
-						"CALL \"c\" 1KiB",
+				IsEntrypoint: true,
+				Steps: []Step{
+					Step{
+						Commands: []string{
+							"CALL \"a\" 1KiB",
+							"CALL \"c\" 1KiB",
+						},
+						IsConcurrent: true,
 					},
-					[]string{
-						"SLEEP 10ms",
+					Step{
+						Commands: []string{
+							"SLEEP 10ms",
+						},
 					},
-					[]string{
-						"CALL \"b\" 1KiB",
+					Step{
+						Commands: []string{
+							"CALL \"b\" 1KiB",
+						},
 					},
 				},
 			},
 		},
 		Edges: []Edge{
 			Edge{
-				From:      "c",
-				To:        "a",
-				StepIndex: 0,
+				From:        "c",
+				To:          "a",
+				StepIndex:   0,
+				Size:        "10KiB",
+				Probability: "100.00%",
 			},
 			Edge{
-				From:      "c",
-				To:        "b",
-				StepIndex: 1,
+				From:        "c",
+				To:          "b",
+				StepIndex:   1,
+				Size:        "1KiB",
+				Probability: "99.99%",
 			},
 			Edge{
-				From:      "d",
-				To:        "a",
-				StepIndex: 0,
+				From:        "d",
+				To:          "a",
+				StepIndex:   0,
+				Size:        "1KiB",
+				Probability: "100.00%",
 			},
 			Edge{
-				From:      "d",
-				To:        "c",
-				StepIndex: 0,
+				From:        "d",
+				To:          "c",
+				StepIndex:   0,
+				Size:        "1KiB",
+				Probability: "100.00%",
 			},
 			Edge{
-				From:      "d",
-				To:        "b",
-				StepIndex: 2,
+				From:        "d",
+				To:          "b",
+				StepIndex:   2,
+				Size:        "1KiB",
+				Probability: "99.98%",
 			},
 		},
 	}
@@ -131,10 +155,11 @@ func TestServiceGraphToGraph(t *testing.T) {
 			{
 				Name:         "d",
 				Type:         svctype.ServiceHTTP,
+				IsEntrypoint: true,
 				ErrorRate:    0,
 				ResponseSize: 10240,
 				Script: []script.Command{
-					script.ConcurrentCommand([]script.Command{
+					script.ConcurrentCommand{Commands: []script.Command{
 						script.RequestCommand{
 							ServiceName: "a",
 							Size:        1024,
@@ -143,7 +168,7 @@ func TestServiceGraphToGraph(t *testing.T) {
 							ServiceName: "c",
 							Size:        1024,
 						},
-					}),
+					}},
 					script.SleepCommand(10 * time.Millisecond),
 					script.RequestCommand{
 						ServiceName: "b",
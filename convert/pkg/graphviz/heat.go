@@ -0,0 +1,103 @@
+package graphviz
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/pct"
+)
+
+// HeatMetric names the measurement used to color nodes.
+type HeatMetric string
+
+const (
+	// HeatLatency colors nodes by their latency.
+	HeatLatency HeatMetric = "latency"
+	// HeatErrorRate colors nodes by their observed error rate.
+	HeatErrorRate HeatMetric = "errorRate"
+)
+
+// coldColor and hotColor are the RGB endpoints nodes are colored between.
+var (
+	coldColor = [3]float64{0xff, 0xff, 0xcc}
+	hotColor  = [3]float64{0xe3, 0x1a, 0x1c}
+)
+
+// Metrics holds measurements of a running service graph, such as the results
+// of a test run, keyed by service name.
+type Metrics struct {
+	Services map[string]ServiceMetrics `json:"services"`
+}
+
+// ServiceMetrics holds the measurements of a single service.
+type ServiceMetrics struct {
+	// LatencySeconds is the representative (e.g. median or p99) time in seconds
+	// the service took to respond.
+	LatencySeconds float64 `json:"latencySeconds"`
+	// ErrorRate is the observed percentage of requests which failed.
+	ErrorRate pct.Percentage `json:"errorRate"`
+}
+
+func (m ServiceMetrics) value(metric HeatMetric) (float64, error) {
+	switch metric {
+	case HeatLatency:
+		return m.LatencySeconds, nil
+	case HeatErrorRate:
+		return float64(m.ErrorRate), nil
+	default:
+		return 0, InvalidHeatMetricError{metric}
+	}
+}
+
+// ApplyHeat sets the Color of each node in g which has an entry in metrics.
+// Colors range from pale yellow, for the smallest value of metric, to red, for
+// the largest.
+func ApplyHeat(g Graph, metrics Metrics, metric HeatMetric) (Graph, error) {
+	values := make(map[string]float64, len(metrics.Services))
+	min, max := math.Inf(1), math.Inf(-1)
+	for name, serviceMetrics := range metrics.Services {
+		value, err := serviceMetrics.value(metric)
+		if err != nil {
+			return g, err
+		}
+		values[name] = value
+		min = math.Min(min, value)
+		max = math.Max(max, value)
+	}
+
+	nodes := make([]Node, 0, len(g.Nodes))
+	for _, node := range g.Nodes {
+		if value, ok := values[node.Name]; ok {
+			heat := 0.0
+			if max > min {
+				heat = (value - min) / (max - min)
+			}
+			node.Color = heatToColor(heat)
+		}
+		nodes = append(nodes, node)
+	}
+	g.Nodes = nodes
+	return g, nil
+}
+
+// heatToColor linearly interpolates between coldColor and hotColor. heat must
+// be between 0 and 1.
+func heatToColor(heat float64) string {
+	var rgb [3]uint8
+	for i := range rgb {
+		rgb[i] = uint8(math.Round(
+			coldColor[i] + heat*(hotColor[i]-coldColor[i])))
+	}
+	return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2])
+}
+
+// InvalidHeatMetricError is returned when a HeatMetric is not known.
+type InvalidHeatMetricError struct {
+	Metric HeatMetric
+}
+
+func (e InvalidHeatMetricError) Error() string {
+	return fmt.Sprintf(
+		"unknown heat metric: %s (must be %s or %s)",
+		e.Metric, HeatLatency, HeatErrorRate)
+}
@@ -0,0 +1,56 @@
+package graphviz
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyHeat(t *testing.T) {
+	g := Graph{
+		Nodes: []Node{
+			{Name: "a"},
+			{Name: "b"},
+			{Name: "c"},
+			{Name: "d"},
+		},
+	}
+	metrics := Metrics{
+		Services: map[string]ServiceMetrics{
+			"a": {LatencySeconds: 0.010, ErrorRate: 0.5},
+			"b": {LatencySeconds: 0.020},
+			"c": {LatencySeconds: 0.030},
+		},
+	}
+
+	tests := []struct {
+		metric HeatMetric
+		colors []string
+		err    error
+	}{
+		{HeatLatency, []string{"#ffffcc", "#f18c74", "#e31a1c", ""}, nil},
+		{HeatErrorRate, []string{"#e31a1c", "#ffffcc", "#ffffcc", ""}, nil},
+		{"p99", nil, InvalidHeatMetricError{"p99"}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(string(test.metric), func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := ApplyHeat(g, metrics, test.metric)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if err != nil {
+				return
+			}
+			colors := make([]string, 0, len(actual.Nodes))
+			for _, node := range actual.Nodes {
+				colors = append(colors, node.Color)
+			}
+			if !reflect.DeepEqual(test.colors, colors) {
+				t.Errorf("expected %v; actual %v", test.colors, colors)
+			}
+		})
+	}
+}
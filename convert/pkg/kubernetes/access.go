@@ -0,0 +1,274 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	"github.com/maxfouquet/isotope/convert/pkg/consts"
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// istioHBONEPort is the port on which ambient mode tunnels traffic between
+// pods.
+const istioHBONEPort = 15008
+
+// accessManifests returns a ServiceAccount for each service in g and a
+// NetworkPolicy which admits traffic to it only from its callers, the
+// Prometheus scraper and, for entrypoints, the client.
+func accessManifests(g graph.ServiceGraph, profile Profile) []interface{} {
+	callers := callersByService(g)
+	entrypoints := map[string]bool{}
+	for _, name := range graph.Entrypoints(g) {
+		entrypoints[name] = true
+	}
+
+	manifests := make([]interface{}, 0, 2*len(g.Services))
+	for _, service := range g.Services {
+		manifests = append(
+			manifests,
+			makeServiceAccount(service.Name, profile.Namespace.Name, profile))
+
+		peers := make([]map[string]interface{}, 0, len(callers[service.Name])+2)
+		for _, caller := range callers[service.Name] {
+			peers = append(peers, map[string]interface{}{
+				"podSelector": map[string]interface{}{
+					"matchLabels": map[string]string{"name": caller},
+				},
+			})
+		}
+		if entrypoints[service.Name] {
+			peers = append(peers, clientNetworkPolicyPeer(profile))
+		}
+		ports := []map[string]interface{}{
+			{"protocol": "TCP", "port": profile.Service.Port},
+		}
+		if profile.Mesh == MeshIstioAmbient {
+			// Calls arrive from the waypoint proxy, tunnelled over HBONE.
+			peers = append(peers, map[string]interface{}{
+				"podSelector": map[string]interface{}{
+					"matchLabels": map[string]string{
+						"gateway.networking.k8s.io/gateway-name": istioWaypointName,
+					},
+				},
+			})
+			ports = append(
+				ports, map[string]interface{}{"protocol": "TCP", "port": istioHBONEPort})
+		}
+
+		// A rule with no peers would admit every source, so a service which
+		// nothing calls has no rule for its service port, and the admin port
+		// has none unless the profile names its sources. Traffic from the node,
+		// such as the kubelet's readiness probes, is admitted regardless.
+		ingress := make([]map[string]interface{}, 0, 3)
+		if len(peers) > 0 {
+			ingress = append(
+				ingress, map[string]interface{}{"from": peers, "ports": ports})
+		}
+		// The scraper gets the metrics from the service port.
+		ingress = append(ingress, map[string]interface{}{
+			"from":  []map[string]interface{}{scraperNetworkPolicyPeer(profile)},
+			"ports": ports,
+		})
+		if sources := profile.Service.AdminSources; len(sources) > 0 {
+			adminPeers := make([]map[string]interface{}, 0, len(sources))
+			for _, cidr := range sources {
+				adminPeers = append(adminPeers, map[string]interface{}{
+					"ipBlock": map[string]string{"cidr": cidr},
+				})
+			}
+			ingress = append(ingress, map[string]interface{}{
+				"from": adminPeers,
+				"ports": []map[string]interface{}{
+					{"protocol": "TCP", "port": profile.Service.AdminPort},
+				},
+			})
+		}
+
+		manifests = append(manifests, customResource{
+			APIVersion: "networking.k8s.io/v1",
+			Kind:       "NetworkPolicy",
+			Metadata: customResourceMeta{
+				Name:        service.Name,
+				Namespace:   profile.Namespace.Name,
+				Labels:      combineLabels(profile.Labels, serviceGraphAppLabels),
+				Annotations: profile.Annotations,
+			},
+			Spec: map[string]interface{}{
+				"podSelector": map[string]interface{}{
+					"matchLabels": map[string]string{"name": service.Name},
+				},
+				"policyTypes": []string{"Ingress"},
+				"ingress":     ingress,
+			},
+		})
+	}
+	return manifests
+}
+
+// clientNetworkPolicyPeer selects the client's pods. If the client's namespace
+// is not known, pods with its labels in any namespace are selected.
+func clientNetworkPolicyPeer(profile Profile) map[string]interface{} {
+	return namespacedNetworkPolicyPeer(
+		profile.Client.Namespace, fortioClientLabels)
+}
+
+// scraperNetworkPolicyPeer selects the Prometheus scraper's pods, in any
+// namespace if the scraper's is not known.
+func scraperNetworkPolicyPeer(profile Profile) map[string]interface{} {
+	return namespacedNetworkPolicyPeer(
+		profile.Scraper.Namespace, profile.Scraper.PodLabels)
+}
+
+func namespacedNetworkPolicyPeer(
+	namespace string, labels map[string]string) map[string]interface{} {
+	namespaceSelector := map[string]interface{}{}
+	if namespace != "" {
+		namespaceSelector["matchLabels"] = map[string]string{
+			"kubernetes.io/metadata.name": namespace,
+		}
+	}
+	return map[string]interface{}{
+		"namespaceSelector": namespaceSelector,
+		"podSelector": map[string]interface{}{
+			"matchLabels": labels,
+		},
+	}
+}
+
+// istioAuthorizationPolicies returns an AuthorizationPolicy for each service
+// in g which allows calls only from the service accounts of its callers and,
+// for entrypoints, the client, and only metrics requests from the Prometheus
+// scraper. In ambient mode, the policies are enforced by the waypoint proxy,
+// which sees the callers' identities. The admin API is reached through the
+// Kubernetes API server, in plaintext and so with no principal, so its port
+// admits only the profile's admin sources by address. Istio serves the
+// kubelet's readiness probes itself.
+func istioAuthorizationPolicies(
+	g graph.ServiceGraph, profile Profile) []interface{} {
+	callers := callersByService(g)
+	entrypoints := map[string]bool{}
+	for _, name := range graph.Entrypoints(g) {
+		entrypoints[name] = true
+	}
+
+	manifests := make([]interface{}, 0, len(g.Services))
+	for _, service := range g.Services {
+		principals := make([]string, 0, len(callers[service.Name])+1)
+		for _, caller := range callers[service.Name] {
+			principals = append(
+				principals, istioPrincipal(profile.Namespace.Name, caller))
+		}
+		if entrypoints[service.Name] {
+			principals = append(
+				principals, istioPrincipal(profile.Client.Namespace, profile.Client.Name))
+		}
+
+		rules := make([]map[string]interface{}, 0, 3)
+		if len(principals) > 0 {
+			rules = append(rules, map[string]interface{}{
+				"from": []map[string]interface{}{
+					{"source": map[string]interface{}{"principals": principals}},
+				},
+			})
+		}
+		rules = append(rules, istioScraperRule(profile))
+		if sources := profile.Service.AdminSources; len(sources) > 0 {
+			rules = append(rules, map[string]interface{}{
+				"from": []map[string]interface{}{
+					{"source": map[string]interface{}{"ipBlocks": sources}},
+				},
+				"to": []map[string]interface{}{
+					{
+						"operation": map[string]interface{}{
+							"ports": []string{fmt.Sprint(profile.Service.AdminPort)},
+						},
+					},
+				},
+			})
+		}
+		spec := map[string]interface{}{"action": "ALLOW", "rules": rules}
+		if profile.Mesh == MeshIstioAmbient {
+			spec["targetRefs"] = []map[string]interface{}{
+				{"kind": "Service", "group": "", "name": service.Name},
+			}
+		} else {
+			spec["selector"] = map[string]interface{}{
+				"matchLabels": map[string]string{"name": service.Name},
+			}
+		}
+
+		manifests = append(manifests, customResource{
+			APIVersion: istioSecurityAPIVersion,
+			Kind:       "AuthorizationPolicy",
+			Metadata: customResourceMeta{
+				Name:        service.Name,
+				Namespace:   profile.Namespace.Name,
+				Labels:      combineLabels(profile.Labels, serviceGraphAppLabels),
+				Annotations: profile.Annotations,
+			},
+			Spec: spec,
+		})
+	}
+	return manifests
+}
+
+// istioScraperRule allows the Prometheus scraper to get the metrics of a
+// service, and nothing else.
+func istioScraperRule(profile Profile) map[string]interface{} {
+	return map[string]interface{}{
+		"from": []map[string]interface{}{
+			{
+				"source": map[string]interface{}{
+					"principals": []string{
+						istioPrincipal(
+							profile.Scraper.Namespace, profile.Scraper.ServiceAccount),
+					},
+				},
+			},
+		},
+		"to": []map[string]interface{}{
+			{
+				"operation": map[string]interface{}{
+					"ports":   []string{fmt.Sprint(profile.Service.Port)},
+					"methods": []string{"GET"},
+					"paths":   []string{consts.ServiceMetricsPath},
+				},
+			},
+		},
+	}
+}
+
+// istioPrincipal returns the SPIFFE identity of the service account name in
+// namespace. If namespace is not known, any namespace matches.
+func istioPrincipal(namespace, name string) string {
+	if namespace == "" {
+		return fmt.Sprintf("*/sa/%s", name)
+	}
+	return fmt.Sprintf("cluster.local/ns/%s/sa/%s", namespace, name)
+}
+
+// callersByService returns the names of the services which call each service
+// in g, in the order the callers are declared.
+func callersByService(g graph.ServiceGraph) map[string][]string {
+	callers := map[string][]string{}
+	for _, service := range g.Services {
+		for _, callee := range graph.Callees(service) {
+			callers[callee] = append(callers[callee], service.Name)
+		}
+	}
+	return callers
+}
+
+func makeServiceAccount(
+	name, namespace string, profile Profile) (
+	serviceAccount apiv1.ServiceAccount) {
+	serviceAccount.APIVersion = "v1"
+	serviceAccount.Kind = "ServiceAccount"
+	serviceAccount.ObjectMeta.Name = name
+	serviceAccount.ObjectMeta.Namespace = namespace
+	serviceAccount.ObjectMeta.Labels = combineLabels(
+		profile.Labels, serviceGraphAppLabels)
+	serviceAccount.ObjectMeta.Annotations = profile.Annotations
+	timestamp(&serviceAccount.ObjectMeta)
+	return
+}
@@ -0,0 +1,261 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+)
+
+var accessServiceGraph = graph.ServiceGraph{Services: []svc.Service{
+	{
+		Name:   "a",
+		Script: script.Script{script.RequestCommand{ServiceName: "c"}},
+	},
+	{
+		Name:   "b",
+		Script: script.Script{script.RequestCommand{ServiceName: "c"}},
+	},
+	{Name: "c"},
+}}
+
+func TestAccessManifests(t *testing.T) {
+	manifests := accessManifests(accessServiceGraph, DefaultProfile())
+
+	var peers [][]map[string]interface{}
+	for _, manifest := range manifests {
+		if policy, ok := manifest.(customResource); ok {
+			ingress := policy.Spec["ingress"].([]map[string]interface{})
+			peers = append(
+				peers, ingress[0]["from"].([]map[string]interface{}))
+		}
+	}
+	client := clientNetworkPolicyPeer(DefaultProfile())
+	podPeer := func(name string) map[string]interface{} {
+		return map[string]interface{}{
+			"podSelector": map[string]interface{}{
+				"matchLabels": map[string]string{"name": name},
+			},
+		}
+	}
+	expected := [][]map[string]interface{}{
+		{client},
+		{client},
+		{podPeer("a"), podPeer("b")},
+	}
+	if !reflect.DeepEqual(expected, peers) {
+		t.Errorf("expected %v; actual %v", expected, peers)
+	}
+}
+
+func TestAccessManifests_Scraper(t *testing.T) {
+	tests := []struct {
+		mesh  MeshName
+		ports []map[string]interface{}
+	}{
+		{
+			MeshIstio,
+			[]map[string]interface{}{{"protocol": "TCP", "port": int32(8080)}},
+		},
+		{
+			MeshIstioAmbient,
+			[]map[string]interface{}{
+				{"protocol": "TCP", "port": int32(8080)},
+				{"protocol": "TCP", "port": istioHBONEPort},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(string(test.mesh), func(t *testing.T) {
+			t.Parallel()
+
+			profile := DefaultProfile()
+			profile.Mesh = test.mesh
+			profile.Scraper = ScraperProfile{
+				Namespace:      "monitoring",
+				PodLabels:      map[string]string{"app": "prometheus"},
+				ServiceAccount: "prometheus",
+			}
+			expected := map[string]interface{}{
+				"from": []map[string]interface{}{
+					{
+						"namespaceSelector": map[string]interface{}{
+							"matchLabels": map[string]string{
+								"kubernetes.io/metadata.name": "monitoring",
+							},
+						},
+						"podSelector": map[string]interface{}{
+							"matchLabels": map[string]string{"app": "prometheus"},
+						},
+					},
+				},
+				"ports": test.ports,
+			}
+			for _, manifest := range accessManifests(accessServiceGraph, profile) {
+				policy, ok := manifest.(customResource)
+				if !ok {
+					continue
+				}
+				ingress := policy.Spec["ingress"].([]map[string]interface{})
+				if len(ingress) < 2 || !reflect.DeepEqual(expected, ingress[1]) {
+					t.Errorf("expected the scraper to be admitted; actual %v", ingress)
+				}
+			}
+		})
+	}
+}
+
+func TestAccessManifests_AdminSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []string
+		rule    map[string]interface{}
+	}{
+		{"no sources", nil, nil},
+		{
+			"sources",
+			[]string{"10.0.0.1/32", "10.1.0.0/16"},
+			map[string]interface{}{
+				"from": []map[string]interface{}{
+					{"ipBlock": map[string]string{"cidr": "10.0.0.1/32"}},
+					{"ipBlock": map[string]string{"cidr": "10.1.0.0/16"}},
+				},
+				"ports": []map[string]interface{}{
+					{"protocol": "TCP", "port": int32(8081)},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			profile := DefaultProfile()
+			profile.Service.AdminSources = test.sources
+			for _, manifest := range accessManifests(accessServiceGraph, profile) {
+				policy, ok := manifest.(customResource)
+				if !ok {
+					continue
+				}
+				ingress := policy.Spec["ingress"].([]map[string]interface{})
+				var rule map[string]interface{}
+				if len(ingress) > 2 {
+					rule = ingress[2]
+				}
+				if !reflect.DeepEqual(test.rule, rule) {
+					t.Errorf("expected %v; actual %v", test.rule, rule)
+				}
+			}
+		})
+	}
+}
+
+func TestIstioAuthorizationPolicies(t *testing.T) {
+	tests := []struct {
+		mesh      MeshName
+		targetKey string
+	}{
+		{MeshIstio, "selector"},
+		{MeshIstioAmbient, "targetRefs"},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(string(test.mesh), func(t *testing.T) {
+			t.Parallel()
+
+			profile := DefaultProfile()
+			profile.Mesh = test.mesh
+			profile.Client.Namespace = "load"
+			manifests := istioAuthorizationPolicies(accessServiceGraph, profile)
+
+			var principals [][]string
+			for _, manifest := range manifests {
+				spec := manifest.(customResource).Spec
+				if _, ok := spec[test.targetKey]; !ok {
+					t.Errorf("expected %s in %v", test.targetKey, spec)
+				}
+				rules := spec["rules"].([]map[string]interface{})
+				if len(rules) != 2 {
+					t.Fatalf("expected the callers' and scraper's rules; actual %v", rules)
+				}
+				from := rules[0]["from"].([]map[string]interface{})
+				source := from[0]["source"].(map[string]interface{})
+				principals = append(principals, source["principals"].([]string))
+			}
+			expected := [][]string{
+				{"cluster.local/ns/load/sa/client"},
+				{"cluster.local/ns/load/sa/client"},
+				{
+					"cluster.local/ns/service-graph/sa/a",
+					"cluster.local/ns/service-graph/sa/b",
+				},
+			}
+			if !reflect.DeepEqual(expected, principals) {
+				t.Errorf("expected %v; actual %v", expected, principals)
+			}
+		})
+	}
+}
+
+func TestIstioAuthorizationPolicies_AdminSources(t *testing.T) {
+	profile := DefaultProfile()
+	profile.Service.AdminSources = []string{"10.0.0.1/32"}
+	expected := map[string]interface{}{
+		"from": []map[string]interface{}{
+			{
+				"source": map[string]interface{}{
+					"ipBlocks": []string{"10.0.0.1/32"},
+				},
+			},
+		},
+		"to": []map[string]interface{}{
+			{
+				"operation": map[string]interface{}{
+					"ports": []string{"8081"},
+				},
+			},
+		},
+	}
+	for _, manifest := range istioAuthorizationPolicies(accessServiceGraph, profile) {
+		rules := manifest.(customResource).Spec["rules"].([]map[string]interface{})
+		if len(rules) != 3 || !reflect.DeepEqual(expected, rules[2]) {
+			t.Errorf("expected the admin sources to be admitted; actual %v", rules)
+		}
+	}
+}
+
+func TestIstioAuthorizationPolicies_Scraper(t *testing.T) {
+	profile := DefaultProfile()
+	profile.Scraper.Namespace = "monitoring"
+	expected := map[string]interface{}{
+		"from": []map[string]interface{}{
+			{
+				"source": map[string]interface{}{
+					"principals": []string{"cluster.local/ns/monitoring/sa/prometheus"},
+				},
+			},
+		},
+		"to": []map[string]interface{}{
+			{
+				"operation": map[string]interface{}{
+					"ports":   []string{"8080"},
+					"methods": []string{"GET"},
+					"paths":   []string{"/metrics"},
+				},
+			},
+		},
+	}
+	for _, manifest := range istioAuthorizationPolicies(accessServiceGraph, profile) {
+		rules := manifest.(customResource).Spec["rules"].([]map[string]interface{})
+		if len(rules) != 2 || !reflect.DeepEqual(expected, rules[1]) {
+			t.Errorf("expected the scraper to be allowed metrics; actual %v", rules)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	"github.com/maxfouquet/isotope/convert/pkg/consts"
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// ConfigMapLayout describes how the service graph is split across the
+// ConfigMaps mounted by the services.
+type ConfigMapLayout string
+
+const (
+	// ConfigMapsSingle puts the whole graph in one ConfigMap, which every
+	// service mounts.
+	ConfigMapsSingle ConfigMapLayout = "single"
+	// ConfigMapsPerService gives each service a ConfigMap holding only its
+	// slice of the graph; see graph.Slice.
+	ConfigMapsPerService ConfigMapLayout = "per-service"
+	// ConfigMapsSharded packs the services' slices into as few ConfigMaps as
+	// fit, each slice under its service's name.
+	ConfigMapsSharded ConfigMapLayout = "sharded"
+)
+
+// maxConfigMapDataBytes is the most data put in one ConfigMap. Kubernetes
+// limits objects to 1 MiB; the rest is left for metadata.
+const maxConfigMapDataBytes = 1000 * 1000
+
+// configMapRef locates the YAML a service mounts as its service graph.
+type configMapRef struct {
+	Name string
+	Key  string
+}
+
+// makeConfigMaps splits g into ConfigMaps according to the layout of profile.
+// It returns the ConfigMaps and, for each service, the entry it mounts.
+func makeConfigMaps(g graph.ServiceGraph, profile Profile) (
+	configMaps []apiv1.ConfigMap, refs map[string]configMapRef, err error) {
+	refs = make(map[string]configMapRef, len(g.Services))
+	switch profile.ConfigMaps {
+	case ConfigMapsSingle:
+		graphYAML, err := yaml.Marshal(g)
+		if err != nil {
+			return nil, nil, err
+		}
+		configMap := makeConfigMap(serviceGraphConfigName, profile)
+		configMap.Data[consts.ServiceGraphConfigMapKey] = string(graphYAML)
+		if len(graphYAML) > maxConfigMapDataBytes {
+			return nil, nil, ConfigMapTooLargeError{
+				serviceGraphConfigName, len(graphYAML)}
+		}
+		for _, service := range g.Services {
+			refs[service.Name] = configMapRef{
+				serviceGraphConfigName, consts.ServiceGraphConfigMapKey}
+		}
+		return []apiv1.ConfigMap{configMap}, refs, nil
+
+	case ConfigMapsPerService:
+		configMaps = make([]apiv1.ConfigMap, 0, len(g.Services))
+		for _, service := range g.Services {
+			sliceYAML, err := serviceGraphSliceYAML(g, service.Name)
+			if err != nil {
+				return nil, nil, err
+			}
+			name := fmt.Sprintf("%s-%s", serviceGraphConfigName, service.Name)
+			if len(sliceYAML) > maxConfigMapDataBytes {
+				return nil, nil, ConfigMapTooLargeError{name, len(sliceYAML)}
+			}
+			configMap := makeConfigMap(name, profile)
+			configMap.Data[consts.ServiceGraphConfigMapKey] = sliceYAML
+			configMaps = append(configMaps, configMap)
+			refs[service.Name] = configMapRef{
+				name, consts.ServiceGraphConfigMapKey}
+		}
+		return configMaps, refs, nil
+
+	case ConfigMapsSharded:
+		shardBytes := 0
+		for _, service := range g.Services {
+			sliceYAML, err := serviceGraphSliceYAML(g, service.Name)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(sliceYAML) > maxConfigMapDataBytes {
+				return nil, nil, ConfigMapTooLargeError{
+					service.Name, len(sliceYAML)}
+			}
+			if len(configMaps) == 0 ||
+				shardBytes+len(sliceYAML) > maxConfigMapDataBytes {
+				configMaps = append(configMaps, makeConfigMap(
+					fmt.Sprintf("%s-%d", serviceGraphConfigName, len(configMaps)),
+					profile))
+				shardBytes = 0
+			}
+			shard := configMaps[len(configMaps)-1]
+			shard.Data[service.Name] = sliceYAML
+			shardBytes += len(sliceYAML)
+			refs[service.Name] = configMapRef{shard.ObjectMeta.Name, service.Name}
+		}
+		return configMaps, refs, nil
+
+	default:
+		return nil, nil, InvalidProfileError{
+			"configMaps", fmt.Sprintf("unknown layout %q", profile.ConfigMaps)}
+	}
+}
+
+func serviceGraphSliceYAML(g graph.ServiceGraph, name string) (string, error) {
+	slice, err := graph.Slice(g, name)
+	if err != nil {
+		return "", err
+	}
+	sliceYAML, err := yaml.Marshal(slice)
+	return string(sliceYAML), err
+}
+
+func makeConfigMap(name string, profile Profile) (configMap apiv1.ConfigMap) {
+	configMap.APIVersion = "v1"
+	configMap.Kind = "ConfigMap"
+	configMap.ObjectMeta.Name = name
+	configMap.ObjectMeta.Namespace = profile.Namespace.Name
+	configMap.ObjectMeta.Labels = combineLabels(
+		profile.Labels, serviceGraphAppLabels)
+	configMap.ObjectMeta.Annotations = profile.Annotations
+	timestamp(&configMap.ObjectMeta)
+	configMap.Data = map[string]string{}
+	return
+}
+
+// ConfigMapTooLargeError is returned when the service graph YAML held by a
+// ConfigMap would exceed the size limit of Kubernetes objects.
+type ConfigMapTooLargeError struct {
+	Name string
+	Size int
+}
+
+func (e ConfigMapTooLargeError) Error() string {
+	return fmt.Sprintf(
+		"config map %s would hold %d bytes, more than the limit of %d "+
+			"(try another config map layout)",
+		e.Name, e.Size, maxConfigMapDataBytes)
+}
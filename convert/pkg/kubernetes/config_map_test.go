@@ -0,0 +1,98 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/maxfouquet/isotope/convert/pkg/consts"
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
+)
+
+func TestMakeConfigMaps(t *testing.T) {
+	serviceGraph := graph.ServiceGraph{Services: []svc.Service{
+		{
+			Name:        "a",
+			Type:        svctype.ServiceHTTP,
+			NumReplicas: 1,
+			Script:      script.Script{script.RequestCommand{ServiceName: "b"}},
+		},
+		{Name: "b", Type: svctype.ServiceGRPC, NumReplicas: 1},
+	}}
+
+	tests := []struct {
+		layout ConfigMapLayout
+		names  []string
+		refs   map[string]configMapRef
+	}{
+		{
+			ConfigMapsSingle,
+			[]string{"service-graph-config"},
+			map[string]configMapRef{
+				"a": {"service-graph-config", consts.ServiceGraphConfigMapKey},
+				"b": {"service-graph-config", consts.ServiceGraphConfigMapKey},
+			},
+		},
+		{
+			ConfigMapsPerService,
+			[]string{"service-graph-config-a", "service-graph-config-b"},
+			map[string]configMapRef{
+				"a": {"service-graph-config-a", consts.ServiceGraphConfigMapKey},
+				"b": {"service-graph-config-b", consts.ServiceGraphConfigMapKey},
+			},
+		},
+		{
+			ConfigMapsSharded,
+			[]string{"service-graph-config-0"},
+			map[string]configMapRef{
+				"a": {"service-graph-config-0", "a"},
+				"b": {"service-graph-config-0", "b"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(string(test.layout), func(t *testing.T) {
+			t.Parallel()
+
+			profile := DefaultProfile()
+			profile.ConfigMaps = test.layout
+			configMaps, refs, err := makeConfigMaps(serviceGraph, profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, configMap := range configMaps {
+				names = append(names, configMap.ObjectMeta.Name)
+			}
+			if !reflect.DeepEqual(test.names, names) {
+				t.Errorf("expected %v; actual %v", test.names, names)
+			}
+			if !reflect.DeepEqual(test.refs, refs) {
+				t.Errorf("expected %v; actual %v", test.refs, refs)
+			}
+
+			// Every service must find itself in the graph it mounts.
+			for _, service := range serviceGraph.Services {
+				ref := refs[service.Name]
+				for _, configMap := range configMaps {
+					if configMap.ObjectMeta.Name != ref.Name {
+						continue
+					}
+					var mounted graph.ServiceGraph
+					err := yaml.Unmarshal([]byte(configMap.Data[ref.Key]), &mounted)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if _, err := graph.Slice(mounted, service.Name); err != nil {
+						t.Error(err)
+					}
+				}
+			}
+		})
+	}
+}
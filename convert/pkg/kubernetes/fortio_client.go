@@ -1,8 +1,6 @@
-// Package kubernetes converts service graphs into Kubernetes manifests.
 package kubernetes
 
 import (
-	"github.com/maxfouquet/isotope/convert/pkg/consts"
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -10,13 +8,15 @@ import (
 
 var fortioClientLabels = map[string]string{"app": "client"}
 
-func makeFortioDeployment(
-	nodeSelector map[string]string,
-	clientImage string) (deployment appsv1.Deployment) {
+func makeFortioDeployment(profile Profile) (deployment appsv1.Deployment) {
+	client := profile.Client
 	deployment.APIVersion = "apps/v1"
 	deployment.Kind = "Deployment"
-	deployment.ObjectMeta.Name = "client"
-	deployment.ObjectMeta.Labels = fortioClientLabels
+	deployment.ObjectMeta.Name = client.Name
+	deployment.ObjectMeta.Namespace = client.Namespace
+	deployment.ObjectMeta.Labels = combineLabels(
+		profile.Labels, fortioClientLabels)
+	deployment.ObjectMeta.Annotations = profile.Annotations
 	timestamp(&deployment.ObjectMeta)
 	deployment.Spec = appsv1.DeploymentSpec{
 		Selector: &metav1.LabelSelector{
@@ -24,21 +24,26 @@ func makeFortioDeployment(
 		},
 		Template: apiv1.PodTemplateSpec{
 			ObjectMeta: metav1.ObjectMeta{
-				Labels: fortioClientLabels,
+				Annotations: client.PodAnnotations,
+				Labels: combineLabels(
+					profile.Labels, client.PodLabels, fortioClientLabels),
 			},
 			Spec: apiv1.PodSpec{
-				NodeSelector: nodeSelector,
+				NodeSelector: client.NodeSelector,
+				Tolerations:  client.Tolerations,
+				Affinity:     client.Affinity,
 				Containers: []apiv1.Container{
 					{
-						Name:  "fortio-client",
-						Image: clientImage,
-						Args:  []string{"server"},
+						Name:            "fortio-client",
+						Image:           client.Image,
+						ImagePullPolicy: client.ImagePullPolicy,
+						Args:            client.Args,
 						Ports: []apiv1.ContainerPort{
 							{
-								ContainerPort: consts.ServicePort,
+								ContainerPort: client.Port,
 							},
 							{
-								ContainerPort: consts.FortioMetricsPort,
+								ContainerPort: client.MetricsPort,
 							},
 						},
 					},
@@ -47,16 +52,22 @@ func makeFortioDeployment(
 		},
 	}
 	timestamp(&deployment.Spec.Template.ObjectMeta)
+	if profile.AccessPolicies {
+		deployment.Spec.Template.Spec.ServiceAccountName = client.Name
+	}
 	return
 }
 
-func makeFortioService() (service apiv1.Service) {
+func makeFortioService(profile Profile) (service apiv1.Service) {
 	service.APIVersion = "v1"
 	service.Kind = "Service"
-	service.ObjectMeta.Name = "client"
-	service.ObjectMeta.Labels = fortioClientLabels
+	service.ObjectMeta.Name = profile.Client.Name
+	service.ObjectMeta.Namespace = profile.Client.Namespace
+	service.ObjectMeta.Labels = combineLabels(
+		profile.Labels, fortioClientLabels)
+	service.ObjectMeta.Annotations = profile.Annotations
 	timestamp(&service.ObjectMeta)
-	service.Spec.Ports = []apiv1.ServicePort{{Port: consts.ServicePort}}
+	service.Spec.Ports = []apiv1.ServicePort{{Port: profile.Client.Port}}
 	service.Spec.Selector = fortioClientLabels
 	return
 }
@@ -0,0 +1,258 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/pct"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+)
+
+const (
+	istioNetworkingAPIVersion = "networking.istio.io/v1beta1"
+	istioSecurityAPIVersion   = "security.istio.io/v1beta1"
+
+	// istioSystemHosts are the hosts of the Istio control plane, which every
+	// proxy must reach.
+	istioSystemHosts = "istio-system/*"
+)
+
+// istioTrafficManifests returns the VirtualServices, DestinationRules and
+// PeerAuthentications which apply the policies of the services in g.
+func istioTrafficManifests(
+	g graph.ServiceGraph, profile Profile) []interface{} {
+	var manifests []interface{}
+	for _, service := range g.Services {
+		meta := customResourceMeta{
+			Name:        service.Name,
+			Namespace:   profile.Namespace.Name,
+			Labels:      combineLabels(profile.Labels, serviceGraphAppLabels),
+			Annotations: profile.Annotations,
+		}
+		if virtualService, ok := makeVirtualService(g, service, meta); ok {
+			manifests = append(manifests, virtualService)
+		}
+		if service.Policy == nil {
+			continue
+		}
+		if destinationRule, ok := makeDestinationRule(
+			*service.Policy, service.Name, meta); ok {
+			manifests = append(manifests, destinationRule)
+		}
+		if service.Policy.MTLS != "" {
+			manifests = append(manifests, customResource{
+				APIVersion: istioSecurityAPIVersion,
+				Kind:       "PeerAuthentication",
+				Metadata:   meta,
+				Spec: map[string]interface{}{
+					"selector": map[string]interface{}{
+						"matchLabels": map[string]string{"name": service.Name},
+					},
+					"mtls": map[string]interface{}{"mode": service.Policy.MTLS},
+				},
+			})
+		}
+	}
+	return manifests
+}
+
+// istioSidecars returns a Sidecar for each service in g which restricts the
+// egress hosts of its proxy to the services it calls. Without them, every proxy
+// receives configuration for every service in the mesh.
+func istioSidecars(g graph.ServiceGraph, profile Profile) []interface{} {
+	manifests := make([]interface{}, 0, len(g.Services))
+	for _, service := range g.Services {
+		callees := graph.Callees(service)
+		hosts := make([]string, 0, len(callees)+1)
+		for _, callee := range callees {
+			hosts = append(
+				hosts, fmt.Sprintf("./%s.%s.svc.cluster.local",
+					callee, profile.Namespace.Name))
+		}
+		hosts = append(hosts, istioSystemHosts)
+
+		manifests = append(manifests, customResource{
+			APIVersion: istioNetworkingAPIVersion,
+			Kind:       "Sidecar",
+			Metadata: customResourceMeta{
+				Name:        service.Name,
+				Namespace:   profile.Namespace.Name,
+				Labels:      combineLabels(profile.Labels, serviceGraphAppLabels),
+				Annotations: profile.Annotations,
+			},
+			Spec: map[string]interface{}{
+				"workloadSelector": map[string]interface{}{
+					"labels": map[string]string{"name": service.Name},
+				},
+				"egress": []map[string]interface{}{{"hosts": hosts}},
+			},
+		})
+	}
+	return manifests
+}
+
+// makeVirtualService returns the VirtualService of service, which applies its
+// route policy to every call and each caller's edge policy to that caller's
+// calls. ok is false if neither is set.
+func makeVirtualService(
+	g graph.ServiceGraph, service svc.Service, meta customResourceMeta) (
+	virtualService customResource, ok bool) {
+	var base policy.Route
+	if service.Policy != nil {
+		base = service.Policy.Route
+	}
+
+	var routes []map[string]interface{}
+	for _, caller := range g.Services {
+		edge, hasEdge := caller.EdgePolicies[service.Name]
+		if !hasEdge {
+			continue
+		}
+		route := makeHTTPRoute(service.Name, base.Override(edge))
+		route["match"] = []map[string]interface{}{
+			{"sourceLabels": map[string]string{"name": caller.Name}},
+		}
+		routes = append(routes, route)
+	}
+	if len(routes) == 0 && base.IsZero() {
+		return customResource{}, false
+	}
+	routes = append(routes, makeHTTPRoute(service.Name, base))
+
+	return customResource{
+		APIVersion: istioNetworkingAPIVersion,
+		Kind:       "VirtualService",
+		Metadata:   meta,
+		Spec: map[string]interface{}{
+			"hosts": []string{service.Name},
+			"http":  routes,
+		},
+	}, true
+}
+
+func makeHTTPRoute(host string, r policy.Route) map[string]interface{} {
+	route := map[string]interface{}{
+		"route": []map[string]interface{}{
+			{"destination": map[string]interface{}{"host": host}},
+		},
+	}
+	if r.Timeout != 0 {
+		route["timeout"] = istioDuration(r.Timeout)
+	}
+	if r.Retries != nil {
+		retries := map[string]interface{}{"attempts": r.Retries.Attempts}
+		if r.Retries.PerTryTimeout != 0 {
+			retries["perTryTimeout"] = istioDuration(r.Retries.PerTryTimeout)
+		}
+		if r.Retries.RetryOn != "" {
+			retries["retryOn"] = r.Retries.RetryOn
+		}
+		route["retries"] = retries
+	}
+	if r.Fault != nil {
+		fault := map[string]interface{}{}
+		if delay := r.Fault.Delay; delay != nil {
+			fault["delay"] = map[string]interface{}{
+				"percentage": istioPercent(delay.Percentage),
+				"fixedDelay": istioDuration(delay.FixedDelay),
+			}
+		}
+		if abort := r.Fault.Abort; abort != nil {
+			fault["abort"] = map[string]interface{}{
+				"percentage": istioPercent(abort.Percentage),
+				"httpStatus": abort.HTTPStatus,
+			}
+		}
+		route["fault"] = fault
+	}
+	return route
+}
+
+// makeDestinationRule returns the DestinationRule which applies the outlier
+// detection, connection pool and load balancer of p. ok is false if p sets
+// none of them.
+func makeDestinationRule(
+	p policy.Policy, host string, meta customResourceMeta) (
+	destinationRule customResource, ok bool) {
+	trafficPolicy := map[string]interface{}{}
+	if o := p.OutlierDetection; o != nil {
+		outlierDetection := map[string]interface{}{}
+		if o.Consecutive5xxErrors != 0 {
+			outlierDetection["consecutive5xxErrors"] = o.Consecutive5xxErrors
+		}
+		if o.Interval != 0 {
+			outlierDetection["interval"] = istioDuration(o.Interval)
+		}
+		if o.BaseEjectionTime != 0 {
+			outlierDetection["baseEjectionTime"] = istioDuration(o.BaseEjectionTime)
+		}
+		if o.MaxEjectionPercent != 0 {
+			outlierDetection["maxEjectionPercent"] = o.MaxEjectionPercent
+		}
+		trafficPolicy["outlierDetection"] = outlierDetection
+	}
+	if c := p.ConnectionPool; c != nil {
+		tcp := map[string]interface{}{}
+		if c.MaxConnections != 0 {
+			tcp["maxConnections"] = c.MaxConnections
+		}
+		if c.ConnectTimeout != 0 {
+			tcp["connectTimeout"] = istioDuration(c.ConnectTimeout)
+		}
+		http := map[string]interface{}{}
+		for key, value := range map[string]int32{
+			"http1MaxPendingRequests":  c.HTTP1MaxPendingRequests,
+			"http2MaxRequests":         c.HTTP2MaxRequests,
+			"maxRequestsPerConnection": c.MaxRequestsPerConnection,
+			"maxRetries":               c.MaxRetries,
+		} {
+			if value != 0 {
+				http[key] = value
+			}
+		}
+		trafficPolicy["connectionPool"] = map[string]interface{}{
+			"tcp":  tcp,
+			"http": http,
+		}
+	}
+	if p.LoadBalancer != "" {
+		trafficPolicy["loadBalancer"] = map[string]interface{}{
+			"simple": p.LoadBalancer,
+		}
+	}
+	if len(trafficPolicy) == 0 {
+		return customResource{}, false
+	}
+	return customResource{
+		APIVersion: istioNetworkingAPIVersion,
+		Kind:       "DestinationRule",
+		Metadata:   meta,
+		Spec: map[string]interface{}{
+			"host":          host,
+			"trafficPolicy": trafficPolicy,
+		},
+	}, true
+}
+
+// istioDuration formats d in seconds, as Istio's protobuf durations require.
+// They may not be written with an exponent.
+func istioDuration(d policy.Duration) string {
+	return strconv.FormatFloat(time.Duration(d).Seconds(), 'f', -1, 64) + "s"
+}
+
+func istioPercent(p pct.Percentage) map[string]interface{} {
+	return map[string]interface{}{"value": float64(p) * 100}
+}
+
+// hasPolicies returns true if any service in g has a policy or edge policy.
+func hasPolicies(g graph.ServiceGraph) bool {
+	for _, service := range g.Services {
+		if service.Policy != nil || len(service.EdgePolicies) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+)
+
+func TestIstioTrafficManifests(t *testing.T) {
+	serviceGraph := graph.ServiceGraph{Services: []svc.Service{
+		{
+			Name:   "a",
+			Script: script.Script{script.RequestCommand{ServiceName: "b"}},
+			EdgePolicies: map[string]policy.Route{
+				"b": {Timeout: policy.Duration(3 * time.Second)},
+			},
+		},
+		{
+			Name: "b",
+			Policy: &policy.Policy{
+				Route: policy.Route{
+					Timeout: policy.Duration(500 * time.Millisecond),
+					Retries: &policy.Retries{Attempts: 2},
+				},
+				LoadBalancer: policy.LeastRequest,
+				MTLS:         policy.MTLSStrict,
+			},
+		},
+		{Name: "c"},
+	}}
+
+	manifests := istioTrafficManifests(serviceGraph, DefaultProfile())
+
+	var kinds []string
+	for _, manifest := range manifests {
+		kinds = append(kinds, manifest.(customResource).Kind)
+	}
+	expectedKinds := []string{
+		"VirtualService", "DestinationRule", "PeerAuthentication"}
+	if !reflect.DeepEqual(expectedKinds, kinds) {
+		t.Fatalf("expected %v; actual %v", expectedKinds, kinds)
+	}
+
+	expectedRoutes := []map[string]interface{}{
+		{
+			"match": []map[string]interface{}{
+				{"sourceLabels": map[string]string{"name": "a"}},
+			},
+			"route": []map[string]interface{}{
+				{"destination": map[string]interface{}{"host": "b"}},
+			},
+			"timeout": "3s",
+			"retries": map[string]interface{}{"attempts": int32(2)},
+		},
+		{
+			"route": []map[string]interface{}{
+				{"destination": map[string]interface{}{"host": "b"}},
+			},
+			"timeout": "0.5s",
+			"retries": map[string]interface{}{"attempts": int32(2)},
+		},
+	}
+	routes := manifests[0].(customResource).Spec["http"]
+	if !reflect.DeepEqual(expectedRoutes, routes) {
+		t.Errorf("expected %v; actual %v", expectedRoutes, routes)
+	}
+}
+
+func TestIstioDuration(t *testing.T) {
+	tests := []struct {
+		d        time.Duration
+		expected string
+	}{
+		{3 * time.Second, "3s"},
+		{500 * time.Millisecond, "0.5s"},
+		{time.Microsecond, "0.000001s"},
+		{250 * time.Microsecond, "0.00025s"},
+		{100 * time.Hour, "360000s"},
+		{1000000 * time.Second, "1000000s"},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.d.String(), func(t *testing.T) {
+			t.Parallel()
+
+			actual := istioDuration(policy.Duration(test.d))
+			if test.expected != actual {
+				t.Errorf("expected %s; actual %s", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestIstioSidecars(t *testing.T) {
+	serviceGraph := graph.ServiceGraph{Services: []svc.Service{
+		{
+			Name: "a",
+			Script: script.Script{
+				script.RequestCommand{ServiceName: "b"},
+				script.ConcurrentCommand{Commands: []script.Command{
+					script.RequestCommand{ServiceName: "c"},
+					script.RequestCommand{ServiceName: "b"},
+				}},
+			},
+		},
+		{Name: "b"},
+		{Name: "c"},
+	}}
+
+	manifests := istioSidecars(serviceGraph, DefaultProfile())
+
+	expected := [][]string{
+		{
+			"./b.service-graph.svc.cluster.local",
+			"./c.service-graph.svc.cluster.local",
+			istioSystemHosts,
+		},
+		{istioSystemHosts},
+		{istioSystemHosts},
+	}
+	var actual [][]string
+	for _, manifest := range manifests {
+		egress := manifest.(customResource).Spec["egress"]
+		actual = append(
+			actual, egress.([]map[string]interface{})[0]["hosts"].([]string))
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v; actual %v", expected, actual)
+	}
+}
+
+func TestServiceGraphToKubernetesManifests_UnsupportedPolicies(t *testing.T) {
+	serviceGraph := graph.ServiceGraph{Services: []svc.Service{
+		{Name: "a", Policy: &policy.Policy{MTLS: policy.MTLSStrict}},
+	}}
+	profile := DefaultProfile()
+	profile.Mesh = MeshLinkerd
+
+	_, err := ServiceGraphToKubernetesManifests(serviceGraph, profile)
+	if expected := (UnsupportedPoliciesError{MeshLinkerd}); err != expected {
+		t.Errorf("expected %v; actual %v", expected, err)
+	}
+}
@@ -2,49 +2,50 @@
 package kubernetes
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/maxfouquet/isotope/convert/pkg/consts"
+	"github.com/maxfouquet/isotope/convert/pkg/fault"
 	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/k8s"
 	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
 	"github.com/ghodss/yaml"
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 const (
-	// ServiceGraphNamespace is the namespace all service graph related resources
-	// (i.e. ConfigMap, Services, and Deployments) will reside in.
-	ServiceGraphNamespace = "service-graph"
-
-	numConfigMaps          = 1
-	numManifestsPerService = 2
+	numManifestsPerService = 3
 
 	configVolume           = "config-volume"
 	serviceGraphConfigName = "service-graph-config"
 )
 
 var (
-	serviceGraphAppLabels       = map[string]string{"app": "service-graph"}
-	serviceGraphNodeLabels      = map[string]string{"role": "service"}
-	sidecarInjectionAnnotations = map[string]string{
-		"sidecar.istio.io/inject": "true"}
+	serviceGraphAppLabels  = map[string]string{"app": "service-graph"}
+	serviceGraphNodeLabels = map[string]string{"role": "service"}
 )
 
 // ServiceGraphToKubernetesManifests converts a ServiceGraph to Kubernetes
-// manifests.
+// manifests for the cluster described by profile.
 func ServiceGraphToKubernetesManifests(
-	serviceGraph graph.ServiceGraph,
-	serviceNodeSelector map[string]string,
-	serviceImage string,
-	serviceMaxIdleConnectionsPerHost int,
-	clientNodeSelector map[string]string,
-	clientImage string) (yamlDoc []byte, err error) {
+	serviceGraph graph.ServiceGraph, profile Profile) (yamlDoc []byte, err error) {
+	mesh, err := MeshFromName(profile.Mesh)
+	if err != nil {
+		return
+	}
+	if hasPolicies(serviceGraph) && !mesh.SupportsPolicies() {
+		return nil, UnsupportedPoliciesError{profile.Mesh}
+	}
+
 	numServices := len(serviceGraph.Services)
-	numManifests := numManifestsPerService*numServices + numConfigMaps
+	numManifests := numManifestsPerService * numServices
 	manifests := make([]string, 0, numManifests)
 
 	appendManifest := func(manifest interface{}) error {
@@ -56,34 +57,40 @@ func ServiceGraphToKubernetesManifests(
 		return nil
 	}
 
-	namespace := makeServiceGraphNamespace()
+	namespace := makeServiceGraphNamespace(profile, mesh)
 	err = appendManifest(namespace)
 	if err != nil {
 		return
 	}
 
-	configMap, err := makeConfigMap(serviceGraph)
+	configMaps, configMapRefs, err := makeConfigMaps(serviceGraph, profile)
 	if err != nil {
 		return
 	}
-	err = appendManifest(configMap)
-	if err != nil {
-		return
+	for _, configMap := range configMaps {
+		err = appendManifest(configMap)
+		if err != nil {
+			return
+		}
 	}
 
 	for _, service := range serviceGraph.Services {
 		k8sDeployment, innerErr := makeDeployment(
-			service, serviceNodeSelector, serviceImage,
-			serviceMaxIdleConnectionsPerHost)
+			service, profile, mesh, configMapRefs[service.Name])
+		if innerErr != nil {
+			return nil, innerErr
+		}
+		deploymentManifest, innerErr := withTopologySpreadConstraints(
+			k8sDeployment, service)
 		if innerErr != nil {
 			return nil, innerErr
 		}
-		innerErr = appendManifest(k8sDeployment)
+		innerErr = appendManifest(deploymentManifest)
 		if innerErr != nil {
 			return nil, innerErr
 		}
 
-		k8sService, innerErr := makeService(service)
+		k8sService, innerErr := makeService(service, profile)
 		if innerErr != nil {
 			return nil, innerErr
 		}
@@ -93,14 +100,37 @@ func ServiceGraphToKubernetesManifests(
 		}
 	}
 
-	fortioDeployment := makeFortioDeployment(
-		clientNodeSelector, clientImage)
+	if profile.AccessPolicies {
+		for _, manifest := range accessManifests(serviceGraph, profile) {
+			err = appendManifest(manifest)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	for _, manifest := range mesh.Manifests(serviceGraph, profile) {
+		err = appendManifest(manifest)
+		if err != nil {
+			return
+		}
+	}
+
+	if profile.AccessPolicies {
+		err = appendManifest(makeServiceAccount(
+			profile.Client.Name, profile.Client.Namespace, profile))
+		if err != nil {
+			return
+		}
+	}
+
+	fortioDeployment := makeFortioDeployment(profile)
 	err = appendManifest(fortioDeployment)
 	if err != nil {
 		return
 	}
 
-	fortioService := makeFortioService()
+	fortioService := makeFortioService(profile)
 	err = appendManifest(fortioService)
 	if err != nil {
 		return
@@ -110,66 +140,63 @@ func ServiceGraphToKubernetesManifests(
 	return []byte(yamlDocString), nil
 }
 
-func combineLabels(a, b map[string]string) map[string]string {
-	c := make(map[string]string, len(a)+len(b))
-	for k, v := range a {
-		c[k] = v
-	}
-	for k, v := range b {
-		c[k] = v
+// combineLabels returns the union of maps. The values in later maps take
+// precedence, so labels from a service graph or profile cannot override those
+// isotope relies on.
+func combineLabels(maps ...map[string]string) map[string]string {
+	c := map[string]string{}
+	for _, m := range maps {
+		for k, v := range m {
+			c[k] = v
+		}
 	}
 	return c
 }
 
-func makeServiceGraphNamespace() (namespace apiv1.Namespace) {
+func makeServiceGraphNamespace(
+	profile Profile, mesh Mesh) (namespace apiv1.Namespace) {
 	namespace.APIVersion = "v1"
 	namespace.Kind = "Namespace"
-	namespace.ObjectMeta.Name = consts.ServiceGraphNamespace
-	namespace.ObjectMeta.Labels = map[string]string{"istio-injection": "enabled"}
+	namespace.ObjectMeta.Name = profile.Namespace.Name
+	namespace.ObjectMeta.Labels = combineLabels(
+		profile.Labels, mesh.NamespaceLabels(), profile.Namespace.Labels)
+	namespace.ObjectMeta.Annotations = combineLabels(
+		profile.Annotations, mesh.NamespaceAnnotations(),
+		profile.Namespace.Annotations)
 	timestamp(&namespace.ObjectMeta)
 	return
 }
 
-func makeConfigMap(
-	graph graph.ServiceGraph) (configMap apiv1.ConfigMap, err error) {
-	graphYAMLBytes, err := yaml.Marshal(graph)
-	if err != nil {
-		return
-	}
-	configMap.APIVersion = "v1"
-	configMap.Kind = "ConfigMap"
-	configMap.ObjectMeta.Name = serviceGraphConfigName
-	configMap.ObjectMeta.Namespace = ServiceGraphNamespace
-	configMap.ObjectMeta.Labels = serviceGraphAppLabels
-	timestamp(&configMap.ObjectMeta)
-	configMap.Data = map[string]string{
-		consts.ServiceGraphConfigMapKey: string(graphYAMLBytes),
-	}
-	return
-}
-
-func makeService(service svc.Service) (k8sService apiv1.Service, err error) {
+func makeService(
+	service svc.Service, profile Profile) (k8sService apiv1.Service, err error) {
 	k8sService.APIVersion = "v1"
 	k8sService.Kind = "Service"
 	k8sService.ObjectMeta.Name = service.Name
-	k8sService.ObjectMeta.Namespace = ServiceGraphNamespace
-	k8sService.ObjectMeta.Labels = serviceGraphAppLabels
+	k8sService.ObjectMeta.Namespace = profile.Namespace.Name
+	k8sService.ObjectMeta.Labels = combineLabels(
+		profile.Labels, service.Labels, serviceGraphAppLabels)
+	k8sService.ObjectMeta.Annotations = profile.Annotations
 	timestamp(&k8sService.ObjectMeta)
-	k8sService.Spec.Ports = []apiv1.ServicePort{{Name: fmt.Sprintf("tcp-%d", consts.ServicePort), Port: consts.ServicePort}}
+	port := profile.Service.Port
+	k8sService.Spec.Ports = []apiv1.ServicePort{{Name: servicePortName(port), Port: port}}
 	k8sService.Spec.Selector = map[string]string{"name": service.Name}
 	return
 }
 
 func makeDeployment(
-	service svc.Service, nodeSelector map[string]string,
-	serviceImage string, serviceMaxIdleConnectionsPerHost int) (
+	service svc.Service, profile Profile, mesh Mesh, config configMapRef) (
 	k8sDeployment appsv1.Deployment, err error) {
+	workload := profile.Service.WorkloadProfile
 	k8sDeployment.APIVersion = "apps/v1"
 	k8sDeployment.Kind = "Deployment"
 	k8sDeployment.ObjectMeta.Name = service.Name
-	k8sDeployment.ObjectMeta.Namespace = ServiceGraphNamespace
-	k8sDeployment.ObjectMeta.Labels = serviceGraphAppLabels
-	k8sDeployment.ObjectMeta.Annotations = sidecarInjectionAnnotations
+	k8sDeployment.ObjectMeta.Namespace = profile.Namespace.Name
+	k8sDeployment.ObjectMeta.Labels = combineLabels(
+		profile.Labels, service.Labels, serviceGraphAppLabels)
+	podAnnotations := combineLabels(
+		mesh.PodAnnotations(service), workload.PodAnnotations)
+	k8sDeployment.ObjectMeta.Annotations = combineLabels(
+		profile.Annotations, podAnnotations)
 	timestamp(&k8sDeployment.ObjectMeta)
 	k8sDeployment.Spec = appsv1.DeploymentSpec{
 		Replicas: &service.NumReplicas,
@@ -180,24 +207,26 @@ func makeDeployment(
 		},
 		Template: apiv1.PodTemplateSpec{
 			ObjectMeta: metav1.ObjectMeta{
-				Annotations: sidecarInjectionAnnotations,
+				Annotations: podAnnotations,
 				Labels: combineLabels(
+					profile.Labels,
+					workload.PodLabels,
+					service.Labels,
 					serviceGraphNodeLabels,
 					map[string]string{
 						"name": service.Name,
 					}),
 			},
 			Spec: apiv1.PodSpec{
-				NodeSelector: nodeSelector,
+				NodeSelector: workload.NodeSelector,
+				Tolerations:  workload.Tolerations,
+				Affinity:     workload.Affinity,
 				Containers: []apiv1.Container{
 					apiv1.Container{
-						Name:  consts.ServiceContainerName,
-						Image: serviceImage,
-						Args: []string{
-							fmt.Sprintf(
-								"--max-idle-connections-per-host=%v",
-								serviceMaxIdleConnectionsPerHost),
-						},
+						Name:            consts.ServiceContainerName,
+						Image:           workload.Image,
+						ImagePullPolicy: workload.ImagePullPolicy,
+						Args:            serviceArgs(profile.Service),
 						Env: []apiv1.EnvVar{
 							{Name: consts.ServiceNameEnvKey, Value: service.Name},
 						},
@@ -209,7 +238,19 @@ func makeDeployment(
 						},
 						Ports: []apiv1.ContainerPort{
 							{
-								ContainerPort: consts.ServicePort,
+								ContainerPort: profile.Service.Port,
+							},
+							{
+								Name:          "admin",
+								ContainerPort: profile.Service.AdminPort,
+							},
+						},
+						ReadinessProbe: &apiv1.Probe{
+							Handler: apiv1.Handler{
+								HTTPGet: &apiv1.HTTPGetAction{
+									Path: fault.ReadyPath,
+									Port: intstr.FromInt(int(profile.Service.AdminPort)),
+								},
 							},
 						},
 					},
@@ -220,11 +261,11 @@ func makeDeployment(
 						VolumeSource: apiv1.VolumeSource{
 							ConfigMap: &apiv1.ConfigMapVolumeSource{
 								LocalObjectReference: apiv1.LocalObjectReference{
-									Name: serviceGraphConfigName,
+									Name: config.Name,
 								},
 								Items: []apiv1.KeyToPath{
 									{
-										Key:  consts.ServiceGraphConfigMapKey,
+										Key:  config.Key,
 										Path: consts.ServiceGraphYAMLFileName,
 									},
 								},
@@ -236,9 +277,90 @@ func makeDeployment(
 		},
 	}
 	timestamp(&k8sDeployment.Spec.Template.ObjectMeta)
+	if profile.AccessPolicies {
+		k8sDeployment.Spec.Template.Spec.ServiceAccountName = service.Name
+	}
+	applyKubernetesSettings(&k8sDeployment.Spec.Template.Spec, service.Kubernetes)
 	return
 }
 
+// serviceArgs returns the command line arguments of each service.
+func serviceArgs(profile ServiceProfile) []string {
+	args := []string{
+		fmt.Sprintf(
+			"--max-idle-connections-per-host=%v",
+			profile.MaxIdleConnectionsPerHost),
+		fmt.Sprintf("--port=%v", profile.Port),
+		fmt.Sprintf("--admin-port=%v", profile.AdminPort),
+	}
+	if len(profile.DurationBuckets) > 0 {
+		buckets := make([]string, 0, len(profile.DurationBuckets))
+		for _, bucket := range profile.DurationBuckets {
+			buckets = append(buckets, strconv.FormatFloat(bucket, 'g', -1, 64))
+		}
+		args = append(args, "--duration-buckets="+strings.Join(buckets, ","))
+	}
+	return append(args, profile.Args...)
+}
+
+// applyKubernetesSettings applies the scheduling and sizing settings of a
+// service to the spec of its pods.
+func applyKubernetesSettings(podSpec *apiv1.PodSpec, settings *k8s.Settings) {
+	if settings == nil {
+		return
+	}
+	if settings.Resources != nil {
+		podSpec.Containers[0].Resources = *settings.Resources
+	}
+	if len(settings.NodeSelector) > 0 {
+		podSpec.NodeSelector = combineLabels(
+			podSpec.NodeSelector, settings.NodeSelector)
+	}
+	if len(settings.Tolerations) > 0 {
+		podSpec.Tolerations = settings.Tolerations
+	}
+	if settings.Affinity != nil {
+		podSpec.Affinity = settings.Affinity
+	}
+	podSpec.PriorityClassName = settings.PriorityClassName
+}
+
+// withTopologySpreadConstraints returns deployment with the topology spread
+// constraints of service added to its pods. The vendored Kubernetes API
+// predates them, so they are added to the generic form of the deployment.
+func withTopologySpreadConstraints(
+	deployment appsv1.Deployment, service svc.Service) (interface{}, error) {
+	if service.Kubernetes == nil ||
+		len(service.Kubernetes.TopologySpreadConstraints) == 0 {
+		return deployment, nil
+	}
+
+	constraints := make(
+		[]k8s.TopologySpreadConstraint, 0,
+		len(service.Kubernetes.TopologySpreadConstraints))
+	for _, c := range service.Kubernetes.TopologySpreadConstraints {
+		if c.LabelSelector == nil {
+			c.LabelSelector = deployment.Spec.Selector
+		}
+		constraints = append(constraints, c)
+	}
+
+	b, err := json.Marshal(deployment)
+	if err != nil {
+		return nil, err
+	}
+	var generic map[string]interface{}
+	err = json.Unmarshal(b, &generic)
+	if err != nil {
+		return nil, err
+	}
+	spec := generic["spec"].(map[string]interface{})
+	template := spec["template"].(map[string]interface{})
+	podSpec := template["spec"].(map[string]interface{})
+	podSpec["topologySpreadConstraints"] = constraints
+	return generic, nil
+}
+
 func timestamp(objectMeta *metav1.ObjectMeta) {
 	objectMeta.CreationTimestamp = metav1.Time{Time: time.Now()}
 }
@@ -0,0 +1,324 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// MeshName identifies a Mesh.
+type MeshName string
+
+const (
+	// MeshNone deploys the services without a service mesh.
+	MeshNone MeshName = "none"
+	// MeshIstio injects an Istio sidecar proxy into each pod.
+	MeshIstio MeshName = "istio"
+	// MeshIstioAmbient enrolls the namespace in Istio's ambient mode, with a
+	// waypoint proxy for L7 processing.
+	MeshIstioAmbient MeshName = "istio-ambient"
+	// MeshLinkerd injects a Linkerd proxy into each pod.
+	MeshLinkerd MeshName = "linkerd"
+	// MeshConsul injects a Consul Connect sidecar proxy into each pod.
+	MeshConsul MeshName = "consul"
+)
+
+// Meshes lists the names of every supported mesh.
+var Meshes = []MeshName{
+	MeshNone, MeshIstio, MeshIstioAmbient, MeshLinkerd, MeshConsul}
+
+// Mesh adapts the generated manifests to a service mesh, so that the same
+// topology can be compared fairly across meshes.
+type Mesh interface {
+	// NamespaceLabels are added to the service graph's namespace.
+	NamespaceLabels() map[string]string
+
+	// NamespaceAnnotations are added to the service graph's namespace.
+	NamespaceAnnotations() map[string]string
+
+	// PodAnnotations are added to the pods of service, including those which
+	// size its proxy.
+	PodAnnotations(service svc.Service) map[string]string
+
+	// Manifests are the mesh's custom resources for the graph, including those
+	// which apply the services' policies.
+	Manifests(g graph.ServiceGraph, profile Profile) []interface{}
+
+	// SupportsPolicies returns true if the mesh can apply the services'
+	// policies.
+	SupportsPolicies() bool
+}
+
+// MeshFromName returns the Mesh named name.
+func MeshFromName(name MeshName) (Mesh, error) {
+	switch name {
+	case MeshNone:
+		return noMesh{}, nil
+	case MeshIstio:
+		return istioSidecarMesh{}, nil
+	case MeshIstioAmbient:
+		return istioAmbientMesh{}, nil
+	case MeshLinkerd:
+		return linkerdMesh{}, nil
+	case MeshConsul:
+		return consulMesh{}, nil
+	default:
+		return nil, UnknownMeshError{name}
+	}
+}
+
+// servicePortName names the port of each service so that meshes which detect
+// protocols by port name treat its traffic as HTTP. The mock service speaks
+// HTTP whatever the type of the service it emulates.
+func servicePortName(port int32) string {
+	return fmt.Sprintf("http-%d", port)
+}
+
+type noMesh struct{}
+
+func (noMesh) NamespaceLabels() map[string]string                  { return nil }
+func (noMesh) NamespaceAnnotations() map[string]string             { return nil }
+func (noMesh) PodAnnotations(svc.Service) map[string]string        { return nil }
+func (noMesh) Manifests(graph.ServiceGraph, Profile) []interface{} { return nil }
+func (noMesh) SupportsPolicies() bool                              { return false }
+
+type istioSidecarMesh struct{}
+
+func (istioSidecarMesh) NamespaceLabels() map[string]string {
+	return map[string]string{"istio-injection": "enabled"}
+}
+
+func (istioSidecarMesh) NamespaceAnnotations() map[string]string {
+	return nil
+}
+
+func (istioSidecarMesh) PodAnnotations(service svc.Service) map[string]string {
+	return combineLabels(
+		map[string]string{"sidecar.istio.io/inject": "true"},
+		proxyResourceAnnotations(service, proxyResourceAnnotationKeys{
+			CPURequest:    "sidecar.istio.io/proxyCPU",
+			CPULimit:      "sidecar.istio.io/proxyCPULimit",
+			MemoryRequest: "sidecar.istio.io/proxyMemory",
+			MemoryLimit:   "sidecar.istio.io/proxyMemoryLimit",
+		}))
+}
+
+// Manifests returns the Istio traffic management resources which apply the
+// services' policies and, if the profile asks for them, a Sidecar resource and
+// an AuthorizationPolicy for each service.
+func (istioSidecarMesh) Manifests(
+	g graph.ServiceGraph, profile Profile) []interface{} {
+	manifests := istioTrafficManifests(g, profile)
+	if profile.ScopeSidecars {
+		manifests = append(manifests, istioSidecars(g, profile)...)
+	}
+	if profile.AccessPolicies {
+		manifests = append(manifests, istioAuthorizationPolicies(g, profile)...)
+	}
+	return manifests
+}
+
+func (istioSidecarMesh) SupportsPolicies() bool {
+	return true
+}
+
+// istioWaypointName is the name of the waypoint proxy of the namespace in
+// ambient mode.
+const istioWaypointName = "waypoint"
+
+type istioAmbientMesh struct{}
+
+func (istioAmbientMesh) NamespaceLabels() map[string]string {
+	return map[string]string{
+		"istio.io/dataplane-mode": "ambient",
+		"istio.io/use-waypoint":   istioWaypointName,
+	}
+}
+
+func (istioAmbientMesh) NamespaceAnnotations() map[string]string {
+	return nil
+}
+
+func (istioAmbientMesh) PodAnnotations(svc.Service) map[string]string {
+	return nil
+}
+
+// Manifests returns the waypoint proxy which gives ambient mode the same L7
+// processing as a sidecar, the Istio traffic management resources which apply
+// the services' policies and, if the profile asks for them, the services'
+// AuthorizationPolicies.
+func (istioAmbientMesh) Manifests(
+	g graph.ServiceGraph, profile Profile) []interface{} {
+	waypoint := []interface{}{
+		customResource{
+			APIVersion: "gateway.networking.k8s.io/v1",
+			Kind:       "Gateway",
+			Metadata: customResourceMeta{
+				Name:      istioWaypointName,
+				Namespace: profile.Namespace.Name,
+				Labels: combineLabels(
+					profile.Labels,
+					map[string]string{"istio.io/waypoint-for": "service"}),
+			},
+			Spec: map[string]interface{}{
+				"gatewayClassName": "istio-waypoint",
+				"listeners": []map[string]interface{}{
+					{"name": "mesh", "port": istioHBONEPort, "protocol": "HBONE"},
+				},
+			},
+		},
+	}
+	manifests := append(waypoint, istioTrafficManifests(g, profile)...)
+	if profile.AccessPolicies {
+		manifests = append(manifests, istioAuthorizationPolicies(g, profile)...)
+	}
+	return manifests
+}
+
+func (istioAmbientMesh) SupportsPolicies() bool {
+	return true
+}
+
+type linkerdMesh struct{}
+
+func (linkerdMesh) NamespaceLabels() map[string]string {
+	return nil
+}
+
+func (linkerdMesh) NamespaceAnnotations() map[string]string {
+	return map[string]string{"linkerd.io/inject": "enabled"}
+}
+
+func (linkerdMesh) PodAnnotations(service svc.Service) map[string]string {
+	return combineLabels(
+		map[string]string{"linkerd.io/inject": "enabled"},
+		proxyResourceAnnotations(service, proxyResourceAnnotationKeys{
+			CPURequest:    "config.linkerd.io/proxy-cpu-request",
+			CPULimit:      "config.linkerd.io/proxy-cpu-limit",
+			MemoryRequest: "config.linkerd.io/proxy-memory-request",
+			MemoryLimit:   "config.linkerd.io/proxy-memory-limit",
+		}))
+}
+
+func (linkerdMesh) Manifests(graph.ServiceGraph, Profile) []interface{} {
+	return nil
+}
+
+func (linkerdMesh) SupportsPolicies() bool {
+	return false
+}
+
+type consulMesh struct{}
+
+func (consulMesh) NamespaceLabels() map[string]string {
+	return nil
+}
+
+func (consulMesh) NamespaceAnnotations() map[string]string {
+	return nil
+}
+
+func (consulMesh) PodAnnotations(service svc.Service) map[string]string {
+	return combineLabels(
+		map[string]string{"consul.hashicorp.com/connect-inject": "true"},
+		proxyResourceAnnotations(service, proxyResourceAnnotationKeys{
+			CPURequest:    "consul.hashicorp.com/sidecar-proxy-cpu-request",
+			CPULimit:      "consul.hashicorp.com/sidecar-proxy-cpu-limit",
+			MemoryRequest: "consul.hashicorp.com/sidecar-proxy-memory-request",
+			MemoryLimit:   "consul.hashicorp.com/sidecar-proxy-memory-limit",
+		}))
+}
+
+// Manifests returns a ServiceDefaults for each service, so that Consul treats
+// its traffic as HTTP rather than opaque TCP.
+func (consulMesh) Manifests(
+	g graph.ServiceGraph, profile Profile) []interface{} {
+	manifests := make([]interface{}, 0, len(g.Services))
+	for _, service := range g.Services {
+		manifests = append(manifests, customResource{
+			APIVersion: "consul.hashicorp.com/v1alpha1",
+			Kind:       "ServiceDefaults",
+			Metadata: customResourceMeta{
+				Name:      service.Name,
+				Namespace: profile.Namespace.Name,
+				Labels:    combineLabels(profile.Labels, serviceGraphAppLabels),
+			},
+			Spec: map[string]interface{}{"protocol": "http"},
+		})
+	}
+	return manifests
+}
+
+func (consulMesh) SupportsPolicies() bool {
+	return false
+}
+
+// proxyResourceAnnotationKeys are the annotations with which a mesh sizes its
+// proxy.
+type proxyResourceAnnotationKeys struct {
+	CPURequest    string
+	CPULimit      string
+	MemoryRequest string
+	MemoryLimit   string
+}
+
+// proxyResourceAnnotations returns the annotations which size the proxy of
+// service to its SidecarResources.
+func proxyResourceAnnotations(
+	service svc.Service, keys proxyResourceAnnotationKeys) map[string]string {
+	annotations := map[string]string{}
+	if service.Kubernetes == nil || service.Kubernetes.SidecarResources == nil {
+		return annotations
+	}
+	resources := service.Kubernetes.SidecarResources
+	for annotation, quantity := range map[string]resource.Quantity{
+		keys.CPURequest:    resources.Requests[apiv1.ResourceCPU],
+		keys.MemoryRequest: resources.Requests[apiv1.ResourceMemory],
+		keys.CPULimit:      resources.Limits[apiv1.ResourceCPU],
+		keys.MemoryLimit:   resources.Limits[apiv1.ResourceMemory],
+	} {
+		if !quantity.IsZero() {
+			annotations[annotation] = quantity.String()
+		}
+	}
+	return annotations
+}
+
+// customResource is a manifest of a kind which the vendored Kubernetes API
+// does not describe.
+type customResource struct {
+	APIVersion string                 `json:"apiVersion"`
+	Kind       string                 `json:"kind"`
+	Metadata   customResourceMeta     `json:"metadata"`
+	Spec       map[string]interface{} `json:"spec,omitempty"`
+}
+
+type customResourceMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// UnknownMeshError is returned when a profile names a mesh which is not
+// supported.
+type UnknownMeshError struct {
+	Name MeshName
+}
+
+func (e UnknownMeshError) Error() string {
+	return fmt.Sprintf("unknown mesh %q (must be one of %v)", e.Name, Meshes)
+}
+
+// UnsupportedPoliciesError is returned when a service graph with policies is
+// deployed into a mesh which cannot apply them.
+type UnsupportedPoliciesError struct {
+	Mesh MeshName
+}
+
+func (e UnsupportedPoliciesError) Error() string {
+	return fmt.Sprintf("mesh %q does not support service policies", e.Mesh)
+}
@@ -0,0 +1,120 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/k8s"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestMesh_PodAnnotations(t *testing.T) {
+	service := svc.Service{
+		Name: "a",
+		Kubernetes: &k8s.Settings{
+			SidecarResources: &apiv1.ResourceRequirements{
+				Requests: apiv1.ResourceList{
+					apiv1.ResourceCPU: resource.MustParse("100m"),
+				},
+				Limits: apiv1.ResourceList{
+					apiv1.ResourceMemory: resource.MustParse("128Mi"),
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		mesh     MeshName
+		expected map[string]string
+	}{
+		{MeshNone, nil},
+		{
+			MeshIstio,
+			map[string]string{
+				"sidecar.istio.io/inject":           "true",
+				"sidecar.istio.io/proxyCPU":         "100m",
+				"sidecar.istio.io/proxyMemoryLimit": "128Mi",
+			},
+		},
+		{MeshIstioAmbient, nil},
+		{
+			MeshLinkerd,
+			map[string]string{
+				"linkerd.io/inject":                    "enabled",
+				"config.linkerd.io/proxy-cpu-request":  "100m",
+				"config.linkerd.io/proxy-memory-limit": "128Mi",
+			},
+		},
+		{
+			MeshConsul,
+			map[string]string{
+				"consul.hashicorp.com/connect-inject":             "true",
+				"consul.hashicorp.com/sidecar-proxy-cpu-request":  "100m",
+				"consul.hashicorp.com/sidecar-proxy-memory-limit": "128Mi",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(string(test.mesh), func(t *testing.T) {
+			t.Parallel()
+
+			mesh, err := MeshFromName(test.mesh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := mesh.PodAnnotations(service)
+			if !reflect.DeepEqual(test.expected, actual) {
+				t.Errorf("expected %v; actual %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMesh_Manifests(t *testing.T) {
+	serviceGraph := graph.ServiceGraph{
+		Services: []svc.Service{{Name: "a"}, {Name: "b"}},
+	}
+
+	tests := []struct {
+		mesh  MeshName
+		kinds []string
+	}{
+		{MeshNone, nil},
+		{MeshIstio, nil},
+		{MeshIstioAmbient, []string{"Gateway"}},
+		{MeshLinkerd, nil},
+		{MeshConsul, []string{"ServiceDefaults", "ServiceDefaults"}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(string(test.mesh), func(t *testing.T) {
+			t.Parallel()
+
+			mesh, err := MeshFromName(test.mesh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kinds []string
+			for _, manifest := range mesh.Manifests(
+				serviceGraph, DefaultProfile()) {
+				kinds = append(kinds, manifest.(customResource).Kind)
+			}
+			if !reflect.DeepEqual(test.kinds, kinds) {
+				t.Errorf("expected %v; actual %v", test.kinds, kinds)
+			}
+		})
+	}
+}
+
+func TestMeshFromName_Unknown(t *testing.T) {
+	_, err := MeshFromName("envoy")
+	if expected := (UnknownMeshError{"envoy"}); err != expected {
+		t.Errorf("expected %v; actual %v", expected, err)
+	}
+}
@@ -0,0 +1,255 @@
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ghodss/yaml"
+	"github.com/maxfouquet/isotope/convert/pkg/consts"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// Profile describes the cluster layout that manifests are generated for, so
+// that one topology can target many clusters.
+type Profile struct {
+	// Mesh is the service mesh the services are deployed into.
+	Mesh MeshName `json:"mesh"`
+
+	// ScopeSidecars gives each service an Istio Sidecar resource which limits
+	// the configuration its proxy receives to the services it calls. It
+	// requires the istio mesh.
+	ScopeSidecars bool `json:"scopeSidecars,omitempty"`
+
+	// AccessPolicies gives each service its own ServiceAccount and admits
+	// calls to it only from its callers, through a NetworkPolicy and, in the
+	// Istio meshes, an AuthorizationPolicy.
+	AccessPolicies bool `json:"accessPolicies,omitempty"`
+
+	Namespace NamespaceProfile `json:"namespace"`
+
+	// ConfigMaps is how the service graph is split across the ConfigMaps the
+	// services mount.
+	ConfigMaps ConfigMapLayout `json:"configMaps"`
+
+	// Labels are added to every generated resource.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations are added to every generated resource.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	Service ServiceProfile `json:"service"`
+	Client  ClientProfile  `json:"client"`
+	Scraper ScraperProfile `json:"scraper"`
+}
+
+// NamespaceProfile describes the namespace holding the service graph.
+type NamespaceProfile struct {
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// WorkloadProfile describes the pods of a Deployment.
+type WorkloadProfile struct {
+	Image           string           `json:"image"`
+	ImagePullPolicy apiv1.PullPolicy `json:"imagePullPolicy,omitempty"`
+
+	NodeSelector map[string]string  `json:"nodeSelector,omitempty"`
+	Tolerations  []apiv1.Toleration `json:"tolerations,omitempty"`
+	Affinity     *apiv1.Affinity    `json:"affinity,omitempty"`
+
+	// PodLabels and PodAnnotations are added to each pod.
+	PodLabels      map[string]string `json:"podLabels,omitempty"`
+	PodAnnotations map[string]string `json:"podAnnotations,omitempty"`
+}
+
+// ServiceProfile describes the Deployments of the services in the graph.
+// Settings in a service's "kubernetes" block take precedence.
+type ServiceProfile struct {
+	WorkloadProfile
+
+	// Port is the port every service listens on and calls the others on.
+	Port int32 `json:"port"`
+
+	// AdminPort is the port of each service's admin API, which injects faults
+	// and reports readiness.
+	AdminPort int32 `json:"adminPort"`
+
+	// AdminSources are the CIDR blocks which access policies admit to the
+	// admin port, such as the address of the Kubernetes API server, through
+	// which `convert fault` reaches it. The kubelet's readiness probes are
+	// admitted regardless.
+	AdminSources []string `json:"adminSources,omitempty"`
+
+	MaxIdleConnectionsPerHost int `json:"maxIdleConnectionsPerHost,omitempty"`
+
+	// DurationBuckets are the upper bounds, in seconds, of the buckets of each
+	// service's duration histograms. If empty, the services' defaults are used.
+	DurationBuckets []float64 `json:"durationBuckets,omitempty"`
+
+	// Args are added to the command line of each service, such as flags which
+	// enable tracing.
+	Args []string `json:"args,omitempty"`
+}
+
+// ClientProfile describes the Deployment of the load testing client.
+type ClientProfile struct {
+	WorkloadProfile
+
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the client. If empty, the client is
+	// deployed to the namespace of the kubectl context.
+	Namespace string `json:"namespace,omitempty"`
+
+	Port        int32    `json:"port"`
+	MetricsPort int32    `json:"metricsPort"`
+	Args        []string `json:"args,omitempty"`
+}
+
+// ScraperProfile describes the Prometheus server which scrapes the services'
+// metrics, so that access policies admit it.
+type ScraperProfile struct {
+	// Namespace is the namespace of the scraper. If empty, any namespace
+	// matches.
+	Namespace string `json:"namespace,omitempty"`
+
+	// PodLabels select the scraper's pods.
+	PodLabels map[string]string `json:"podLabels,omitempty"`
+
+	// ServiceAccount is the scraper's ServiceAccount, whose principal the
+	// Istio meshes admit.
+	ServiceAccount string `json:"serviceAccount"`
+}
+
+// DefaultProfile returns the profile used when none is given: everything in
+// the "service-graph" namespace, with Istio sidecars injected.
+func DefaultProfile() Profile {
+	return Profile{
+		Mesh:       MeshIstio,
+		ConfigMaps: ConfigMapsSingle,
+		Namespace: NamespaceProfile{
+			Name: consts.ServiceGraphNamespace,
+		},
+		Service: ServiceProfile{
+			Port:      consts.ServicePort,
+			AdminPort: consts.ServiceAdminPort,
+		},
+		Client: ClientProfile{
+			Name:        "client",
+			Port:        consts.ServicePort,
+			MetricsPort: consts.FortioMetricsPort,
+			Args:        []string{"server"},
+		},
+		Scraper: ScraperProfile{
+			Namespace:      "istio-system",
+			PodLabels:      map[string]string{"app.kubernetes.io/name": "prometheus"},
+			ServiceAccount: "prometheus",
+		},
+	}
+}
+
+// ProfileFromYAML decodes a profile from YAML. Settings which are not given
+// keep their value from DefaultProfile; maps are merged with the defaults.
+func ProfileFromYAML(b []byte) (Profile, error) {
+	jsonContents, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return Profile{}, err
+	}
+	return profileFromJSON(jsonContents)
+}
+
+// ProfileFromTOML decodes a profile from TOML in the same way as
+// ProfileFromYAML.
+func ProfileFromTOML(b []byte) (Profile, error) {
+	var contents map[string]interface{}
+	if err := toml.Unmarshal(b, &contents); err != nil {
+		return Profile{}, err
+	}
+	jsonContents, err := json.Marshal(contents)
+	if err != nil {
+		return Profile{}, err
+	}
+	return profileFromJSON(jsonContents)
+}
+
+func profileFromJSON(b []byte) (Profile, error) {
+	profile := DefaultProfile()
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&profile); err != nil {
+		return Profile{}, err
+	}
+	return profile, nil
+}
+
+// Validate returns nil if the profile can produce valid manifests; that is, if
+// it names a namespace, a supported mesh, a known config map layout, a client
+// and the scraper's ServiceAccount, each of its ports is valid, its admin
+// sources are CIDR blocks, its duration buckets are positive and increasing
+// and it scopes sidecars only in the istio mesh.
+func (p Profile) Validate() error {
+	if p.Namespace.Name == "" {
+		return InvalidProfileError{"namespace.name", "must be set"}
+	}
+	if _, err := MeshFromName(p.Mesh); err != nil {
+		return err
+	}
+	if p.ScopeSidecars && p.Mesh != MeshIstio {
+		return InvalidProfileError{
+			"scopeSidecars", fmt.Sprintf("requires the %s mesh", MeshIstio)}
+	}
+	switch p.ConfigMaps {
+	case ConfigMapsSingle, ConfigMapsPerService, ConfigMapsSharded:
+	default:
+		return InvalidProfileError{
+			"configMaps", fmt.Sprintf(
+				"must be one of %s, %s or %s",
+				ConfigMapsSingle, ConfigMapsPerService, ConfigMapsSharded)}
+	}
+	if p.Client.Name == "" {
+		return InvalidProfileError{"client.name", "must be set"}
+	}
+	if p.Scraper.ServiceAccount == "" {
+		return InvalidProfileError{"scraper.serviceAccount", "must be set"}
+	}
+	for field, port := range map[string]int32{
+		"service.port":       p.Service.Port,
+		"service.adminPort":  p.Service.AdminPort,
+		"client.port":        p.Client.Port,
+		"client.metricsPort": p.Client.MetricsPort,
+	} {
+		if port < 1 || port > 65535 {
+			return InvalidProfileError{
+				field, fmt.Sprintf("%d is not a valid port", port)}
+		}
+	}
+	for _, source := range p.Service.AdminSources {
+		if _, _, err := net.ParseCIDR(source); err != nil {
+			return InvalidProfileError{
+				"service.adminSources",
+				fmt.Sprintf("%s is not a CIDR block", source)}
+		}
+	}
+	for i, bucket := range p.Service.DurationBuckets {
+		if bucket <= 0 || (i > 0 && bucket <= p.Service.DurationBuckets[i-1]) {
+			return InvalidProfileError{
+				"service.durationBuckets", "must be positive and increasing"}
+		}
+	}
+	return nil
+}
+
+// InvalidProfileError is returned when a Profile cannot produce valid
+// manifests.
+type InvalidProfileError struct {
+	Field  string
+	Reason string
+}
+
+func (e InvalidProfileError) Error() string {
+	return fmt.Sprintf("invalid profile: %s %s", e.Field, e.Reason)
+}
@@ -0,0 +1,185 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+const profileYAML = `
+namespace:
+  name: perf
+labels:
+  team: mesh
+service:
+  image: mock-service:v2
+  imagePullPolicy: Always
+  port: 9090
+  nodeSelector:
+    pool: services
+  tolerations:
+  - key: dedicated
+    operator: Exists
+client:
+  image: fortio:latest
+  nodeSelector:
+    pool: client
+`
+
+const profileTOML = `
+labels = { team = "mesh" }
+
+[namespace]
+name = "perf"
+
+[service]
+image = "mock-service:v2"
+imagePullPolicy = "Always"
+port = 9090
+nodeSelector = { pool = "services" }
+
+[[service.tolerations]]
+key = "dedicated"
+operator = "Exists"
+
+[client]
+image = "fortio:latest"
+nodeSelector.pool = "client"
+`
+
+func expectedProfile() Profile {
+	p := DefaultProfile()
+	p.Namespace.Name = "perf"
+	p.Labels = map[string]string{"team": "mesh"}
+	p.Service.Image = "mock-service:v2"
+	p.Service.ImagePullPolicy = apiv1.PullAlways
+	p.Service.Port = 9090
+	p.Service.NodeSelector = map[string]string{"pool": "services"}
+	p.Service.Tolerations = []apiv1.Toleration{
+		{Key: "dedicated", Operator: apiv1.TolerationOpExists},
+	}
+	p.Client.Image = "fortio:latest"
+	p.Client.NodeSelector = map[string]string{"pool": "client"}
+	return p
+}
+
+func TestProfileFromYAML(t *testing.T) {
+	actual, err := ProfileFromYAML([]byte(profileYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := expectedProfile(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("\nexpected: %+v\nactual:   %+v", expected, actual)
+	}
+}
+
+func TestProfileFromTOML(t *testing.T) {
+	actual, err := ProfileFromTOML([]byte(profileTOML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := expectedProfile(); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("\nexpected: %+v\nactual:   %+v", expected, actual)
+	}
+}
+
+func TestProfileFromTOML_Invalid(t *testing.T) {
+	tests := []string{
+		"[service]\nport = 01",
+		"[service]\nport = 9223372036854775808",
+		"[service]\ndurationBuckets = [1.]",
+		"[service]\ndurationBuckets = [.5]",
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := ProfileFromTOML([]byte(test)); err == nil {
+				t.Error("expected an error for invalid TOML")
+			}
+		})
+	}
+}
+
+func TestProfileFromYAML_KeepsDefaults(t *testing.T) {
+	actual, err := ProfileFromYAML([]byte("mesh: linkerd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := DefaultProfile()
+	expected.Mesh = MeshLinkerd
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("\nexpected: %+v\nactual:   %+v", expected, actual)
+	}
+}
+
+func TestProfileFromYAML_UnknownField(t *testing.T) {
+	_, err := ProfileFromYAML([]byte("service: {imag: typo}"))
+	if err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+func TestProfile_Validate(t *testing.T) {
+	noNamespace := DefaultProfile()
+	noNamespace.Namespace.Name = ""
+	badPort := DefaultProfile()
+	badPort.Service.Port = 70000
+	badMesh := DefaultProfile()
+	badMesh.Mesh = "envoy"
+	scopedLinkerd := DefaultProfile()
+	scopedLinkerd.Mesh = MeshLinkerd
+	scopedLinkerd.ScopeSidecars = true
+	badAdminSource := DefaultProfile()
+	badAdminSource.Service.AdminSources = []string{"10.0.0.1"}
+	noScraperAccount := DefaultProfile()
+	noScraperAccount.Scraper.ServiceAccount = ""
+	unsortedBuckets := DefaultProfile()
+	unsortedBuckets.Service.DurationBuckets = []float64{0.1, 0.05}
+
+	tests := []struct {
+		profile Profile
+		err     error
+	}{
+		{DefaultProfile(), nil},
+		{noNamespace, InvalidProfileError{"namespace.name", "must be set"}},
+		{
+			badPort,
+			InvalidProfileError{"service.port", "70000 is not a valid port"},
+		},
+		{badMesh, UnknownMeshError{"envoy"}},
+		{
+			scopedLinkerd,
+			InvalidProfileError{"scopeSidecars", "requires the istio mesh"},
+		},
+		{
+			noScraperAccount,
+			InvalidProfileError{"scraper.serviceAccount", "must be set"},
+		},
+		{
+			badAdminSource,
+			InvalidProfileError{
+				"service.adminSources", "10.0.0.1 is not a CIDR block"},
+		},
+		{
+			unsortedBuckets,
+			InvalidProfileError{
+				"service.durationBuckets", "must be positive and increasing"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			err := test.profile.Validate()
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+		})
+	}
+}
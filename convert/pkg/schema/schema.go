@@ -0,0 +1,561 @@
+// Package schema generates a JSON Schema describing service graph documents.
+//
+// The properties of services are derived from the JSON tags of svc.Service,
+// so the schema stays in step with the Go types. Types with custom JSON
+// encodings, such as sizes, percentages and scripts, are described by hand in
+// definitions.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/k8s"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/pct"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/size"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
+)
+
+const (
+	// Draft is the JSON Schema dialect of the generated schema.
+	Draft = "https://json-schema.org/draft/2020-12/schema"
+	// ID identifies the generated schema.
+	ID = "https://github.com/maxfouquet/isotope/convert/service-graph.schema.json"
+)
+
+// Schema is a JSON Schema document or subschema.
+type Schema map[string]interface{}
+
+// definitions maps each type with a custom JSON encoding to its name in
+// "$defs".
+var definitions = map[reflect.Type]string{
+	reflect.TypeOf(size.ByteSize(0)):       "byteSize",
+	reflect.TypeOf(pct.Percentage(0)):      "percentage",
+	reflect.TypeOf(svctype.ServiceType(0)): "serviceType",
+	reflect.TypeOf(script.Script{}):        "script",
+	reflect.TypeOf(&k8s.Settings{}):        "kubernetes",
+	reflect.TypeOf(&policy.Policy{}):       "policy",
+	reflect.TypeOf(policy.Route{}):         "route",
+	reflect.TypeOf(svc.Overflow("")):       "overflow",
+	reflect.TypeOf(&svc.RateLimit{}):       "rateLimit",
+	reflect.TypeOf(&svc.LoadShedding{}):    "loadShedding",
+}
+
+// descriptions documents the properties of services by JSON name.
+var descriptions = map[string]string{
+	"name":         "The DNS-addressable name of the service.",
+	"labels":       "Key/value pairs which select the service into groups.",
+	"type":         "The protocol the service supports.",
+	"numReplicas":  "The number of replicas backing the service.",
+	"isEntrypoint": "Whether the service is a public entrypoint into the graph.",
+	"errorRate":    "The chance that the service is modelled to fail. The mock service does not fail by it.",
+	"responseSize": "The number of bytes in the response body.",
+	"script":       "The commands executed, in order, for each request.",
+	"requestSize":  "The default number of bytes in the body of each call.",
+	"kubernetes":   "How the service is scheduled and sized on Kubernetes.",
+	"policy":       "How a service mesh handles calls to the service.",
+	"edgePolicies": "Route settings for the calls this service makes, by the name of the service called.",
+	"maxConcurrency": "The most requests the service serves at once. " +
+		"If 0, there is no limit.",
+	"queueSize": "The most requests which wait for one of maxConcurrency " +
+		"to finish before overflow applies.",
+	"overflow": "What happens to requests which arrive when the queue is full.",
+	"rateLimit": "Limits the rate at which the service accepts requests, " +
+		"answering the excess 429 Too Many Requests.",
+	"loadShedding": "Rejects requests of low priority while the service is slow.",
+}
+
+// ServiceGraph returns the JSON Schema for service graph documents.
+func ServiceGraph() (Schema, error) {
+	service, err := objectFromStruct(reflect.TypeOf(svc.Service{}))
+	if err != nil {
+		return nil, err
+	}
+	service["required"] = []string{"name"}
+
+	defaults, err := defaultsFromService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	defs := Schema{
+		"service":  service,
+		"defaults": defaults,
+		"group": Schema{
+			"description": "Applies defaults to the services it selects.",
+			"type":        "object",
+			"properties": Schema{
+				"name": Schema{"type": "string"},
+				"selector": Schema{
+					"description": "The labels a service must have to be selected. " +
+						"An empty selector selects every service.",
+					"type":                 "object",
+					"additionalProperties": Schema{"type": "string"},
+				},
+				"defaults": ref("defaults"),
+			},
+			"required":             []string{"name"},
+			"additionalProperties": false,
+		},
+	}
+	for name, s := range leafDefinitions() {
+		defs[name] = s
+	}
+
+	return Schema{
+		"$schema":     Draft,
+		"$id":         ID,
+		"title":       graph.Kind,
+		"description": "A set of services which mock a service-oriented architecture.",
+		"type":        "object",
+		"properties": Schema{
+			"apiVersion": Schema{"const": graph.APIVersion},
+			"kind":       Schema{"const": graph.Kind},
+			"defaults":   ref("defaults"),
+			"groups": Schema{
+				"type":  "array",
+				"items": ref("group"),
+			},
+			"services": Schema{
+				"type":  "array",
+				"items": ref("service"),
+			},
+		},
+		"required":             []string{"services"},
+		"additionalProperties": false,
+		"$defs":                defs,
+	}, nil
+}
+
+// JSON returns the JSON Schema for service graph documents, indented for
+// readability.
+func JSON() ([]byte, error) {
+	s, err := ServiceGraph()
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// objectFromStruct describes the JSON encoding of a struct type by its fields'
+// JSON tags.
+func objectFromStruct(t reflect.Type) (Schema, error) {
+	properties := Schema{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		property, err := fromType(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", t, field.Name, err)
+		}
+		if description, ok := descriptions[name]; ok {
+			property["description"] = description
+		}
+		properties[name] = property
+	}
+	return Schema{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}, nil
+}
+
+// defaultsFromService describes the "defaults" object, which holds the
+// properties of a service that may be shared plus the default request size.
+func defaultsFromService(service Schema) (Schema, error) {
+	serviceProperties := service["properties"].(Schema)
+	properties := Schema{}
+	for _, name := range []string{
+		"type", "numReplicas", "errorRate", "responseSize", "script",
+		"kubernetes", "policy", "maxConcurrency", "queueSize", "overflow",
+		"rateLimit", "loadShedding"} {
+		property, ok := serviceProperties[name]
+		if !ok {
+			return nil, fmt.Errorf("service has no property %s", name)
+		}
+		properties[name] = property
+	}
+	properties["requestSize"] = Schema{
+		"$ref":        "#/$defs/byteSize",
+		"description": descriptions["requestSize"],
+	}
+	return Schema{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}, nil
+}
+
+func fromType(t reflect.Type) (Schema, error) {
+	if name, ok := definitions[t]; ok {
+		return ref(name), nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return Schema{"type": "string"}, nil
+	case reflect.Bool:
+		return Schema{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return Schema{"type": "integer", "minimum": 0}, nil
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}, nil
+	case reflect.Struct:
+		return objectFromStruct(t)
+	case reflect.Slice:
+		items, err := fromType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return Schema{"type": "array", "items": items}, nil
+	case reflect.Map:
+		values, err := fromType(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return Schema{"type": "object", "additionalProperties": values}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+func ref(name string) Schema {
+	return Schema{"$ref": "#/$defs/" + name}
+}
+
+// leafDefinitions describes the types which have custom JSON encodings.
+func leafDefinitions() map[string]Schema {
+	return map[string]Schema{
+		"byteSize": {
+			"description": `A number of bytes, such as 1024, "1KiB" or "16 MB".`,
+			"oneOf": []Schema{
+				{"type": "integer", "minimum": 0},
+				{"type": "string", "pattern": `^\d+(\.\d+)* ?[kKmMgGtTpP]?[iI]?[bB]?$`},
+			},
+		},
+		"percentage": {
+			"description": `A percentage, either between 0 and 1 or between "0%" and "100%".`,
+			"oneOf": []Schema{
+				{"type": "number", "minimum": 0, "maximum": 1},
+				{"type": "string", "pattern": `^(100(\.0*)?|\d?\d(\.\d*)?)%$`},
+			},
+		},
+		"serviceType": {
+			"enum": []string{
+				strings.ToLower(svctype.ServiceHTTP.String()),
+				strings.ToLower(svctype.ServiceGRPC.String()),
+			},
+		},
+		"overflow": {
+			"description": `"reject" responds with 503 Service Unavailable; ` +
+				`"wait" queues the request anyway.`,
+			"enum": []string{string(svc.OverflowReject), string(svc.OverflowWait)},
+		},
+		"rateLimit": {
+			"type": "object",
+			"properties": Schema{
+				"requestsPerSecond": Schema{
+					"description":      "The rate at which the token bucket refills.",
+					"type":             "number",
+					"exclusiveMinimum": 0,
+				},
+				"burst": Schema{
+					"description": "The size of the token bucket. " +
+						"Defaults to requestsPerSecond rounded up.",
+					"type":    "integer",
+					"minimum": 0,
+				},
+				"perCaller": Schema{
+					"description": "Whether each calling service in the graph has a bucket of its own.",
+					"type":        "boolean",
+				},
+			},
+			"required":             []string{"requestsPerSecond"},
+			"additionalProperties": false,
+		},
+		"loadShedding": {
+			"type": "object",
+			"properties": Schema{
+				"latencyTarget": Schema{
+					"$ref": "#/$defs/duration",
+					"description": "The mean time to serve a request over the " +
+						"last second above which requests are shed.",
+				},
+				"minPriority": Schema{
+					"description": "The lowest " + svc.PriorityHeaderKey +
+						" of the requests served while the service is slow. " +
+						"Defaults to 1.",
+					"type":    "integer",
+					"minimum": 0,
+				},
+			},
+			"required":             []string{"latencyTarget"},
+			"additionalProperties": false,
+		},
+		"duration": {
+			"description": `A duration, such as "10ms" or "1.5s".`,
+			"type":        "string",
+			"pattern":     `^(0|(\d+(\.\d*)?(ns|us|µs|μs|ms|s|m|h))+)$`,
+		},
+		"script": {
+			"type":  "array",
+			"items": ref("command"),
+		},
+		"command": {
+			"oneOf": []Schema{
+				ref("sleepCommand"),
+				ref("requestCommand"),
+				ref("concurrentCommand"),
+			},
+		},
+		"sleepCommand": {
+			"description":          "Pauses for a duration.",
+			"type":                 "object",
+			"properties":           Schema{"sleep": ref("duration")},
+			"required":             []string{"sleep"},
+			"additionalProperties": false,
+		},
+		"requestCommand": {
+			"description": "Sends a request to another service.",
+			"type":        "object",
+			"properties": Schema{
+				"call": Schema{
+					"oneOf": []Schema{
+						{"type": "string"},
+						{
+							"type": "object",
+							"properties": Schema{
+								"service": Schema{"type": "string"},
+								"size":    ref("byteSize"),
+							},
+							"required":             []string{"service"},
+							"additionalProperties": false,
+						},
+					},
+				},
+			},
+			"required":             []string{"call"},
+			"additionalProperties": false,
+		},
+		"kubernetes": {
+			"type": "object",
+			"properties": Schema{
+				"resources": ref("resources"),
+				"sidecarResources": Schema{
+					"$ref":        "#/$defs/resources",
+					"description": "Resources of the service mesh's sidecar proxy.",
+				},
+				"nodeSelector": Schema{
+					"type":                 "object",
+					"additionalProperties": Schema{"type": "string"},
+				},
+				"tolerations": Schema{
+					"description": "Kubernetes tolerations of the service's pods.",
+					"type":        "array",
+					"items":       Schema{"type": "object"},
+				},
+				"affinity": Schema{
+					"description": "Kubernetes affinity of the service's pods.",
+					"type":        "object",
+				},
+				"topologySpreadConstraints": Schema{
+					"type":  "array",
+					"items": ref("topologySpreadConstraint"),
+				},
+				"priorityClassName": Schema{"type": "string"},
+			},
+			"additionalProperties": false,
+		},
+		"resources": {
+			"description": "CPU and memory requests and limits.",
+			"type":        "object",
+			"properties": Schema{
+				"requests": ref("resourceList"),
+				"limits":   ref("resourceList"),
+			},
+			"additionalProperties": false,
+		},
+		"resourceList": {
+			"type": "object",
+			"properties": Schema{
+				"cpu":    ref("quantity"),
+				"memory": ref("quantity"),
+			},
+			"additionalProperties": false,
+		},
+		"quantity": {
+			"description": `A Kubernetes quantity, such as 2, "500m" or "128Mi".`,
+			"oneOf": []Schema{
+				{"type": "number", "minimum": 0},
+				{"type": "string", "pattern": `^\d+(\.\d+)?([numkMGTPE]|[KMGTPE]i|[eE]\d+)?$`},
+			},
+		},
+		"topologySpreadConstraint": {
+			"type": "object",
+			"properties": Schema{
+				"maxSkew":     Schema{"type": "integer", "minimum": 1},
+				"topologyKey": Schema{"type": "string"},
+				"whenUnsatisfiable": Schema{
+					"enum": []k8s.UnsatisfiableConstraintAction{
+						k8s.DoNotSchedule, k8s.ScheduleAnyway},
+				},
+				"labelSelector": Schema{
+					"description": "Selects the pods to count. Defaults to the service's own pods.",
+					"type":        "object",
+				},
+			},
+			"required":             []string{"maxSkew", "topologyKey", "whenUnsatisfiable"},
+			"additionalProperties": false,
+		},
+		"policy": {
+			"type": "object",
+			"properties": combineProperties(routeProperties(), Schema{
+				"outlierDetection": Schema{
+					"type": "object",
+					"properties": Schema{
+						"consecutive5xxErrors": Schema{"type": "integer", "minimum": 0},
+						"interval":             ref("duration"),
+						"baseEjectionTime":     ref("duration"),
+						"maxEjectionPercent": Schema{
+							"type": "integer", "minimum": 0, "maximum": 100},
+					},
+					"additionalProperties": false,
+				},
+				"connectionPool": Schema{
+					"type": "object",
+					"properties": Schema{
+						"maxConnections":           Schema{"type": "integer", "minimum": 0},
+						"connectTimeout":           ref("duration"),
+						"http1MaxPendingRequests":  Schema{"type": "integer", "minimum": 0},
+						"http2MaxRequests":         Schema{"type": "integer", "minimum": 0},
+						"maxRequestsPerConnection": Schema{"type": "integer", "minimum": 0},
+						"maxRetries":               Schema{"type": "integer", "minimum": 0},
+					},
+					"additionalProperties": false,
+				},
+				"loadBalancer": Schema{
+					"enum": []policy.LoadBalancer{
+						policy.RoundRobin, policy.LeastRequest, policy.Random,
+						policy.Passthrough},
+				},
+				"mtls": Schema{
+					"enum": []policy.MTLSMode{
+						policy.MTLSStrict, policy.MTLSPermissive, policy.MTLSDisable},
+				},
+			}),
+			"additionalProperties": false,
+		},
+		"route": {
+			"type":                 "object",
+			"properties":           routeProperties(),
+			"additionalProperties": false,
+		},
+		"concurrentCommand": {
+			"description": "Executes its commands simultaneously. May not be nested.",
+			"oneOf": []Schema{
+				ref("concurrentCommands"),
+				{
+					"type": "object",
+					"properties": Schema{
+						"concurrent": Schema{
+							"type": "object",
+							"properties": Schema{
+								"policy": Schema{
+									"description": "Which commands must succeed for the " +
+										"whole to succeed. Defaults to all.",
+									"enum": []script.FailurePolicy{
+										script.All, script.Any, script.Quorum,
+										script.FirstSuccess, script.BestEffort},
+								},
+								"quorum": Schema{
+									"description": "The number of commands which must " +
+										"succeed under the quorum policy.",
+									"type":    "integer",
+									"minimum": 1,
+								},
+								"hedgeDelay": Schema{
+									"$ref": "#/$defs/duration",
+									"description": "How long the firstSuccess policy " +
+										"waits before starting the next command.",
+								},
+								"commands": ref("concurrentCommands"),
+							},
+							"required":             []string{"commands"},
+							"additionalProperties": false,
+						},
+					},
+					"required":             []string{"concurrent"},
+					"additionalProperties": false,
+				},
+			},
+		},
+		"concurrentCommands": {
+			"type": "array",
+			"items": Schema{
+				"oneOf": []Schema{ref("sleepCommand"), ref("requestCommand")},
+			},
+		},
+	}
+}
+
+// routeProperties describes the settings of a policy which may be overridden
+// for each edge.
+func routeProperties() Schema {
+	return Schema{
+		"timeout": ref("duration"),
+		"retries": Schema{
+			"type": "object",
+			"properties": Schema{
+				"attempts":      Schema{"type": "integer", "minimum": 0},
+				"perTryTimeout": ref("duration"),
+				"retryOn":       Schema{"type": "string"},
+			},
+			"required":             []string{"attempts"},
+			"additionalProperties": false,
+		},
+		"fault": Schema{
+			"type": "object",
+			"properties": Schema{
+				"delay": Schema{
+					"type": "object",
+					"properties": Schema{
+						"percentage": ref("percentage"),
+						"fixedDelay": ref("duration"),
+					},
+					"required":             []string{"percentage", "fixedDelay"},
+					"additionalProperties": false,
+				},
+				"abort": Schema{
+					"type": "object",
+					"properties": Schema{
+						"percentage": ref("percentage"),
+						"httpStatus": Schema{
+							"type": "integer", "minimum": 200, "maximum": 599},
+					},
+					"required":             []string{"percentage", "httpStatus"},
+					"additionalProperties": false,
+				},
+			},
+			"additionalProperties": false,
+		},
+	}
+}
+
+// combineProperties returns the union of the properties of schemas.
+func combineProperties(schemas ...Schema) Schema {
+	c := Schema{}
+	for _, s := range schemas {
+		for k, v := range s {
+			c[k] = v
+		}
+	}
+	return c
+}
@@ -0,0 +1,255 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+const exampleTopologiesGlob = "../../../example-topologies/*.yaml"
+
+func TestServiceGraph_ExampleTopologies(t *testing.T) {
+	root := decodedSchema(t)
+
+	paths, err := filepath.Glob(exampleTopologiesGlob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no files match %s", exampleTopologiesGlob)
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			t.Parallel()
+
+			yamlContents, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := validateYAML(root, yamlContents); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestServiceGraph_Invalid(t *testing.T) {
+	root := decodedSchema(t)
+
+	tests := []struct {
+		input   string
+		isValid bool
+	}{
+		{"services: [{name: a, errorRate: 20%}]", true},
+		{"services: [{name: a, errorRate: 0.2}]", true},
+		{"services: [{name: a, errorRate: 120%}]", false},
+		{"services: [{name: a, errorRate: 1.2}]", false},
+		{"services: [{name: a, responseSize: 10 KB}]", true},
+		{"services: [{name: a, responseSize: -1}]", false},
+		{"services: [{name: a, type: grpc}]", true},
+		{"services: [{name: a, type: tcp}]", false},
+		{"services: [{name: a, script: [{call: b}, {sleep: 1.5s}]}]", true},
+		{"services: [{name: a, script: [{cal: b}]}]", false},
+		{"services: [{name: a, script: [{sleep: 10}]}]", false},
+		{"services: [{name: a, script: [[{call: b}, {call: {service: c, size: 1K}}]]}]", true},
+		{"services: [{name: a, script: [[[{call: b}]]]}]", false},
+		{"services: [{numReplicas: 1}]", false},
+		{"{kind: MockServiceGraph, apiVersion: v1alpha1, services: []}", true},
+		{"{kind: ServiceGraph, services: []}", false},
+		{"{defaults: {requestSize: 1 KB}, services: []}", true},
+		{"{defaults: {name: a}, services: []}", false},
+		{"services: [{name: a, labels: {tier: frontend}}]", true},
+		{"services: [{name: a, labels: {replicas: 1}}]", false},
+		{"{groups: [{name: g, selector: {tier: data}, defaults: {numReplicas: 3}}], services: []}", true},
+		{"{groups: [{selector: {tier: data}}], services: []}", false},
+		{"{groups: [{name: g, defaults: {labels: {a: b}}}], services: []}", false},
+		{"services: [{name: a, kubernetes: {resources: {requests: {cpu: 500m, memory: 128Mi}, limits: {cpu: 1}}}}]", true},
+		{"services: [{name: a, kubernetes: {resources: {requests: {cpu: lots}}}}]", false},
+		{"services: [{name: a, kubernetes: {topologySpreadConstraints: [{maxSkew: 1, topologyKey: zone, whenUnsatisfiable: DoNotSchedule}]}}]", true},
+		{"services: [{name: a, kubernetes: {topologySpreadConstraints: [{maxSkew: 1, topologyKey: zone, whenUnsatisfiable: Never}]}}]", false},
+		{"services: [{name: a, kubernetes: {priorityClassName: high, tolerations: [{key: k, operator: Exists}]}}]", true},
+		{"{defaults: {kubernetes: {nodeSelector: {pool: services}}}, services: []}", true},
+		{"services: [{name: a, policy: {timeout: 2s, retries: {attempts: 3}, fault: {abort: {percentage: 1%, httpStatus: 503}}, mtls: STRICT}}]", true},
+		{"services: [{name: a, policy: {loadBalancer: FASTEST}}]", false},
+		{"services: [{name: a, edgePolicies: {b: {timeout: 1s}}}]", true},
+		{"services: [{name: a, edgePolicies: {b: {mtls: STRICT}}}]", false},
+		{"{defaults: {policy: {outlierDetection: {consecutive5xxErrors: 5, interval: 10s}}}, services: []}", true},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.input, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateYAML(root, []byte(test.input))
+			if test.isValid && err != nil {
+				t.Errorf("expected valid; actual %v", err)
+			}
+			if !test.isValid && err == nil {
+				t.Errorf("expected invalid; actual valid")
+			}
+		})
+	}
+}
+
+func decodedSchema(t *testing.T) map[string]interface{} {
+	b, err := JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var root map[string]interface{}
+	if err := json.Unmarshal(b, &root); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func validateYAML(root map[string]interface{}, yamlContents []byte) error {
+	jsonContents, err := yaml.YAMLToJSON(yamlContents)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(jsonContents, &doc); err != nil {
+		return err
+	}
+	return validate(root, root, doc, "$")
+}
+
+// validate checks v against s, supporting the subset of JSON Schema keywords
+// used by ServiceGraph.
+func validate(
+	root map[string]interface{}, s map[string]interface{}, v interface{},
+	path string) error {
+	if r, ok := s["$ref"].(string); ok {
+		name := strings.TrimPrefix(r, "#/$defs/")
+		def, ok := root["$defs"].(map[string]interface{})[name]
+		if !ok {
+			return fmt.Errorf("%s: unresolvable $ref %s", path, r)
+		}
+		if err := validate(root, def.(map[string]interface{}), v, path); err != nil {
+			return err
+		}
+	}
+	if typ, ok := s["type"].(string); ok && !hasType(v, typ) {
+		return fmt.Errorf("%s: %v is not of type %s", path, v, typ)
+	}
+	if c, ok := s["const"]; ok && !reflect.DeepEqual(c, v) {
+		return fmt.Errorf("%s: %v is not %v", path, v, c)
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			found = found || reflect.DeepEqual(e, v)
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", path, v, enum)
+		}
+	}
+	if pattern, ok := s["pattern"].(string); ok {
+		if str, ok := v.(string); ok && !regexp.MustCompile(pattern).MatchString(str) {
+			return fmt.Errorf("%s: %q does not match %s", path, str, pattern)
+		}
+	}
+	if f, ok := v.(float64); ok {
+		if min, ok := s["minimum"].(float64); ok && f < min {
+			return fmt.Errorf("%s: %v is less than %v", path, f, min)
+		}
+		if max, ok := s["maximum"].(float64); ok && f > max {
+			return fmt.Errorf("%s: %v is greater than %v", path, f, max)
+		}
+	}
+	if oneOf, ok := s["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, sub := range oneOf {
+			if validate(root, sub.(map[string]interface{}), v, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s: %v matches %d subschemas of oneOf", path, v, matches)
+		}
+	}
+	if obj, ok := v.(map[string]interface{}); ok {
+		properties, _ := s["properties"].(map[string]interface{})
+		for _, name := range requiredNames(s) {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %s", path, name)
+			}
+		}
+		for name, value := range obj {
+			property, ok := properties[name]
+			if !ok {
+				switch additional := s["additionalProperties"].(type) {
+				case bool:
+					if !additional {
+						return fmt.Errorf("%s: unexpected property %s", path, name)
+					}
+				case map[string]interface{}:
+					err := validate(root, additional, value, path+"."+name)
+					if err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			err := validate(root, property.(map[string]interface{}), value, path+"."+name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if arr, ok := v.([]interface{}); ok {
+		if items, ok := s["items"].(map[string]interface{}); ok {
+			for i, item := range arr {
+				if err := validate(root, items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func requiredNames(s map[string]interface{}) []string {
+	required, _ := s["required"].([]interface{})
+	names := make([]string, 0, len(required))
+	for _, name := range required {
+		names = append(names, name.(string))
+	}
+	return names
+}
+
+func hasType(v interface{}, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,207 @@
+// Package transform derives new service graphs from existing ones.
+//
+// Every Transformation returns a new graph and leaves its input untouched.
+// References to services in each RequestCommand are kept consistent with the
+// services in the resulting graph.
+package transform
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+)
+
+// Transformation converts one ServiceGraph into another.
+type Transformation func(graph.ServiceGraph) (graph.ServiceGraph, error)
+
+// Apply applies each transformation to g in order and validates the result.
+func Apply(
+	g graph.ServiceGraph, transformations ...Transformation) (
+	graph.ServiceGraph, error) {
+	for _, transformation := range transformations {
+		var err error
+		g, err = transformation(g)
+		if err != nil {
+			return graph.ServiceGraph{}, err
+		}
+	}
+	if err := graph.Validate(g); err != nil {
+		return graph.ServiceGraph{}, err
+	}
+	return g, nil
+}
+
+// ScaleReplicas multiplies the number of replicas of every service by factor,
+// rounding to the nearest integer. Every service keeps at least one replica.
+func ScaleReplicas(factor float64) Transformation {
+	return func(g graph.ServiceGraph) (graph.ServiceGraph, error) {
+		if factor <= 0 {
+			return g, NonPositiveFactorError{factor}
+		}
+		return mapServices(g, func(service svc.Service) svc.Service {
+			scaled := int32(math.Round(float64(service.NumReplicas) * factor))
+			if scaled < 1 {
+				scaled = 1
+			}
+			service.NumReplicas = scaled
+			return service
+		}), nil
+	}
+}
+
+// ScaleSleeps multiplies the duration of every SleepCommand by factor.
+func ScaleSleeps(factor float64) Transformation {
+	return func(g graph.ServiceGraph) (graph.ServiceGraph, error) {
+		if factor <= 0 {
+			return g, NonPositiveFactorError{factor}
+		}
+		return mapServices(g, func(service svc.Service) svc.Service {
+			service.Script = mapCommands(
+				service.Script, func(cmd script.Command) script.Command {
+					if sleep, ok := cmd.(script.SleepCommand); ok {
+						return script.SleepCommand(
+							time.Duration(float64(sleep) * factor))
+					}
+					return cmd
+				})
+			return service
+		}), nil
+	}
+}
+
+// Prefix prepends prefix to the name of every service and to every reference
+// to it, including the keys of edge policies.
+func Prefix(prefix string) Transformation {
+	return func(g graph.ServiceGraph) (graph.ServiceGraph, error) {
+		return mapServices(g, func(service svc.Service) svc.Service {
+			service.Name = prefix + service.Name
+			if service.EdgePolicies != nil {
+				edgePolicies := make(
+					map[string]policy.Route, len(service.EdgePolicies))
+				for callee, route := range service.EdgePolicies {
+					edgePolicies[prefix+callee] = route
+				}
+				service.EdgePolicies = edgePolicies
+			}
+			service.Script = mapCommands(
+				service.Script, func(cmd script.Command) script.Command {
+					if request, ok := cmd.(script.RequestCommand); ok {
+						request.ServiceName = prefix + request.ServiceName
+						return request
+					}
+					return cmd
+				})
+			return service
+		}), nil
+	}
+}
+
+// Extract keeps only the service named root and the services reachable from
+// it through calls. root is marked as the only entrypoint.
+func Extract(root string) Transformation {
+	return func(g graph.ServiceGraph) (graph.ServiceGraph, error) {
+		services := make(map[string]svc.Service, len(g.Services))
+		for _, service := range g.Services {
+			services[service.Name] = service
+		}
+		if _, ok := services[root]; !ok {
+			return g, graph.ErrRequestToUndefinedService{ServiceName: root}
+		}
+
+		reachable := map[string]bool{}
+		var visit func(name string)
+		visit = func(name string) {
+			if reachable[name] {
+				return
+			}
+			reachable[name] = true
+			for _, callee := range graph.Callees(services[name]) {
+				visit(callee)
+			}
+		}
+		visit(root)
+
+		extracted := graph.ServiceGraph{
+			Services: make([]svc.Service, 0, len(reachable)),
+		}
+		for _, service := range g.Services {
+			if reachable[service.Name] {
+				service.IsEntrypoint = service.Name == root
+				extracted.Services = append(extracted.Services, service)
+			}
+		}
+		return extracted, nil
+	}
+}
+
+// Merge appends the services of other to the graph. The names of the services
+// in both graphs must be distinct; see Prefix.
+func Merge(other graph.ServiceGraph) Transformation {
+	return func(g graph.ServiceGraph) (graph.ServiceGraph, error) {
+		names := make(map[string]bool, len(g.Services))
+		for _, service := range g.Services {
+			names[service.Name] = true
+		}
+		merged := graph.ServiceGraph{
+			Services: make([]svc.Service, 0, len(g.Services)+len(other.Services)),
+		}
+		merged.Services = append(merged.Services, g.Services...)
+		for _, service := range other.Services {
+			if names[service.Name] {
+				return g, graph.ErrDuplicateService{ServiceName: service.Name}
+			}
+			merged.Services = append(merged.Services, service)
+		}
+		return merged, nil
+	}
+}
+
+// mapServices returns a copy of g with f applied to each service.
+func mapServices(
+	g graph.ServiceGraph, f func(svc.Service) svc.Service) graph.ServiceGraph {
+	mapped := graph.ServiceGraph{
+		Services: make([]svc.Service, 0, len(g.Services)),
+	}
+	for _, service := range g.Services {
+		mapped.Services = append(mapped.Services, f(service))
+	}
+	return mapped
+}
+
+// mapCommands returns a copy of s with f applied to each non-concurrent
+// command, including those nested in ConcurrentCommands.
+func mapCommands(
+	s script.Script, f func(script.Command) script.Command) script.Script {
+	if s == nil {
+		return nil
+	}
+	mapped := make(script.Script, 0, len(s))
+	for _, cmd := range s {
+		if concurrent, ok := cmd.(script.ConcurrentCommand); ok {
+			mappedCmds := make([]script.Command, 0, len(concurrent.Commands))
+			for _, subCmd := range concurrent.Commands {
+				mappedCmds = append(mappedCmds, f(subCmd))
+			}
+			concurrent.Commands = mappedCmds
+			mapped = append(mapped, concurrent)
+		} else {
+			mapped = append(mapped, f(cmd))
+		}
+	}
+	return mapped
+}
+
+// NonPositiveFactorError is returned when scaling by a factor that would
+// produce an invalid graph.
+type NonPositiveFactorError struct {
+	Factor float64
+}
+
+func (e NonPositiveFactorError) Error() string {
+	return fmt.Sprintf("scale factor %v must be positive", e.Factor)
+}
@@ -0,0 +1,148 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+)
+
+var testGraph = graph.ServiceGraph{Services: []svc.Service{
+	{Name: "a", NumReplicas: 1},
+	{
+		Name:        "b",
+		NumReplicas: 3,
+		Script: script.Script{
+			script.SleepCommand(10 * time.Millisecond),
+			script.RequestCommand{ServiceName: "a", Size: 10},
+		},
+		EdgePolicies: map[string]policy.Route{
+			"a": {Timeout: policy.Duration(time.Second)},
+		},
+	},
+	{
+		Name:         "c",
+		NumReplicas:  2,
+		IsEntrypoint: true,
+		Script: script.Script{
+			script.ConcurrentCommand{Commands: []script.Command{
+				script.RequestCommand{ServiceName: "b"},
+				script.SleepCommand(5 * time.Millisecond),
+			}},
+		},
+	},
+}}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		transformations []Transformation
+		graph           graph.ServiceGraph
+		err             error
+	}{
+		{
+			[]Transformation{ScaleReplicas(0.5), ScaleSleeps(2)},
+			graph.ServiceGraph{Services: []svc.Service{
+				{Name: "a", NumReplicas: 1},
+				{
+					Name:        "b",
+					NumReplicas: 2,
+					Script: script.Script{
+						script.SleepCommand(20 * time.Millisecond),
+						script.RequestCommand{ServiceName: "a", Size: 10},
+					},
+					EdgePolicies: map[string]policy.Route{
+						"a": {Timeout: policy.Duration(time.Second)},
+					},
+				},
+				{
+					Name:         "c",
+					NumReplicas:  1,
+					IsEntrypoint: true,
+					Script: script.Script{
+						script.ConcurrentCommand{Commands: []script.Command{
+							script.RequestCommand{ServiceName: "b"},
+							script.SleepCommand(10 * time.Millisecond),
+						}},
+					},
+				},
+			}},
+			nil,
+		},
+		{
+			[]Transformation{Extract("b"), Prefix("x-")},
+			graph.ServiceGraph{Services: []svc.Service{
+				{Name: "x-a", NumReplicas: 1},
+				{
+					Name:         "x-b",
+					NumReplicas:  3,
+					IsEntrypoint: true,
+					Script: script.Script{
+						script.SleepCommand(10 * time.Millisecond),
+						script.RequestCommand{ServiceName: "x-a", Size: 10},
+					},
+					EdgePolicies: map[string]policy.Route{
+						"x-a": {Timeout: policy.Duration(time.Second)},
+					},
+				},
+			}},
+			nil,
+		},
+		{
+			[]Transformation{Extract("a"), Merge(testGraph)},
+			graph.ServiceGraph{},
+			graph.ErrDuplicateService{ServiceName: "a"},
+		},
+		{
+			[]Transformation{Extract("z")},
+			graph.ServiceGraph{},
+			graph.ErrRequestToUndefinedService{ServiceName: "z"},
+		},
+		{
+			[]Transformation{ScaleReplicas(0)},
+			graph.ServiceGraph{},
+			NonPositiveFactorError{0},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := Apply(testGraph, test.transformations...)
+			if test.err != err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+			if !reflect.DeepEqual(test.graph, actual) {
+				t.Errorf("expected %v; actual %v", test.graph, actual)
+			}
+		})
+	}
+}
+
+func TestMerge_Prefixed(t *testing.T) {
+	teamA, err := Apply(testGraph, Prefix("team-a-"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	teamB, err := Apply(testGraph, Prefix("team-b-"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := Apply(teamA, Merge(teamB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.Services) != 2*len(testGraph.Services) {
+		t.Errorf(
+			"expected %d services; actual %d",
+			2*len(testGraph.Services), len(merged.Services))
+	}
+	if testGraph.Services[1].Name != "b" {
+		t.Errorf("input graph was modified: %v", testGraph)
+	}
+}
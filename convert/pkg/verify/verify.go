@@ -0,0 +1,373 @@
+// Package verify checks that a deployed service graph behaves as its topology
+// specifies, by comparing the call trees returned by its mock services with
+// the topology.
+package verify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/calltree"
+	"github.com/maxfouquet/isotope/convert/pkg/diff"
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/pct"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+)
+
+// DefaultTolerance is the default of Options.Tolerance.
+const DefaultTolerance = 0.05
+
+// Options controls how a deployed service graph is verified.
+type Options struct {
+	// Requests is the number of requests sent to the entrypoint.
+	Requests int
+	// Tolerance is the most by which the observed success rate of each service
+	// may differ from the rate its error rates imply, from 0 to 1.
+	Tolerance float64
+	// Client sends the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Report describes how a deployed service graph behaved.
+type Report struct {
+	// Requests is the number of call trees checked.
+	Requests   int             `json:"requests"`
+	Services   []ServiceReport `json:"services"`
+	Mismatches []Mismatch      `json:"mismatches,omitempty"`
+}
+
+// ServiceReport compares how often calls to a service succeeded with how often
+// they are expected to.
+type ServiceReport struct {
+	Name                string         `json:"name"`
+	Calls               int            `json:"calls"`
+	Failures            int            `json:"failures"`
+	ExpectedSuccessRate pct.Percentage `json:"expectedSuccessRate"`
+	ObservedSuccessRate pct.Percentage `json:"observedSuccessRate"`
+}
+
+// Mismatch is a way in which the service graph did not behave as specified.
+type Mismatch struct {
+	// Path is the path of services from the entrypoint to the service which
+	// misbehaved, like "a>b".
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	// Count is the number of times the mismatch was observed.
+	Count int `json:"count"`
+}
+
+func (m Mismatch) String() string {
+	if m.Count > 1 {
+		return fmt.Sprintf("%s: %s (%d times)", m.Path, m.Reason, m.Count)
+	}
+	return fmt.Sprintf("%s: %s", m.Path, m.Reason)
+}
+
+// OK returns true if the service graph behaved as specified.
+func (r Report) OK() bool {
+	return len(r.Mismatches) == 0
+}
+
+func (r Report) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%d requests\n", r.Requests)
+	for _, service := range r.Services {
+		fmt.Fprintf(
+			&b, "service %s: %d calls, %s succeeded (expected %s)\n",
+			service.Name, service.Calls, service.ObservedSuccessRate,
+			service.ExpectedSuccessRate)
+	}
+	if r.OK() {
+		b.WriteString("no mismatches\n")
+	}
+	for _, mismatch := range r.Mismatches {
+		fmt.Fprintf(&b, "mismatch: %s\n", mismatch)
+	}
+	return b.String()
+}
+
+// Run sends opts.Requests requests to the entrypoint at url, asking for their
+// call trees, and checks the trees against g. An error is returned only if a
+// request could not be sent.
+func Run(g graph.ServiceGraph, url string, opts Options) (Report, error) {
+	client := opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	trees := make([]calltree.Tree, 0, opts.Requests)
+	missing := 0
+	for i := 0; i < opts.Requests; i++ {
+		tree, err := fetchCallTree(client, url)
+		if err != nil {
+			return Report{}, err
+		}
+		if tree == nil {
+			missing++
+			continue
+		}
+		trees = append(trees, *tree)
+	}
+	report := Check(g, trees, opts.Tolerance)
+	report.Requests = opts.Requests
+	if missing > 0 {
+		report.Mismatches = append([]Mismatch{{
+			Path:   url,
+			Reason: "the response held no call tree",
+			Count:  missing,
+		}}, report.Mismatches...)
+	}
+	return report, nil
+}
+
+// fetchCallTree requests the call tree of a request to url. It returns nil if
+// the response does not hold one.
+func fetchCallTree(client *http.Client, url string) (*calltree.Tree, error) {
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set(calltree.HeaderKey, "true")
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var tree calltree.Tree
+	if err := json.NewDecoder(response.Body).Decode(&tree); err != nil {
+		return nil, nil
+	}
+	return &tree, nil
+}
+
+// Check compares trees, the call trees of requests to entrypoints of g, with
+// g. Besides mismatches in their structure, it reports each service whose
+// success rate differs by more than tolerance from the rate implied by the
+// failure policies of g. The mock service does not fail by its error rate, so
+// the error rates of g are left out.
+func Check(
+	g graph.ServiceGraph, trees []calltree.Tree, tolerance float64) Report {
+	c := checker{
+		services:    map[string]svc.Service{},
+		entrypoints: map[string]bool{},
+		stats:       map[string]*ServiceReport{},
+		mismatches:  map[Mismatch]int{},
+	}
+	for _, service := range g.Services {
+		c.services[service.Name] = service
+	}
+	for _, name := range graph.Entrypoints(g) {
+		c.entrypoints[name] = true
+	}
+	for _, tree := range trees {
+		if !c.entrypoints[tree.Service] {
+			c.mismatch(tree.Service, "is not an entrypoint")
+		}
+		c.observeCall(tree.Service, tree.Status, "")
+		c.checkTree(tree, tree.Service)
+	}
+
+	report := Report{Requests: len(trees)}
+	probabilities := graph.NewSuccessProbabilities(withoutErrorRates(g))
+	names := make([]string, 0, len(c.stats))
+	for name := range c.stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		stats := c.stats[name]
+		stats.ExpectedSuccessRate = probabilities.OfService(name)
+		stats.ObservedSuccessRate = pct.Percentage(
+			float64(stats.Calls-stats.Failures) / float64(stats.Calls))
+		report.Services = append(report.Services, *stats)
+		difference := float64(
+			stats.ObservedSuccessRate - stats.ExpectedSuccessRate)
+		if math.Abs(difference) > tolerance {
+			c.mismatch(name, fmt.Sprintf(
+				"%s of calls succeeded; expected %s", stats.ObservedSuccessRate,
+				stats.ExpectedSuccessRate))
+		}
+	}
+	for mismatch, count := range c.mismatches {
+		mismatch.Count = count
+		report.Mismatches = append(report.Mismatches, mismatch)
+	}
+	sort.Slice(report.Mismatches, func(i, j int) bool {
+		a, b := report.Mismatches[i], report.Mismatches[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Reason < b.Reason
+	})
+	return report
+}
+
+// pathSeparator joins the services of a Mismatch's Path.
+const pathSeparator = ">"
+
+type checker struct {
+	services    map[string]svc.Service
+	entrypoints map[string]bool
+	stats       map[string]*ServiceReport
+	// mismatches counts each mismatch, keyed with a Count of 0.
+	mismatches map[Mismatch]int
+}
+
+func (c checker) mismatch(path string, reason string) {
+	c.mismatches[Mismatch{Path: path, Reason: reason}]++
+}
+
+// observeCall counts a call to the service named name, which failed unless it
+// responded with 200 OK and without an error.
+func (c checker) observeCall(name string, status int, err string) {
+	stats, ok := c.stats[name]
+	if !ok {
+		stats = &ServiceReport{Name: name}
+		c.stats[name] = stats
+	}
+	stats.Calls++
+	if status != http.StatusOK || err != "" {
+		stats.Failures++
+	}
+}
+
+// checkTree checks tree, the call tree of the service at path, against the
+// service's script.
+func (c checker) checkTree(tree calltree.Tree, path string) {
+	service, ok := c.services[tree.Service]
+	if !ok {
+		c.mismatch(path, "is not in the service graph")
+		return
+	}
+	if len(tree.Steps) > len(service.Script) {
+		c.mismatch(path, fmt.Sprintf(
+			"executed %d steps; the script has %d",
+			len(tree.Steps), len(service.Script)))
+		return
+	}
+	failed := false
+	for i, step := range tree.Steps {
+		c.checkStep(service.Script[i], step, path, fmt.Sprintf("step %d", i))
+		failed = failed || step.Error != ""
+	}
+	switch {
+	case failed && tree.Status == http.StatusOK:
+		c.mismatch(path, "responded 200 OK although a step failed")
+	case !failed && len(tree.Steps) < len(service.Script) &&
+		len(tree.Steps) > 0:
+		c.mismatch(path, fmt.Sprintf(
+			"stopped after %d of %d steps without an error",
+			len(tree.Steps), len(service.Script)))
+	case !failed && tree.Status != http.StatusOK && len(tree.Steps) > 0:
+		c.mismatch(path, fmt.Sprintf(
+			"responded %d although every step succeeded", tree.Status))
+	case !failed && len(tree.Steps) == 0 && len(service.Script) > 0 &&
+		tree.Status == http.StatusOK:
+		c.mismatch(path, "responded 200 OK without executing its script")
+	}
+}
+
+// checkStep checks step, executed at index of the service at path, against
+// cmd.
+func (c checker) checkStep(
+	cmd script.Command, step calltree.Step, path string, index string) {
+	mismatched := func() {
+		c.mismatch(path, fmt.Sprintf(
+			"%s: expected %s; executed %s",
+			index, diff.StepString(cmd), stepString(step)))
+	}
+	switch cmd := cmd.(type) {
+	case script.SleepCommand:
+		if step.Sleep == nil || time.Duration(*step.Sleep) != time.Duration(cmd) {
+			mismatched()
+		} else if step.Duration < *step.Sleep {
+			c.mismatch(path, fmt.Sprintf(
+				"%s: slept for %s, less than %s", index, step.Duration, cmd))
+		}
+	case script.RequestCommand:
+		if step.Call == nil || step.Call.Service != cmd.ServiceName {
+			mismatched()
+			return
+		}
+		call := *step.Call
+		c.observeCall(call.Service, call.Status, step.Error)
+		calleePath := strings.Join([]string{path, call.Service}, pathSeparator)
+		switch {
+		case call.Tree != nil:
+			if call.Tree.Service != call.Service {
+				c.mismatch(calleePath, fmt.Sprintf(
+					"was served by %s", call.Tree.Service))
+				return
+			}
+			c.checkTree(*call.Tree, calleePath)
+		case step.Error == "" && call.Status == http.StatusOK:
+			c.mismatch(calleePath, "the response held no call tree")
+		}
+	case script.ConcurrentCommand:
+		if step.Concurrent == nil || len(step.Concurrent) != len(cmd.Commands) {
+			mismatched()
+			return
+		}
+		succeeded := 0
+		for i, subStep := range step.Concurrent {
+			// Steps cancelled by the group's policy may have done anything.
+			if subStep.Canceled {
+				continue
+			}
+			c.checkStep(
+				cmd.Commands[i], subStep, path, fmt.Sprintf("%s.%d", index, i))
+			if subStep.Error == "" {
+				succeeded++
+			}
+		}
+		required := cmd.Required()
+		switch {
+		case step.Error == "" && succeeded < required:
+			c.mismatch(path, fmt.Sprintf(
+				"%s: succeeded with %d of %d steps; %d are required",
+				index, succeeded, len(cmd.Commands), required))
+		case step.Error != "" && succeeded >= required:
+			c.mismatch(path, fmt.Sprintf(
+				"%s: failed although %d of %d steps succeeded; %d are required",
+				index, succeeded, len(cmd.Commands), required))
+		}
+	}
+}
+
+// stepString formats an executed step like diff.StepString formats a script
+// command.
+func stepString(step calltree.Step) string {
+	switch {
+	case step.Canceled && step.Sleep == nil && step.Call == nil:
+		return "canceled"
+	case step.Sleep != nil:
+		return fmt.Sprintf("sleep %s", step.Sleep)
+	case step.Call != nil:
+		return fmt.Sprintf("call %s", step.Call.Service)
+	case step.Concurrent != nil:
+		subSteps := make([]string, 0, len(step.Concurrent))
+		for _, subStep := range step.Concurrent {
+			subSteps = append(subSteps, stepString(subStep))
+		}
+		return fmt.Sprintf("concurrently [%s]", strings.Join(subSteps, ", "))
+	default:
+		return "nothing"
+	}
+}
+
+// withoutErrorRates returns a copy of g in which no service has an error rate.
+func withoutErrorRates(g graph.ServiceGraph) graph.ServiceGraph {
+	services := make([]svc.Service, len(g.Services))
+	for i, service := range g.Services {
+		service.ErrorRate = 0
+		services[i] = service
+	}
+	g.Services = services
+	return g
+}
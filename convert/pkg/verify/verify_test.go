@@ -0,0 +1,293 @@
+package verify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/builder"
+	"github.com/maxfouquet/isotope/convert/pkg/calltree"
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+)
+
+func testGraph(t *testing.T) graph.ServiceGraph {
+	g, err := builder.NewGraph().
+		Service("a").Entrypoint().
+		Sleep(10 * time.Millisecond).
+		Call("b").
+		Concurrently(func(c *builder.ConcurrentBuilder) {
+			c.Call("c").Sleep(time.Millisecond)
+		}).
+		Service("b").
+		Service("c").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// emulate returns the call tree with which the mock service named name in g
+// would respond if every call succeeded, as the service does in-process.
+func emulate(g graph.ServiceGraph, name string) *calltree.Tree {
+	for _, service := range g.Services {
+		if service.Name != name {
+			continue
+		}
+		tree := &calltree.Tree{Service: name, Status: http.StatusOK}
+		for _, cmd := range service.Script {
+			tree.Steps = append(tree.Steps, emulateStep(g, cmd))
+		}
+		return tree
+	}
+	return nil
+}
+
+func emulateStep(g graph.ServiceGraph, cmd script.Command) calltree.Step {
+	switch cmd := cmd.(type) {
+	case script.SleepCommand:
+		sleep := policy.Duration(cmd)
+		return calltree.Step{Sleep: &sleep, Duration: sleep}
+	case script.RequestCommand:
+		return calltree.Step{Call: &calltree.Call{
+			Service: cmd.ServiceName,
+			Status:  http.StatusOK,
+			Tree:    emulate(g, cmd.ServiceName),
+		}}
+	case script.ConcurrentCommand:
+		step := calltree.Step{Concurrent: []calltree.Step{}}
+		for _, subCmd := range cmd.Commands {
+			step.Concurrent = append(step.Concurrent, emulateStep(g, subCmd))
+		}
+		return step
+	default:
+		return calltree.Step{}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	g := testGraph(t)
+
+	wrongCallee := emulate(g, "a")
+	wrongCallee.Steps[1].Call = &calltree.Call{
+		Service: "c", Status: http.StatusOK, Tree: emulate(g, "c")}
+
+	missingConcurrentStep := emulate(g, "a")
+	missingConcurrentStep.Steps[2].Concurrent =
+		missingConcurrentStep.Steps[2].Concurrent[:1]
+
+	failedCall := emulate(g, "a")
+	failedCall.Status = http.StatusInternalServerError
+	failedCall.Steps = failedCall.Steps[:2]
+	failedCall.Steps[1].Call = &calltree.Call{Service: "b"}
+	failedCall.Steps[1].Error = "connection refused"
+
+	stoppedEarly := emulate(g, "a")
+	stoppedEarly.Steps = stoppedEarly.Steps[:1]
+
+	noTree := emulate(g, "a")
+	noTree.Steps[1].Call.Tree = nil
+
+	tests := []struct {
+		name       string
+		trees      []calltree.Tree
+		mismatches []Mismatch
+	}{
+		{"conforming", []calltree.Tree{*emulate(g, "a")}, nil},
+		{
+			"wrong callee",
+			[]calltree.Tree{*wrongCallee},
+			[]Mismatch{{
+				"a", "step 1: expected call b (0B); executed call c", 1}},
+		},
+		{
+			"missing concurrent step",
+			[]calltree.Tree{*missingConcurrentStep, *missingConcurrentStep},
+			[]Mismatch{{
+				"a",
+				"step 2: expected concurrently [call c (0B), sleep 1ms]; " +
+					"executed concurrently [call c]",
+				2,
+			}},
+		},
+		{
+			"failed call",
+			[]calltree.Tree{*failedCall},
+			[]Mismatch{
+				{"a", "0.00% of calls succeeded; expected 100.00%", 1},
+				{"b", "0.00% of calls succeeded; expected 100.00%", 1},
+			},
+		},
+		{
+			"stopped early",
+			[]calltree.Tree{*stoppedEarly},
+			[]Mismatch{{"a", "stopped after 1 of 3 steps without an error", 1}},
+		},
+		{
+			"no tree",
+			[]calltree.Tree{*noTree},
+			[]Mismatch{{"a>b", "the response held no call tree", 1}},
+		},
+		{
+			"not an entrypoint",
+			[]calltree.Tree{*emulate(g, "b")},
+			[]Mismatch{{"b", "is not an entrypoint", 1}},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			report := Check(g, test.trees, DefaultTolerance)
+			if !reflect.DeepEqual(test.mismatches, report.Mismatches) {
+				t.Errorf(
+					"expected %v; actual %v", test.mismatches, report.Mismatches)
+			}
+		})
+	}
+}
+
+func TestCheck_IgnoresErrorRate(t *testing.T) {
+	g, err := builder.NewGraph().
+		Service("a").Entrypoint().ErrorRate(0.5).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	succeeded := calltree.Tree{Service: "a", Status: http.StatusOK}
+	failed := calltree.Tree{
+		Service: "a", Status: http.StatusInternalServerError}
+
+	tests := []struct {
+		trees []calltree.Tree
+		ok    bool
+	}{
+		{[]calltree.Tree{succeeded, succeeded, succeeded, succeeded}, true},
+		{[]calltree.Tree{succeeded, failed, failed, succeeded}, false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run("", func(t *testing.T) {
+			t.Parallel()
+
+			report := Check(g, test.trees, DefaultTolerance)
+			if test.ok != report.OK() {
+				t.Errorf("expected OK %v; actual %v", test.ok, report)
+			}
+		})
+	}
+}
+
+func TestCheck_FailurePolicy(t *testing.T) {
+	g, err := builder.NewGraph().
+		Service("a").Entrypoint().
+		Concurrently(func(c *builder.ConcurrentBuilder) {
+			c.Hedge(5 * time.Millisecond).Call("b").Call("c")
+		}).
+		Service("b").
+		Service("c").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hedged := emulate(g, "a")
+	hedged.Steps[0].Concurrent[1] = calltree.Step{Canceled: true}
+
+	failed := func(service string) calltree.Step {
+		return calltree.Step{
+			Call:  &calltree.Call{Service: service},
+			Error: "connection refused",
+		}
+	}
+	succeededWithoutSuccess := emulate(g, "a")
+	succeededWithoutSuccess.Steps[0].Concurrent = []calltree.Step{
+		failed("b"), failed("c")}
+
+	tests := []struct {
+		name       string
+		trees      []calltree.Tree
+		mismatches []Mismatch
+	}{
+		{"loser cancelled", []calltree.Tree{*hedged}, nil},
+		{
+			"succeeded without a success",
+			[]calltree.Tree{*succeededWithoutSuccess},
+			[]Mismatch{
+				{"a", "step 0: succeeded with 0 of 2 steps; 1 are required", 1},
+				{"b", "0.00% of calls succeeded; expected 100.00%", 1},
+				{"c", "0.00% of calls succeeded; expected 100.00%", 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			report := Check(g, test.trees, DefaultTolerance)
+			if !reflect.DeepEqual(test.mismatches, report.Mismatches) {
+				t.Errorf(
+					"expected %v; actual %v", test.mismatches, report.Mismatches)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	g := testGraph(t)
+	server := httptest.NewServer(http.HandlerFunc(func(
+		writer http.ResponseWriter, request *http.Request) {
+		if !calltree.Requested(request.Header) {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(writer).Encode(emulate(g, "a"))
+	}))
+	defer server.Close()
+
+	report, err := Run(g, server.URL, Options{Requests: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Requests != 5 {
+		t.Errorf("expected 5 conforming requests; actual %v", report)
+	}
+	expected := []ServiceReport{
+		{"a", 5, 0, 1, 1},
+		{"b", 5, 0, 1, 1},
+		{"c", 5, 0, 1, 1},
+	}
+	if !reflect.DeepEqual(expected, report.Services) {
+		t.Errorf("expected %v; actual %v", expected, report.Services)
+	}
+}
+
+func TestRun_NoCallTree(t *testing.T) {
+	g := testGraph(t)
+	server := httptest.NewServer(http.HandlerFunc(func(
+		writer http.ResponseWriter, request *http.Request) {
+		request.Write(writer)
+	}))
+	defer server.Close()
+
+	report, err := Run(g, server.URL, Options{Requests: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Mismatch{
+		{server.URL, "the response held no call tree", 2},
+	}
+	if !reflect.DeepEqual(expected, report.Mismatches) {
+		t.Errorf("expected %v; actual %v", expected, report.Mismatches)
+	}
+}
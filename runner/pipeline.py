@@ -86,8 +86,9 @@ def _gen_yaml(topology_path: str, service_image: str,
             'go', 'run', _MAIN_GO_PATH, 'kubernetes', '--service-image',
             service_image, '--service-max-idle-connections-per-host',
             str(max_idle_connections_per_host), '--client-image', client_image,
-            topology_path, resources.SERVICE_GRAPH_GEN_YAML_PATH,
-            service_graph_node_selector, client_node_selector
+            '--service-node-selector', service_graph_node_selector,
+            '--client-node-selector', client_node_selector, topology_path,
+            resources.SERVICE_GRAPH_GEN_YAML_PATH
         ],
         check=True)
     return resources.SERVICE_GRAPH_GEN_YAML_PATH
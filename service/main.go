@@ -7,15 +7,18 @@ import (
 	"os"
 	"path"
 	"runtime"
+	"time"
 
-	"github.com/Tahler/isotope/convert/pkg/consts"
-	"github.com/Tahler/isotope/service/pkg/srv"
-	"github.com/Tahler/isotope/service/pkg/srv/prometheus"
+	"github.com/maxfouquet/isotope/convert/pkg/consts"
+	"github.com/maxfouquet/isotope/service/pkg/srv"
+	"github.com/maxfouquet/isotope/service/pkg/srv/admin"
+	"github.com/maxfouquet/isotope/service/pkg/srv/prometheus"
+	"github.com/maxfouquet/isotope/service/pkg/srv/tracing"
 	"istio.io/fortio/log"
 )
 
 const (
-	promEndpoint    = "/metrics"
+	promEndpoint    = consts.ServiceMetricsPath
 	defaultEndpoint = "/"
 )
 
@@ -26,6 +29,40 @@ var (
 	maxIdleConnectionsPerHostFlag = flag.Int(
 		"max-idle-connections-per-host", 0,
 		"maximum number of connections to keep open per host")
+	portFlag = flag.Int(
+		"port", consts.ServicePort,
+		"port to listen on and to send requests to other services on")
+	adminPortFlag = flag.Int(
+		"admin-port", consts.ServiceAdminPort,
+		"port of the admin API, which injects faults and reports readiness")
+	configReloadIntervalFlag = flag.Duration(
+		"config-reload-interval", 5*time.Second,
+		"how often to check the service graph file for changes (0 to disable)")
+	durationBucketsFlag = flag.String(
+		"duration-buckets", "",
+		"comma-separated upper bounds in seconds of the buckets of the duration "+
+			"histograms (default the prometheus package's DefaultDurationBuckets)")
+	tracingFlag = flag.String(
+		"tracing", tracingNone,
+		fmt.Sprintf(
+			"where to export OpenTelemetry spans: %q, %q (OTLP/HTTP) or %q",
+			tracingNone, tracingOTLP, tracingFile))
+	tracingEndpointFlag = flag.String(
+		"tracing-endpoint", "http://localhost:4318",
+		"base URL of the OpenTelemetry collector to export spans to with OTLP/HTTP")
+	tracingFileFlag = flag.String(
+		"tracing-file", "/tmp/spans.jsonl",
+		"file to append spans to, one OTLP JSON document per line")
+	tracingSamplingRateFlag = flag.Float64(
+		"tracing-sampling-rate", 1,
+		"chance from 0 to 1 that a trace which starts at this service is exported")
+)
+
+// The values of --tracing.
+const (
+	tracingNone = "none"
+	tracingOTLP = "otlp"
+	tracingFile = "file"
 )
 
 func main() {
@@ -41,27 +78,62 @@ func main() {
 		log.Fatalf(`env var "%s" is not set`, consts.ServiceNameEnvKey)
 	}
 
-	defaultHandler, err := srv.HandlerFromServiceGraphYAML(
-		serviceGraphYAMLFilePath, serviceName)
+	var durationBuckets []float64
+	if *durationBucketsFlag != "" {
+		var err error
+		durationBuckets, err = prometheus.ParseBuckets(*durationBucketsFlag)
+		if err != nil {
+			log.Fatalf("invalid --duration-buckets: %s", err)
+		}
+	}
+
+	defaultHandler, err := srv.NewReloadingHandler(
+		serviceGraphYAMLFilePath, serviceName, *portFlag)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+
+	// Labels are fixed when the metrics are registered, so changes to them take
+	// effect only on restart. The metrics must exist before a reload records
+	// one.
+	metricsHandler := prometheus.Handler(
+		serviceName, defaultHandler.Handler().Service.Labels, durationBuckets)
+	if *configReloadIntervalFlag > 0 {
+		go defaultHandler.Watch(*configReloadIntervalFlag, nil)
+	}
+
+	tracer, err := newTracer(serviceName)
 	if err != nil {
 		log.Fatalf("%s", err)
 	}
 
-	err = serveWithPrometheus(defaultHandler)
+	injector := admin.NewInjector()
+	go func() {
+		adminAddr := fmt.Sprintf(":%d", *adminPortFlag)
+		log.Infof("exposing admin API on port %v", *adminPortFlag)
+		log.Fatalf("%s", http.ListenAndServe(adminAddr, injector.Handler()))
+	}()
+
+	err = serveWithPrometheus(
+		tracing.Middleware(
+			tracer, srv.StampReceived(injector.Middleware(defaultHandler))),
+		metricsHandler, *portFlag)
 	if err != nil {
 		log.Fatalf("%s", err)
 	}
 }
 
-func serveWithPrometheus(defaultHandler http.Handler) (err error) {
+func serveWithPrometheus(
+	defaultHandler http.Handler, metricsHandler http.Handler, port int) (
+	err error) {
 	log.Infof(`exposing Prometheus endpoint "%s"`, promEndpoint)
-	http.Handle(promEndpoint, prometheus.Handler())
+	http.Handle(promEndpoint, metricsHandler)
 
 	log.Infof(`exposing default endpoint "%s"`, defaultEndpoint)
 	http.Handle(defaultEndpoint, defaultHandler)
 
-	addr := fmt.Sprintf(":%d", consts.ServicePort)
-	log.Infof("listening on port %v\n", consts.ServicePort)
+	addr := fmt.Sprintf(":%d", port)
+	log.Infof("listening on port %v\n", port)
 	err = http.ListenAndServe(addr, nil)
 	if err != nil {
 		return
@@ -69,6 +141,31 @@ func serveWithPrometheus(defaultHandler http.Handler) (err error) {
 	return
 }
 
+// newTracer returns the tracer chosen by --tracing, or nil if tracing is
+// disabled.
+func newTracer(serviceName string) (*tracing.Tracer, error) {
+	var exporter tracing.Exporter
+	switch *tracingFlag {
+	case tracingNone:
+		return nil, nil
+	case tracingOTLP:
+		exporter = tracing.NewOTLPHTTPExporter(*tracingEndpointFlag)
+	case tracingFile:
+		fileExporter, err := tracing.NewFileExporter(*tracingFileFlag)
+		if err != nil {
+			return nil, err
+		}
+		exporter = fileExporter
+	default:
+		return nil, fmt.Errorf(
+			"unknown --tracing %q (must be %q, %q or %q)",
+			*tracingFlag, tracingNone, tracingOTLP, tracingFile)
+	}
+	log.Infof("exporting spans with %s", *tracingFlag)
+	return tracing.NewTracer(
+		serviceName, exporter, *tracingSamplingRateFlag), nil
+}
+
 func setMaxProcs() {
 	numCPU := runtime.NumCPU()
 	maxProcs := runtime.GOMAXPROCS(0)
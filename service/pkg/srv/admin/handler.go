@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/maxfouquet/isotope/convert/pkg/fault"
+	"istio.io/fortio/log"
+)
+
+// Handler returns the admin API of the service whose faults are held by i:
+//
+//	GET    /faults        lists the injected faults
+//	POST   /faults        injects the fault in the JSON body
+//	DELETE /faults        clears every fault
+//	DELETE /faults/<type> clears the fault of one type
+//	GET    /ready         fails while an unready fault is injected
+func (i *Injector) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(fault.FaultsPath, i.serveFaults)
+	mux.HandleFunc(fault.FaultsPath+"/", i.serveFaults)
+	mux.HandleFunc(fault.ReadyPath, func(
+		writer http.ResponseWriter, request *http.Request) {
+		if !i.Ready() {
+			http.Error(writer, "unready fault injected", http.StatusServiceUnavailable)
+			return
+		}
+		writer.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+func (i *Injector) serveFaults(
+	writer http.ResponseWriter, request *http.Request) {
+	faultType := fault.Type(strings.TrimPrefix(
+		strings.TrimPrefix(request.URL.Path, fault.FaultsPath), "/"))
+	switch {
+	case request.Method == http.MethodGet && faultType == "":
+		writeJSON(writer, i.Faults())
+	case request.Method == http.MethodPost && faultType == "":
+		var f fault.Fault
+		if err := json.NewDecoder(request.Body).Decode(&f); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := i.Inject(f); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(writer, i.Faults())
+	case request.Method == http.MethodDelete:
+		i.Clear(faultType)
+		writeJSON(writer, i.Faults())
+	default:
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(writer http.ResponseWriter, v interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(writer).Encode(v); err != nil {
+		log.Errf("%s", err)
+	}
+}
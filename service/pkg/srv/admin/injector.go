@@ -0,0 +1,180 @@
+// Package admin serves a mock service's admin API, which injects faults into
+// the service at runtime and reports its readiness.
+package admin
+
+import (
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/fault"
+	"github.com/maxfouquet/isotope/service/pkg/srv/prometheus"
+	"istio.io/fortio/log"
+)
+
+// Injector holds the faults injected into a service and applies them to its
+// requests.
+type Injector struct {
+	mu     sync.Mutex
+	faults map[fault.Type]*activeFault
+}
+
+// FaultStatus is an injected fault, as reported by the admin API.
+type FaultStatus struct {
+	fault.Fault
+
+	// Expires is when the fault ends, or nil if it lasts until cleared.
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// activeFault is an injected fault and the means to end it.
+type activeFault struct {
+	FaultStatus
+
+	// done is closed when the fault ends, releasing hung requests.
+	done  chan struct{}
+	timer *time.Timer
+}
+
+// NewInjector returns an Injector with no faults.
+func NewInjector() *Injector {
+	return &Injector{faults: map[fault.Type]*activeFault{}}
+}
+
+// Inject validates f and injects it, replacing any fault of the same type.
+func (i *Injector) Inject(f fault.Fault) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	active := &activeFault{
+		FaultStatus: FaultStatus{Fault: f},
+		done:        make(chan struct{}),
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.removeLocked(f.Type)
+	if f.Duration > 0 {
+		d := time.Duration(f.Duration)
+		expires := time.Now().Add(d)
+		active.Expires = &expires
+		active.timer = time.AfterFunc(d, func() {
+			i.mu.Lock()
+			defer i.mu.Unlock()
+			// The fault may have been replaced since the timer was set.
+			if i.faults[f.Type] == active {
+				i.removeLocked(f.Type)
+				log.Infof("%s fault expired", f.Type)
+			}
+		})
+	}
+	i.faults[f.Type] = active
+	prometheus.SetFaultActive(string(f.Type), true)
+	log.Infof("injected %s fault: %+v", f.Type, f)
+	return nil
+}
+
+// Clear removes the fault of type t, or every fault if t is empty.
+func (i *Injector) Clear(t fault.Type) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if t != "" {
+		i.removeLocked(t)
+		return
+	}
+	for t := range i.faults {
+		i.removeLocked(t)
+	}
+}
+
+func (i *Injector) removeLocked(t fault.Type) {
+	active, ok := i.faults[t]
+	if !ok {
+		return
+	}
+	if active.timer != nil {
+		active.timer.Stop()
+	}
+	close(active.done)
+	delete(i.faults, t)
+	prometheus.SetFaultActive(string(t), false)
+}
+
+// Faults returns the injected faults, ordered by type.
+func (i *Injector) Faults() []FaultStatus {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	faults := make([]FaultStatus, 0, len(i.faults))
+	for _, active := range i.faults {
+		faults = append(faults, active.FaultStatus)
+	}
+	sort.Slice(faults, func(a, b int) bool {
+		return faults[a].Type < faults[b].Type
+	})
+	return faults
+}
+
+// Ready returns false while an Unready fault is injected.
+func (i *Injector) Ready() bool {
+	return i.get(fault.Unready) == nil
+}
+
+func (i *Injector) get(t fault.Type) *activeFault {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.faults[t]
+}
+
+// Middleware returns a handler which applies the injected faults to each
+// request before passing it to next. Connections are dropped or held open
+// first, then requests are delayed, and finally they may be failed.
+func (i *Injector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(
+		writer http.ResponseWriter, request *http.Request) {
+		if i.get(fault.Drop) != nil {
+			prometheus.RecordFaultInjected(string(fault.Drop))
+			if hijacker, ok := writer.(http.Hijacker); ok {
+				if conn, _, err := hijacker.Hijack(); err == nil {
+					conn.Close()
+					return
+				}
+			}
+			panic(http.ErrAbortHandler)
+		}
+
+		if hang := i.get(fault.Hang); hang != nil {
+			prometheus.RecordFaultInjected(string(fault.Hang))
+			select {
+			case <-hang.done:
+			case <-request.Context().Done():
+				return
+			}
+		}
+
+		if latency := i.get(fault.Latency); latency != nil {
+			prometheus.RecordFaultInjected(string(fault.Latency))
+			select {
+			case <-time.After(time.Duration(latency.Latency)):
+			case <-request.Context().Done():
+				return
+			}
+		}
+
+		if status := i.get(fault.Status); status != nil {
+			prometheus.RecordFaultInjected(string(fault.Status))
+			writer.WriteHeader(status.Status)
+			return
+		}
+
+		if errorRate := i.get(fault.ErrorRate); errorRate != nil &&
+			rand.Float64() < float64(errorRate.ErrorRate) {
+			prometheus.RecordFaultInjected(string(fault.ErrorRate))
+			writer.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		next.ServeHTTP(writer, request)
+	})
+}
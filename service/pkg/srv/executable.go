@@ -1,100 +1,347 @@
 package srv
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
-	"sync"
+	"net/url"
 	"time"
 
-	"github.com/Tahler/isotope/convert/pkg/graph/script"
-	"github.com/Tahler/isotope/convert/pkg/graph/svctype"
-	"github.com/Tahler/isotope/service/pkg/srv/prometheus"
+	"github.com/maxfouquet/isotope/convert/pkg/calltree"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
+	"github.com/maxfouquet/isotope/service/pkg/srv/prometheus"
+	"github.com/maxfouquet/isotope/service/pkg/srv/tracing"
 	multierror "github.com/hashicorp/go-multierror"
 	"istio.io/fortio/log"
 )
 
+// execute runs step until it finishes or ctx is done, returning what it
+// executed and the time the mesh added to it along its critical path (see
+// meshOverheadHeaderKey).
 func execute(
+	ctx context.Context,
 	step interface{},
 	forwardableHeader http.Header,
-	serviceTypes map[string]svctype.ServiceType) (err error) {
+	serviceTypes map[string]svctype.ServiceType,
+	port int,
+	parentSpan *tracing.Span) (
+	trace calltree.Step, meshOverhead time.Duration, err error) {
+	startTime := time.Now()
 	switch cmd := step.(type) {
 	case script.SleepCommand:
-		executeSleepCommand(cmd)
+		err = executeSleepCommand(ctx, cmd, parentSpan)
+		sleep := policy.Duration(cmd)
+		trace.Sleep = &sleep
 	case script.RequestCommand:
-		err = executeRequestCommand(
-			cmd, forwardableHeader, serviceTypes)
+		trace.Call, meshOverhead, err = executeRequestCommand(
+			ctx, cmd, forwardableHeader, serviceTypes, port, parentSpan)
 	case script.ConcurrentCommand:
-		err = executeConcurrentCommand(
-			cmd, forwardableHeader, serviceTypes)
+		trace.Concurrent, meshOverhead, err = executeConcurrentCommand(
+			ctx, cmd, forwardableHeader, serviceTypes, port, parentSpan)
 	default:
 		log.Fatalf("unknown command type in script: %T", cmd)
 	}
+	trace.Duration = policy.Duration(time.Since(startTime))
+	if err != nil {
+		trace.Error = err.Error()
+	}
 	return
 }
 
-func executeSleepCommand(cmd script.SleepCommand) {
-	time.Sleep(time.Duration(cmd))
+func executeSleepCommand(
+	ctx context.Context, cmd script.SleepCommand, parentSpan *tracing.Span) (
+	err error) {
+	span := parentSpan.StartChild("sleep", tracing.KindInternal)
+	span.SetAttribute("isotope.sleep.duration", time.Duration(cmd).String())
+	defer func() {
+		span.SetError(err)
+		span.Finish()
+	}()
+
+	timer := time.NewTimer(time.Duration(cmd))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // Execute sends an HTTP request to another service. Assumes DNS is available
-// which maps exe.ServiceName to the relevant URL to reach the service.
+// which maps exe.ServiceName to the relevant URL to reach the service. The time
+// the mesh added to the call is the time the caller waited for the response
+// less the time the callee took to respond, plus the time the mesh added to
+// the callee's own calls. If the call tree was requested, the callee's is
+// returned in call.
 func executeRequestCommand(
+	ctx context.Context,
 	cmd script.RequestCommand,
 	forwardableHeader http.Header,
-	serviceTypes map[string]svctype.ServiceType) (err error) {
+	serviceTypes map[string]svctype.ServiceType,
+	port int,
+	parentSpan *tracing.Span) (
+	call *calltree.Call, meshOverhead time.Duration, err error) {
 	destName := cmd.ServiceName
+	call = &calltree.Call{Service: destName}
+	span := parentSpan.StartChild("call "+destName, tracing.KindClient)
+	span.SetAttribute("peer.service", destName)
+	span.SetAttribute("isotope.request.size", int64(cmd.Size))
+	defer func() {
+		span.SetError(err)
+		span.Finish()
+	}()
+
 	destType, ok := serviceTypes[destName]
 	if !ok {
 		err = fmt.Errorf("service %s does not exist", destName)
 		return
 	}
-	response, err := sendRequest(destName, destType, cmd.Size, forwardableHeader)
+	startTime := time.Now()
+	response, err := sendRequest(
+		ctx, destName, destType, port, cmd.Size, forwardableHeader, span)
 	if err != nil {
+		prometheus.RecordRequestFailed(destName, requestErrorKind(err))
 		return
 	}
 	prometheus.RecordRequestSent(destName, uint64(cmd.Size))
+	span.SetAttribute("http.status_code", response.StatusCode)
+	call.Status = response.StatusCode
 	if response.StatusCode == 200 {
 		log.Debugf("%s responded with %s", destName, response.Status)
 	} else {
 		log.Errf("%s responded with %s", destName, response.Status)
 	}
-	if response.StatusCode == http.StatusInternalServerError {
+	// Any other status, such as a rejection by a limit or an injected fault,
+	// fails the step, as verify counts it.
+	if response.StatusCode != http.StatusOK {
 		err = fmt.Errorf("service %s responded with %s", destName, response.Status)
 	}
 
 	// Necessary for reusing HTTP/1.x "keep-alive" TCP connections.
 	// https://golang.org/pkg/net/http/#Response
-	readAllAndClose(response.Body)
+	var readErr error
+	if calltree.Requested(forwardableHeader) {
+		call.Tree, readErr = readCallTreeAndClose(response)
+	} else {
+		readErr = readAllAndClose(response.Body)
+	}
+	if readErr != nil {
+		prometheus.RecordRequestFailed(destName, requestErrorKindBody)
+		if err == nil {
+			err = fmt.Errorf(
+				"reading the response of service %s: %s", destName, readErr)
+		}
+		return
+	}
+	duration := time.Since(startTime)
+	prometheus.RecordResponseReceived(destName, duration, response.StatusCode)
+
+	// Services which respond before running their script, such as those with
+	// an injected fault, and proxies which respond for them do not report
+	// their duration, so the overhead is unknown.
+	serverDuration, ok := getDuration(response.Header, serverDurationHeaderKey)
+	if !ok {
+		return
+	}
+	hopOverhead := duration - serverDuration
+	if hopOverhead < 0 {
+		hopOverhead = 0
+	}
+	downstreamOverhead, _ := getDuration(response.Header, meshOverheadHeaderKey)
+	meshOverhead = hopOverhead + downstreamOverhead
+	path := appendPath(forwardableHeader.Get(pathHeaderKey), destName)
+	prometheus.RecordMeshOverhead(destName, path, hopOverhead, meshOverhead)
 
 	return
 }
 
-func readAllAndClose(r io.ReadCloser) {
-	io.Copy(ioutil.Discard, r)
+func readAllAndClose(r io.ReadCloser) error {
+	_, err := io.Copy(ioutil.Discard, r)
 	r.Close()
+	return err
 }
 
-// executeConcurrentCommand calls each command in exe.Commands asynchronously
-// and waits for each to complete.
+// readCallTreeAndClose reads the call tree in the body of response, or returns
+// nil if the body does not hold one.
+func readCallTreeAndClose(response *http.Response) (*calltree.Tree, error) {
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if response.Header.Get("Content-Type") != calltreeContentType {
+		return nil, nil
+	}
+	var tree calltree.Tree
+	if err := json.Unmarshal(body, &tree); err != nil {
+		log.Warnf("the call tree of %s is malformed: %s", response.Request.URL, err)
+		return nil, nil
+	}
+	return &tree, nil
+}
+
+// The kinds of error with which a request may get no response.
+const (
+	// requestErrorKindTimeout is a request which timed out.
+	requestErrorKindTimeout = "timeout"
+	// requestErrorKindConnection is a request which could not connect, or whose
+	// connection was closed before the response was received.
+	requestErrorKindConnection = "connection"
+	// requestErrorKindBody is a request whose response body could not be read.
+	requestErrorKindBody = "body"
+	// requestErrorKindCanceled is a request which was cancelled, such as by the
+	// policy of its concurrent group.
+	requestErrorKindCanceled = "canceled"
+	// requestErrorKindOther is a request which failed for any other reason.
+	requestErrorKindOther = "other"
+)
+
+// requestErrorKind returns the kind of err, an error returned by sending a
+// request.
+func requestErrorKind(err error) string {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return requestErrorKindTimeout
+	}
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if err == context.Canceled {
+		return requestErrorKindCanceled
+	}
+	switch err.(type) {
+	case *net.OpError, *net.DNSError:
+		return requestErrorKindConnection
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return requestErrorKindConnection
+	}
+	return requestErrorKindOther
+}
+
+// executeConcurrentCommand calls each command in cmd concurrently, or one
+// after another if it hedges, and returns once its policy decides whether it
+// succeeded and the commands it started have finished. Commands still running
+// then are cancelled if the policy says so; they, and those never started,
+// are marked Canceled in traces and their errors are ignored.
 func executeConcurrentCommand(
+	ctx context.Context,
 	cmd script.ConcurrentCommand,
 	forwardableHeader http.Header,
-	serviceTypes map[string]svctype.ServiceType) (errs error) {
-	numSubCmds := len(cmd)
-	wg := sync.WaitGroup{}
-	wg.Add(numSubCmds)
-	for _, subCmd := range cmd {
-		go func(step interface{}) {
-			defer wg.Done()
-
-			err := execute(step, forwardableHeader, serviceTypes)
-			if err != nil {
-				errs = multierror.Append(errs, err)
+	serviceTypes map[string]svctype.ServiceType,
+	port int,
+	parentSpan *tracing.Span) (
+	traces []calltree.Step, meshOverhead time.Duration, err error) {
+	span := parentSpan.StartChild("concurrent", tracing.KindInternal)
+	span.SetAttribute("isotope.concurrent.commands", len(cmd.Commands))
+	if cmd.Policy != "" {
+		span.SetAttribute("isotope.concurrent.policy", string(cmd.Policy))
+	}
+	defer func() {
+		span.SetError(err)
+		span.Finish()
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	numSubCmds := len(cmd.Commands)
+	// Each command writes only its own trace, overhead and error, and sends
+	// its index once it has, so they need no lock.
+	traces = make([]calltree.Step, numSubCmds)
+	meshOverheads := make([]time.Duration, numSubCmds)
+	errs := make([]error, numSubCmds)
+	finished := make(chan int, numSubCmds)
+	started := 0
+	startNext := func() {
+		go func(i int) {
+			traces[i], meshOverheads[i], errs[i] = execute(
+				ctx, cmd.Commands[i], forwardableHeader, serviceTypes, port, span)
+			finished <- i
+		}(started)
+		started++
+	}
+
+	hedged := cmd.Policy == script.FirstSuccess && cmd.HedgeDelay > 0 &&
+		numSubCmds > 0
+	// hedge fires when the next command is due to start, if it hedges.
+	var hedge <-chan time.Time
+	if hedged {
+		startNext()
+		hedge = time.After(cmd.HedgeDelay)
+	} else {
+		for started < numSubCmds {
+			startNext()
+		}
+	}
+
+	required := cmd.Required()
+	succeeded, failed, done := 0, 0, 0
+	decided := false
+	canceled := make([]bool, numSubCmds)
+	for done < started {
+		select {
+		case i := <-finished:
+			done++
+			if decided {
+				canceled[i] = errs[i] != nil
+				continue
+			}
+			if errs[i] == nil {
+				succeeded++
+			} else {
+				failed++
+			}
+			if succeeded >= required || failed > numSubCmds-required {
+				decided = cmd.CancelsLosers()
+			}
+			if decided {
+				cancel()
+			} else if hedged && errs[i] != nil && started < numSubCmds {
+				// A failure needs no hedge delay to start the next command.
+				startNext()
+				hedge = time.After(cmd.HedgeDelay)
 			}
-		}(subCmd)
+		case <-hedge:
+			hedge = nil
+			if !decided && started < numSubCmds {
+				startNext()
+				hedge = time.After(cmd.HedgeDelay)
+			}
+		}
+	}
+	for i := started; i < numSubCmds; i++ {
+		canceled[i] = true
+	}
+
+	var failures error
+	for i := range cmd.Commands {
+		if canceled[i] {
+			traces[i].Canceled = true
+			continue
+		}
+		if errs[i] != nil {
+			failures = multierror.Append(failures, errs[i])
+		}
+		// The commands run concurrently, so the mesh delays the group by about
+		// the largest of their overheads rather than their sum.
+		if meshOverheads[i] > meshOverhead {
+			meshOverhead = meshOverheads[i]
+		}
+	}
+	if succeeded < required {
+		err = failures
+		if err == nil {
+			err = fmt.Errorf(
+				"%d of %d concurrent commands succeeded; %d are required",
+				succeeded, numSubCmds, required)
+		}
 	}
-	wg.Wait()
 	return
 }
@@ -0,0 +1,238 @@
+package srv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/script"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
+	"github.com/maxfouquet/isotope/service/pkg/srv/prometheus"
+)
+
+// The services emulated by fakeServices, which respond by their names.
+const (
+	fakeServiceOK          = "ok"
+	fakeServiceSlow        = "slow"
+	fakeServiceUnavailable = "unavailable"
+)
+
+// fakeServiceTypes are the types of the services emulated by fakeServices.
+var fakeServiceTypes = map[string]svctype.ServiceType{
+	fakeServiceOK:          svctype.ServiceHTTP,
+	fakeServiceSlow:        svctype.ServiceHTTP,
+	fakeServiceUnavailable: svctype.ServiceHTTP,
+}
+
+// slowServiceDelay is how long the slow service takes to respond, unless its
+// request is cancelled.
+const slowServiceDelay = time.Minute
+
+// fakeServices responds to requests as the service they were sent to.
+func fakeServices(writer http.ResponseWriter, request *http.Request) {
+	switch request.URL.Hostname() {
+	case fakeServiceOK:
+	case fakeServiceSlow:
+		select {
+		case <-time.After(slowServiceDelay):
+		case <-request.Context().Done():
+			return
+		}
+	case fakeServiceUnavailable:
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	default:
+		writer.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestMain(m *testing.M) {
+	prometheus.Handler("test", nil, nil)
+
+	// Every request is sent through fakeServices as a proxy, so the services
+	// can be called by name.
+	server := httptest.NewServer(http.HandlerFunc(fakeServices))
+	proxyURL, err := url.Parse(server.URL)
+	if err != nil {
+		panic(err)
+	}
+	http.DefaultTransport.(*http.Transport).Proxy = http.ProxyURL(proxyURL)
+
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+func TestExecuteConcurrentCommand(t *testing.T) {
+	call := func(name string) script.Command {
+		return script.RequestCommand{ServiceName: name}
+	}
+
+	tests := []struct {
+		name string
+		cmd  script.ConcurrentCommand
+		// statuses are the statuses each command's call should get, or 0 if it
+		// should be cancelled or never started.
+		statuses []int
+		ok       bool
+	}{
+		{
+			"all succeeding",
+			script.ConcurrentCommand{
+				Commands: []script.Command{call(fakeServiceOK), call(fakeServiceOK)},
+			},
+			[]int{http.StatusOK, http.StatusOK},
+			true,
+		},
+		{
+			"all with a 503",
+			script.ConcurrentCommand{
+				Commands: []script.Command{
+					call(fakeServiceOK), call(fakeServiceUnavailable)},
+				Policy: script.All,
+			},
+			[]int{http.StatusOK, http.StatusServiceUnavailable},
+			false,
+		},
+		{
+			"any with a success",
+			script.ConcurrentCommand{
+				Commands: []script.Command{
+					call(fakeServiceUnavailable), call(fakeServiceOK)},
+				Policy: script.Any,
+			},
+			[]int{http.StatusServiceUnavailable, http.StatusOK},
+			true,
+		},
+		{
+			"any without a success",
+			script.ConcurrentCommand{
+				Commands: []script.Command{
+					call(fakeServiceUnavailable), call(fakeServiceUnavailable)},
+				Policy: script.Any,
+			},
+			[]int{http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			false,
+		},
+		{
+			"quorum reached",
+			script.ConcurrentCommand{
+				Commands: []script.Command{
+					call(fakeServiceOK), call(fakeServiceSlow), call(fakeServiceOK)},
+				Policy: script.Quorum,
+				Quorum: 2,
+			},
+			[]int{http.StatusOK, 0, http.StatusOK},
+			true,
+		},
+		{
+			"quorum out of reach",
+			script.ConcurrentCommand{
+				Commands: []script.Command{
+					call(fakeServiceUnavailable),
+					call(fakeServiceSlow),
+					call(fakeServiceUnavailable),
+				},
+				Policy: script.Quorum,
+				Quorum: 2,
+			},
+			[]int{http.StatusServiceUnavailable, 0, http.StatusServiceUnavailable},
+			false,
+		},
+		{
+			"firstSuccess without hedging",
+			script.ConcurrentCommand{
+				Commands: []script.Command{call(fakeServiceSlow), call(fakeServiceOK)},
+				Policy:   script.FirstSuccess,
+			},
+			[]int{0, http.StatusOK},
+			true,
+		},
+		{
+			"firstSuccess hedges past a 503",
+			script.ConcurrentCommand{
+				Commands: []script.Command{
+					call(fakeServiceUnavailable), call(fakeServiceOK)},
+				Policy:     script.FirstSuccess,
+				HedgeDelay: time.Minute,
+			},
+			[]int{http.StatusServiceUnavailable, http.StatusOK},
+			true,
+		},
+		{
+			"firstSuccess hedges past a slow call",
+			script.ConcurrentCommand{
+				Commands:   []script.Command{call(fakeServiceSlow), call(fakeServiceOK)},
+				Policy:     script.FirstSuccess,
+				HedgeDelay: 10 * time.Millisecond,
+			},
+			[]int{0, http.StatusOK},
+			true,
+		},
+		{
+			"firstSuccess starts nothing after a success",
+			script.ConcurrentCommand{
+				Commands:   []script.Command{call(fakeServiceOK), call(fakeServiceSlow)},
+				Policy:     script.FirstSuccess,
+				HedgeDelay: time.Minute,
+			},
+			[]int{http.StatusOK, 0},
+			true,
+		},
+		{
+			"firstSuccess without a success",
+			script.ConcurrentCommand{
+				Commands: []script.Command{
+					call(fakeServiceUnavailable), call(fakeServiceUnavailable)},
+				Policy:     script.FirstSuccess,
+				HedgeDelay: time.Minute,
+			},
+			[]int{http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			false,
+		},
+		{
+			"bestEffort without a success",
+			script.ConcurrentCommand{
+				Commands: []script.Command{
+					call(fakeServiceUnavailable), call(fakeServiceUnavailable)},
+				Policy: script.BestEffort,
+			},
+			[]int{http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			startTime := time.Now()
+			traces, _, err := executeConcurrentCommand(
+				context.Background(), test.cmd, http.Header{}, fakeServiceTypes,
+				80, nil)
+			if time.Since(startTime) >= slowServiceDelay {
+				t.Errorf("expected the slow call to be cancelled")
+			}
+			if ok := err == nil; ok != test.ok {
+				t.Errorf("expected success %v; actual error %v", test.ok, err)
+			}
+			if len(traces) != len(test.statuses) {
+				t.Fatalf("expected %d traces; actual %d", len(test.statuses), len(traces))
+			}
+			for i, trace := range traces {
+				if canceled := test.statuses[i] == 0; trace.Canceled != canceled {
+					t.Errorf("expected step %d to be canceled %v", i, canceled)
+					continue
+				}
+				if !trace.Canceled && trace.Call.Status != test.statuses[i] {
+					t.Errorf("expected step %d to get status %d; actual %d",
+						i, test.statuses[i], trace.Call.Status)
+				}
+			}
+		})
+	}
+}
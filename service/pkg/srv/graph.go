@@ -4,19 +4,37 @@ import (
 	"fmt"
 	"io/ioutil"
 
-	"github.com/Tahler/isotope/convert/pkg/graph"
-	"github.com/Tahler/isotope/convert/pkg/graph/svc"
-	"github.com/Tahler/isotope/convert/pkg/graph/svctype"
+	"github.com/maxfouquet/isotope/convert/pkg/graph"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
 	"github.com/ghodss/yaml"
 	"istio.io/fortio/log"
 )
 
 // HandlerFromServiceGraphYAML makes a handler to emulate the service with name
-// serviceName in the service graph represented by the YAML file at path.
+// serviceName in the service graph represented by the YAML file at path. The
+// file may hold the whole graph or only the service's slice of it (see
+// graph.Slice), depending on the config map layout it was generated with. The
+// other services are called on port.
 func HandlerFromServiceGraphYAML(
-	path string, serviceName string) (handler Handler, err error) {
+	path string, serviceName string, port int) (handler Handler, err error) {
+	graphYAML, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	return handlerFromServiceGraphYAMLBytes(
+		graphYAML, serviceName, port, Handler{})
+}
 
-	serviceGraph, err := serviceGraphFromYAMLFile(path)
+// handlerFromServiceGraphYAMLBytes makes a handler to emulate the service with
+// name serviceName in the service graph represented by graphYAML. The handler
+// takes over the limiters of previous, the handler it replaces, if any.
+func handlerFromServiceGraphYAMLBytes(
+	graphYAML []byte, serviceName string, port int, previous Handler) (
+	handler Handler, err error) {
+	log.Debugf("unmarshalling\n%s", graphYAML)
+	var serviceGraph graph.ServiceGraph
+	err = yaml.Unmarshal(graphYAML, &serviceGraph)
 	if err != nil {
 		return
 	}
@@ -32,6 +50,10 @@ func HandlerFromServiceGraphYAML(
 	handler = Handler{
 		Service:      service,
 		ServiceTypes: serviceTypes,
+		ServicePort:  port,
+		limiter:      previous.limiter.reload(service),
+		rateLimiter:  previous.rateLimiter.reload(service, serviceTypes),
+		shedder:      previous.shedder.reload(service),
 	}
 	return
 }
@@ -47,21 +69,6 @@ func logService(service svc.Service) error {
 	return nil
 }
 
-// serviceGraphFromYAMLFile unmarshals the ServiceGraph from the YAML at path.
-func serviceGraphFromYAMLFile(
-	path string) (serviceGraph graph.ServiceGraph, err error) {
-	graphYAML, err := ioutil.ReadFile(path)
-	if err != nil {
-		return
-	}
-	log.Debugf("unmarshalling\n%s", graphYAML)
-	err = yaml.Unmarshal(graphYAML, &serviceGraph)
-	if err != nil {
-		return
-	}
-	return
-}
-
 // extractService finds the service in serviceGraph with the specified name.
 func extractService(
 	serviceGraph graph.ServiceGraph, name string) (
@@ -1,19 +1,25 @@
 package srv
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
-	"github.com/Tahler/isotope/convert/pkg/graph/svc"
-	"github.com/Tahler/isotope/convert/pkg/graph/svctype"
-	"github.com/Tahler/isotope/service/pkg/srv/prometheus"
+	"github.com/maxfouquet/isotope/convert/pkg/calltree"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
+	"github.com/maxfouquet/isotope/service/pkg/srv/prometheus"
+	"github.com/maxfouquet/isotope/service/pkg/srv/tracing"
 	"istio.io/fortio/log"
 )
 
-// pathTracesHeaderKey is the HTTP header key for path tracing. It must be in
-// Train-Case.
-const pathTracesHeaderKey = "Path-Traces"
+// calltreeContentType is the content type of a response which holds a call
+// tree.
+const calltreeContentType = "application/json"
 
 var hostname = os.Getenv("HOSTNAME")
 
@@ -21,30 +27,103 @@ var hostname = os.Getenv("HOSTNAME")
 type Handler struct {
 	Service      svc.Service
 	ServiceTypes map[string]svctype.ServiceType
+	// ServicePort is the port the other services listen on.
+	ServicePort int
+
+	// limiter enforces the Service's concurrency limits. It is passed on to the
+	// Handler which replaces this one when the service graph is reloaded, so
+	// requests already in flight still count against the new limits.
+	limiter *concurrencyLimiter
+	// rateLimiter and shedder enforce the Service's rate limit and load
+	// shedding, and are passed on in the same way, keeping their tokens and
+	// the latency measured so far.
+	rateLimiter *rateLimiter
+	shedder     *loadShedder
 }
 
 func (h Handler) ServeHTTP(
 	writer http.ResponseWriter, request *http.Request) {
-	startTime := time.Now()
+	startTime := receivedTime(request)
 
 	prometheus.RecordRequestReceived()
+	if sentAt, ok := getTime(request.Header, sentAtHeaderKey); ok {
+		prometheus.RecordRequestTransit(startTime.Sub(sentAt))
+	}
+	path := appendPath(request.Header.Get(pathHeaderKey), h.Service.Name)
 
+	span := tracing.SpanFromContext(request.Context())
+	span.SetAttribute("isotope.service", h.Service.Name)
+
+	var meshOverhead time.Duration
+	var steps []calltree.Step
 	respond := func(status int) {
-		writer.WriteHeader(status)
-		err := request.Write(writer)
+		duration := time.Since(startTime)
+		setDuration(writer.Header(), serverDurationHeaderKey, duration)
+		setDuration(writer.Header(), meshOverheadHeaderKey, meshOverhead)
+		var err error
+		if calltree.Requested(request.Header) {
+			writer.Header().Set("Content-Type", calltreeContentType)
+			writer.WriteHeader(status)
+			err = json.NewEncoder(writer).Encode(calltree.Tree{
+				Service:  h.Service.Name,
+				Hostname: hostname,
+				Status:   status,
+				Duration: policy.Duration(duration),
+				Steps:    steps,
+			})
+		} else {
+			writer.WriteHeader(status)
+			err = request.Write(writer)
+		}
 		if err != nil {
 			log.Errf("%s", err)
 		}
 
-		stopTime := time.Now()
-		duration := stopTime.Sub(startTime)
 		// TODO: Record size of response payload.
-		prometheus.RecordResponseSent(duration, 0, status)
+		prometheus.RecordResponseSent(time.Since(startTime), 0, status)
+	}
+
+	// Requests are rejected before they queue, as the cheapest to refuse are
+	// those refused first.
+	if ok, retryAfter := h.rateLimiter.allow(callerOf(request.Header)); !ok {
+		log.Debugf("rejecting request: rate limit exceeded")
+		prometheus.RecordRequestRejected(rejectedReasonRateLimited)
+		writer.Header().Set(
+			"Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+		respond(http.StatusTooManyRequests)
+		return
+	}
+	if h.shedder.shed(request.Header) {
+		log.Debugf("shedding request: latency is above the target")
+		prometheus.RecordRequestRejected(rejectedReasonLoadShed)
+		respond(http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := h.limiter.acquire(request.Context()); err != nil {
+		if err == errQueueFull {
+			log.Debugf("rejecting request: %s", err)
+			prometheus.RecordRequestRejected(rejectedReasonQueueFull)
+			respond(http.StatusServiceUnavailable)
+		}
+		return
 	}
+	defer h.limiter.release()
+	prometheus.RecordRequestStarted()
+	defer prometheus.RecordRequestFinished()
+	// The time queued counts towards the latency, so that a growing queue
+	// sheds load.
+	defer func() {
+		h.shedder.observe(time.Since(startTime))
+	}()
 
 	for _, step := range h.Service.Script {
 		forwardableHeader := extractForwardableHeader(request.Header)
-		err := execute(step, forwardableHeader, h.ServiceTypes)
+		forwardableHeader.Set(pathHeaderKey, path)
+		trace, overhead, err := execute(
+			request.Context(), step, forwardableHeader, h.ServiceTypes, h.ServicePort, span)
+		steps = append(steps, trace)
+		meshOverhead += overhead
 		if err != nil {
 			log.Errf("%s", err)
 			respond(http.StatusInternalServerError)
@@ -54,3 +133,26 @@ func (h Handler) ServeHTTP(
 
 	respond(http.StatusOK)
 }
+
+type receivedTimeKey struct{}
+
+// StampReceived returns a handler which notes the time each request was
+// received before passing it to next, so that the time the service reports
+// spending on a request includes any faults injected ahead of its Handler.
+func StampReceived(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(
+		writer http.ResponseWriter, request *http.Request) {
+		ctx := context.WithValue(
+			request.Context(), receivedTimeKey{}, time.Now())
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+// receivedTime returns the time request was received, as noted by
+// StampReceived, or now if it was not.
+func receivedTime(request *http.Request) time.Time {
+	if t, ok := request.Context().Value(receivedTimeKey{}).(time.Time); ok {
+		return t
+	}
+	return time.Now()
+}
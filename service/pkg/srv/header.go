@@ -2,8 +2,33 @@ package srv
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/calltree"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	"github.com/maxfouquet/isotope/service/pkg/srv/tracing"
+)
+
+// Headers with which services attribute the latency of each call to the mesh.
+// Times are in integer nanoseconds. They must be in Train-Case.
+const (
+	// sentAtHeaderKey is the Unix time at which the caller sent the request.
+	sentAtHeaderKey = "Isotope-Sent-At"
+	// serverDurationHeaderKey is the time the callee took from receiving the
+	// request to responding.
+	serverDurationHeaderKey = "Isotope-Server-Duration"
+	// meshOverheadHeaderKey is the time the mesh added to the callee's response
+	// by delaying the calls it made, along its critical path.
+	meshOverheadHeaderKey = "Isotope-Mesh-Overhead"
+	// pathHeaderKey is the path of services from the entrypoint to the caller,
+	// joined by pathSeparator.
+	pathHeaderKey = "Isotope-Path"
 )
 
+const pathSeparator = ">"
+
 var (
 	forwardableHeaders = []string{
 		"X-Request-Id",
@@ -13,6 +38,10 @@ var (
 		"X-B3-Sampled",
 		"X-B3-Flags",
 		"X-Ot-Span-Context",
+		tracing.TraceparentHeaderKey,
+		tracing.TracestateHeaderKey,
+		calltree.HeaderKey,
+		svc.PriorityHeaderKey,
 	}
 	forwardableHeadersSet = make(map[string]bool, len(forwardableHeaders))
 )
@@ -33,3 +62,54 @@ func extractForwardableHeader(
 	}
 	return forwardableHeader
 }
+
+// appendPath returns the path to serviceName through path, which may be empty.
+func appendPath(path string, serviceName string) string {
+	if path == "" {
+		return serviceName
+	}
+	return strings.Join([]string{path, serviceName}, pathSeparator)
+}
+
+// setDuration sets the header key to d in nanoseconds.
+func setDuration(header http.Header, key string, d time.Duration) {
+	setNanoseconds(header, key, int64(d))
+}
+
+// getDuration returns the duration in nanoseconds in the header key, and false
+// if it is missing or malformed.
+func getDuration(header http.Header, key string) (time.Duration, bool) {
+	nanoseconds, ok := getNanoseconds(header, key)
+	return time.Duration(nanoseconds), ok
+}
+
+// setTime sets the header key to t as a Unix time in nanoseconds.
+func setTime(header http.Header, key string, t time.Time) {
+	setNanoseconds(header, key, t.UnixNano())
+}
+
+// getTime returns the Unix time in nanoseconds in the header key, and false if
+// it is missing or malformed.
+func getTime(header http.Header, key string) (time.Time, bool) {
+	nanoseconds, ok := getNanoseconds(header, key)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanoseconds), true
+}
+
+func setNanoseconds(header http.Header, key string, nanoseconds int64) {
+	header.Set(key, strconv.FormatInt(nanoseconds, 10))
+}
+
+func getNanoseconds(header http.Header, key string) (int64, bool) {
+	value := header.Get(key)
+	if value == "" {
+		return 0, false
+	}
+	nanoseconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return nanoseconds, true
+}
@@ -0,0 +1,73 @@
+package srv
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGetTime(t *testing.T) {
+	sentAt := time.Unix(1500000000, 123456789)
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Time
+		ok       bool
+	}{
+		{"a time", "1500000000123456789", sentAt, true},
+		{"no time", "", time.Time{}, false},
+		{"a malformed time", "yesterday", time.Time{}, false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			header := http.Header{}
+			header.Set(sentAtHeaderKey, test.value)
+			actual, ok := getTime(header, sentAtHeaderKey)
+			if ok != test.ok || !actual.Equal(test.expected) {
+				t.Errorf("expected %v, %v; actual %v, %v",
+					test.expected, test.ok, actual, ok)
+			}
+		})
+	}
+}
+
+func TestSetTime(t *testing.T) {
+	sentAt := time.Unix(1500000000, 123456789)
+	header := http.Header{}
+	setTime(header, sentAtHeaderKey, sentAt)
+	if actual, ok := getTime(header, sentAtHeaderKey); !ok || !actual.Equal(sentAt) {
+		t.Errorf("expected %v; actual %v", sentAt, actual)
+	}
+}
+
+func TestGetDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"a duration", "1500000", 1500 * time.Microsecond, true},
+		{"no duration", "", 0, false},
+		{"a malformed duration", "1.5ms", 0, false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			header := http.Header{}
+			header.Set(serverDurationHeaderKey, test.value)
+			actual, ok := getDuration(header, serverDurationHeaderKey)
+			if ok != test.ok || actual != test.expected {
+				t.Errorf("expected %v, %v; actual %v, %v",
+					test.expected, test.ok, actual, ok)
+			}
+		})
+	}
+}
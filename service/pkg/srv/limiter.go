@@ -0,0 +1,142 @@
+package srv
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	"github.com/maxfouquet/isotope/service/pkg/srv/prometheus"
+)
+
+// rejectedReasonQueueFull is the reason recorded for requests rejected because
+// the queue was full.
+const rejectedReasonQueueFull = "queue_full"
+
+// errQueueFull is returned by acquire when the queue is full and overflowing
+// requests are rejected.
+var errQueueFull = errors.New("the request queue is full")
+
+// concurrencyLimiter limits the number of requests served at once to max, or
+// only counts them if max is 0. Requests beyond that wait, first come first
+// served, in a queue of up to queueSize; those which arrive when it is full are
+// rejected unless overflow is svc.OverflowWait. A nil *concurrencyLimiter
+// imposes no limit.
+type concurrencyLimiter struct {
+	// mu guards the limits too, as a reload may change them.
+	mu        sync.Mutex
+	max       int
+	queueSize int
+	overflow  svc.Overflow
+	inFlight  int
+	// queue holds a channel for each waiting request, which is closed when the
+	// request is handed a slot.
+	queue []chan struct{}
+}
+
+// newConcurrencyLimiter returns the limiter described by service. It counts
+// the requests in flight even if service has no limit, so that a limit set by
+// a reload counts the requests already being served.
+func newConcurrencyLimiter(service svc.Service) *concurrencyLimiter {
+	l := &concurrencyLimiter{}
+	l.configureLocked(service)
+	return l
+}
+
+// reload returns the limiter described by service. It is l, if l is not nil,
+// so that the requests in flight and queued keep their places; requests the
+// new limits leave room for are admitted from the queue.
+func (l *concurrencyLimiter) reload(service svc.Service) *concurrencyLimiter {
+	if l == nil {
+		return newConcurrencyLimiter(service)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.configureLocked(service)
+	l.admitLocked()
+	return l
+}
+
+func (l *concurrencyLimiter) configureLocked(service svc.Service) {
+	l.max = service.MaxConcurrency
+	if l.max < 0 {
+		l.max = 0
+	}
+	l.queueSize = service.QueueSize
+	l.overflow = service.Overflow
+}
+
+// acquire takes a slot, waiting in the queue if none is free. It returns
+// errQueueFull if the request is rejected, or ctx's error if ctx is done before
+// a slot is free. Each successful call must be followed by a call to release.
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	if l.hasRoomLocked() && len(l.queue) == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return nil
+	}
+	if l.overflow != svc.OverflowWait && len(l.queue) >= l.queueSize {
+		l.mu.Unlock()
+		return errQueueFull
+	}
+	ready := make(chan struct{})
+	l.queue = append(l.queue, ready)
+	l.mu.Unlock()
+
+	prometheus.RecordRequestQueued()
+	startTime := time.Now()
+	defer func() {
+		prometheus.RecordRequestDequeued(time.Since(startTime))
+	}()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, waiting := range l.queue {
+			if waiting == ready {
+				l.queue = append(l.queue[:i], l.queue[i+1:]...)
+				return ctx.Err()
+			}
+		}
+		// The slot was handed over as ctx was done, so pass it on.
+		l.releaseLocked()
+		return ctx.Err()
+	}
+}
+
+// release frees the slot taken by acquire, handing it to the request which has
+// waited longest, if any.
+func (l *concurrencyLimiter) release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.releaseLocked()
+}
+
+func (l *concurrencyLimiter) releaseLocked() {
+	l.inFlight--
+	l.admitLocked()
+}
+
+// admitLocked hands the free slots to the requests which have waited longest.
+func (l *concurrencyLimiter) admitLocked() {
+	for len(l.queue) > 0 && l.hasRoomLocked() {
+		close(l.queue[0])
+		l.queue = l.queue[1:]
+		l.inFlight++
+	}
+}
+
+func (l *concurrencyLimiter) hasRoomLocked() bool {
+	return l.max == 0 || l.inFlight < l.max
+}
@@ -0,0 +1,244 @@
+package srv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+)
+
+// queuedTimeout is how long a request is given to acquire a slot before it is
+// taken to be queued.
+const queuedTimeout = 20 * time.Millisecond
+
+func limitedService(max, queueSize int, overflow svc.Overflow) svc.Service {
+	return svc.Service{
+		Name:           "a",
+		MaxConcurrency: max,
+		QueueSize:      queueSize,
+		Overflow:       overflow,
+	}
+}
+
+// acquireAsync calls l.acquire in a goroutine, and waits until the request is
+// queued behind queued others.
+func acquireAsync(
+	t *testing.T, ctx context.Context, l *concurrencyLimiter, queued int) <-chan error {
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- l.acquire(ctx)
+	}()
+	for deadline := time.Now().Add(time.Second); ; {
+		l.mu.Lock()
+		n := len(l.queue)
+		l.mu.Unlock()
+		if n > queued {
+			return acquired
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d requests to be queued; actual %d", queued+1, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrencyLimiter_Acquire(t *testing.T) {
+	tests := []struct {
+		name    string
+		service svc.Service
+		// held is the number of requests acquired before the one under test.
+		held int
+		err  error
+	}{
+		{"no limit", limitedService(0, 0, ""), 10, nil},
+		{"a free slot", limitedService(2, 0, ""), 1, nil},
+		{"no free slot", limitedService(2, 1, ""), 2, context.DeadlineExceeded},
+		{"a full queue", limitedService(2, 1, ""), 3, errQueueFull},
+		{
+			"a full queue which rejects",
+			limitedService(2, 1, svc.OverflowReject),
+			3,
+			errQueueFull,
+		},
+		{
+			"a full queue which waits",
+			limitedService(2, 1, svc.OverflowWait),
+			3,
+			context.DeadlineExceeded,
+		},
+		{"no queue", limitedService(1, 0, ""), 1, errQueueFull},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			l := newConcurrencyLimiter(test.service)
+			background, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			for i := 0; i < test.held; i++ {
+				go l.acquire(background)
+			}
+			for deadline := time.Now().Add(time.Second); ; {
+				l.mu.Lock()
+				n := l.inFlight + len(l.queue)
+				l.mu.Unlock()
+				if n == test.held || time.Now().After(deadline) {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			ctx, cancelQueued := context.WithTimeout(
+				context.Background(), queuedTimeout)
+			defer cancelQueued()
+			if err := l.acquire(ctx); err != test.err {
+				t.Errorf("expected %v; actual %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimiter_Release_FIFO(t *testing.T) {
+	t.Parallel()
+
+	l := newConcurrencyLimiter(limitedService(1, 3, ""))
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var waiting []<-chan error
+	for i := 0; i < 3; i++ {
+		waiting = append(waiting, acquireAsync(t, context.Background(), l, i))
+	}
+
+	for i, acquired := range waiting {
+		l.release()
+		select {
+		case err := <-acquired:
+			if err != nil {
+				t.Fatalf("expected request %d to acquire a slot; actual %v", i, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected request %d to be handed the slot", i)
+		}
+		for _, later := range waiting[i+1:] {
+			select {
+			case <-later:
+				t.Fatalf("expected request %d to be handed the slot first", i)
+			default:
+			}
+		}
+	}
+	l.release()
+	if l.inFlight != 0 || len(l.queue) != 0 {
+		t.Errorf("expected no requests; actual %d in flight and %d queued",
+			l.inFlight, len(l.queue))
+	}
+}
+
+func TestConcurrencyLimiter_Acquire_Canceled(t *testing.T) {
+	t.Parallel()
+
+	l := newConcurrencyLimiter(limitedService(1, 2, ""))
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := acquireAsync(t, ctx, l, 0)
+	next := acquireAsync(t, context.Background(), l, 1)
+
+	cancel()
+	if err := <-canceled; err != context.Canceled {
+		t.Errorf("expected %v; actual %v", context.Canceled, err)
+	}
+	l.release()
+	select {
+	case err := <-next:
+		if err != nil {
+			t.Errorf("expected the next request to acquire a slot; actual %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the slot to skip the canceled request")
+	}
+	if l.inFlight != 1 || len(l.queue) != 0 {
+		t.Errorf("expected 1 request in flight; actual %d and %d queued",
+			l.inFlight, len(l.queue))
+	}
+}
+
+func TestConcurrencyLimiter_Reload(t *testing.T) {
+	tests := []struct {
+		name    string
+		service svc.Service
+		// admitted is the number of the 2 queued requests the reload admits.
+		admitted int
+		// inFlight is the number of requests in flight after each of the 2
+		// first is released.
+		inFlight int
+	}{
+		{"a larger limit", limitedService(3, 2, ""), 1, 2},
+		{"no limit", limitedService(0, 0, ""), 2, 2},
+		{"the same limit", limitedService(2, 2, ""), 0, 2},
+		{"a smaller limit", limitedService(1, 2, ""), 0, 1},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			l := newConcurrencyLimiter(limitedService(2, 2, ""))
+			for i := 0; i < 2; i++ {
+				if err := l.acquire(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			waiting := []<-chan error{
+				acquireAsync(t, context.Background(), l, 0),
+				acquireAsync(t, context.Background(), l, 1),
+			}
+
+			if reloaded := l.reload(test.service); reloaded != l {
+				t.Fatal("expected the limiter to be kept")
+			}
+			for i := 0; i < test.admitted; i++ {
+				if err := <-waiting[i]; err != nil {
+					t.Fatal(err)
+				}
+			}
+			l.mu.Lock()
+			queued := len(l.queue)
+			l.mu.Unlock()
+			if queued != 2-test.admitted {
+				t.Errorf("expected %d requests to be admitted; %d are queued",
+					test.admitted, queued)
+			}
+
+			l.release()
+			l.release()
+			for deadline := time.Now().Add(time.Second); ; {
+				l.mu.Lock()
+				inFlight := l.inFlight
+				l.mu.Unlock()
+				if inFlight == test.inFlight {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("expected %d requests in flight; actual %d",
+						test.inFlight, inFlight)
+				}
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimiter_Nil(t *testing.T) {
+	var l *concurrencyLimiter
+	if err := l.acquire(context.Background()); err != nil {
+		t.Errorf("expected no limit; actual %v", err)
+	}
+	l.release()
+}
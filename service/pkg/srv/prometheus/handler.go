@@ -1,77 +1,312 @@
 package prometheus
 
 import (
+	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	prom "github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"istio.io/fortio/log"
 )
 
+// DefaultDurationBuckets are the upper bounds, in seconds, of the buckets of the
+// duration histograms, unless others are given to Handler. They are finest
+// where a hop's latency usually falls, but reach far enough to tell slow
+// downstreams and timeouts apart.
+var DefaultDurationBuckets = []float64{
+	0.001, 0.002, 0.003, 0.004, 0.005, 0.006, 0.007, 0.008, 0.009, 0.01, 0.011,
+	0.012, 0.014, 0.016, 0.018, 0.02, 0.025, 0.03, 0.035, 0.04, 0.045, 0.05,
+	0.06, 0.07, 0.08, 0.09, 0.1, 0.12, 0.14, 0.16, 0.18, 0.2, 0.25, 0.3, 0.35,
+	0.4, 0.45, 0.5, 0.75, 1, 2.5, 5, 10, 30}
+
 var (
-	durationBuckets = []float64{
-		0.007, 0.008, 0.009, 0.01, 0.011, 0.012, 0.014, 0.016, 0.018, 0.02, 0.025,
-		0.03, 0.035, 0.04, 0.045, 0.05, 0.06, 0.07, 0.08, 0.09, 0.1, 0.12, 0.14,
-		0.16, 0.18, 0.2, 0.25, 0.3, 0.35, 0.4, 0.45, 0.5}
+	// overheadBuckets are the upper bounds, in seconds, of the buckets of the
+	// mesh overhead histograms, which are much finer than the durations of
+	// whole requests.
+	overheadBuckets = []float64{
+		0.00005, 0.0001, 0.00025, 0.0005, 0.00075, 0.001, 0.0015, 0.002, 0.003,
+		0.004, 0.005, 0.0075, 0.01, 0.015, 0.02, 0.03, 0.05, 0.075, 0.1, 0.25,
+		0.5, 1}
 	sizeBuckets = []float64{
 		// 1, 10, 100, 1,000, ..., 1,000,000,000
 		1e+00, 1e+01, 1e+02, 1e+03, 1e+04, 1e+05, 1e+06, 1e+07, 1e+08, 1e+09}
 
+	serviceIncomingRequestsTotal         prom.Counter
+	serviceIncomingRequestTransitSeconds prom.Histogram
+	serviceOutgoingRequestsTotal         *prom.CounterVec
+	serviceOutgoingRequestSize           *prom.HistogramVec
+
+	serviceOutgoingRequestDurationSeconds *prom.HistogramVec
+	serviceOutgoingResponsesTotal         *prom.CounterVec
+	serviceOutgoingRequestErrorsTotal     *prom.CounterVec
+
+	serviceOutgoingMeshOverheadSeconds *prom.HistogramVec
+	servicePathMeshOverheadSeconds     *prom.HistogramVec
+
+	serviceRequestDurationSeconds *prom.HistogramVec
+	serviceResponseSize           *prom.HistogramVec
+
+	serviceInFlightRequests      prom.Gauge
+	serviceQueueDepth            prom.Gauge
+	serviceQueueWaitSeconds      prom.Histogram
+	serviceRejectedRequestsTotal *prom.CounterVec
+
+	serviceFaultsInjectedTotal *prom.CounterVec
+	serviceFaultActive         *prom.GaugeVec
+
+	serviceConfigReloadsTotal                      *prom.CounterVec
+	serviceConfigLastReloadSuccessTimestampSeconds prom.Gauge
+)
+
+// variableLabelNames are the names of labels which vary between observations
+// of a metric, including those histograms and summaries add to their series.
+// They may not also be constant labels.
+var variableLabelNames = map[string]bool{
+	"le":                  true,
+	"quantile":            true,
+	"code":                true,
+	"destination_service": true,
+	"source_service":      true,
+	"kind":                true,
+	"path":                true,
+	"result":              true,
+	"fault":               true,
+	"reason":              true,
+}
+
+// invalidLabelNameChars matches the characters which may not be in a
+// Prometheus label name.
+var invalidLabelNameChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// Handler returns an http.Handler which should be attached to a "/metrics"
+// endpoint for Prometheus to ingest. Every metric is labelled with labels, the
+// labels of the service, so that results can be sliced by them, and metrics of
+// outgoing requests are also labelled with serviceName as their
+// "source_service". Duration histograms use durationBuckets, or
+// DefaultDurationBuckets if it is empty. It must be called before any metric
+// is recorded.
+func Handler(
+	serviceName string,
+	labels map[string]string,
+	durationBuckets []float64) http.Handler {
+	if len(durationBuckets) == 0 {
+		durationBuckets = DefaultDurationBuckets
+	}
+	constLabels := constLabelsFrom(labels)
+	outgoingConstLabels := prom.Labels{"source_service": serviceName}
+	for name, value := range constLabels {
+		outgoingConstLabels[name] = value
+	}
+
 	serviceIncomingRequestsTotal = prom.NewCounter(
 		prom.CounterOpts{
-			Name: "service_incoming_requests_total",
-			Help: "Number of requests sent to this service.",
+			Name:        "service_incoming_requests_total",
+			Help:        "Number of requests sent to this service.",
+			ConstLabels: constLabels,
+		})
+
+	serviceIncomingRequestTransitSeconds = prom.NewHistogram(
+		prom.HistogramOpts{
+			Name:        "service_incoming_request_transit_seconds",
+			Help:        "Duration in seconds from a caller sending a request to this service receiving it, by their clocks.",
+			Buckets:     overheadBuckets,
+			ConstLabels: constLabels,
 		})
 
 	serviceOutgoingRequestsTotal = prom.NewCounterVec(
 		prom.CounterOpts{
-			Name: "service_outgoing_requests_total",
-			Help: "Number of requests sent from this service.",
+			Name:        "service_outgoing_requests_total",
+			Help:        "Number of requests sent from this service.",
+			ConstLabels: outgoingConstLabels,
 		}, []string{"destination_service"})
 
 	serviceOutgoingRequestSize = prom.NewHistogramVec(
 		prom.HistogramOpts{
-			Name:    "service_outgoing_request_size",
-			Help:    "Size in bytes of requests sent from this service.",
-			Buckets: sizeBuckets,
+			Name:        "service_outgoing_request_size",
+			Help:        "Size in bytes of requests sent from this service.",
+			Buckets:     sizeBuckets,
+			ConstLabels: outgoingConstLabels,
+		}, []string{"destination_service"})
+
+	serviceOutgoingRequestDurationSeconds = prom.NewHistogramVec(
+		prom.HistogramOpts{
+			Name:        "service_outgoing_request_duration_seconds",
+			Help:        "Duration in seconds from sending a request to reading its whole response.",
+			Buckets:     durationBuckets,
+			ConstLabels: outgoingConstLabels,
 		}, []string{"destination_service"})
 
+	serviceOutgoingResponsesTotal = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name:        "service_outgoing_responses_total",
+			Help:        "Number of responses to requests sent from this service.",
+			ConstLabels: outgoingConstLabels,
+		}, []string{"destination_service", "code"})
+
+	serviceOutgoingRequestErrorsTotal = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name:        "service_outgoing_request_errors_total",
+			Help:        "Number of requests sent from this service which got no response.",
+			ConstLabels: outgoingConstLabels,
+		}, []string{"destination_service", "kind"})
+
 	serviceRequestDurationSeconds = prom.NewHistogramVec(
 		prom.HistogramOpts{
-			Name:    "service_request_duration_seconds",
-			Help:    "Duration in seconds it took to serve requests to this service.",
-			Buckets: durationBuckets,
+			Name:        "service_request_duration_seconds",
+			Help:        "Duration in seconds it took to serve requests to this service.",
+			Buckets:     durationBuckets,
+			ConstLabels: constLabels,
 		}, []string{"code"})
 
 	serviceResponseSize = prom.NewHistogramVec(
 		prom.HistogramOpts{
-			Name:    "service_response_size",
-			Help:    "Size in bytes of responses sent from this service.",
-			Buckets: sizeBuckets,
+			Name:        "service_response_size",
+			Help:        "Size in bytes of responses sent from this service.",
+			Buckets:     sizeBuckets,
+			ConstLabels: constLabels,
 		}, []string{"code"})
-)
 
-// Handler returns an http.Handler which should be attached to a "/metrics"
-// endpoint for Prometheus to ingest.
-func Handler() http.Handler {
+	serviceOutgoingMeshOverheadSeconds = prom.NewHistogramVec(
+		prom.HistogramOpts{
+			Name:        "service_outgoing_mesh_overhead_seconds",
+			Help:        "Duration in seconds the mesh added to requests sent from this service, excluding the time the destination took to respond.",
+			Buckets:     overheadBuckets,
+			ConstLabels: outgoingConstLabels,
+		}, []string{"destination_service"})
+
+	servicePathMeshOverheadSeconds = prom.NewHistogramVec(
+		prom.HistogramOpts{
+			Name:        "service_path_mesh_overhead_seconds",
+			Help:        "Duration in seconds the mesh added to requests sent from this service, including to the calls they caused, by the path of services from the entrypoint.",
+			Buckets:     overheadBuckets,
+			ConstLabels: outgoingConstLabels,
+		}, []string{"path"})
+
+	serviceInFlightRequests = prom.NewGauge(
+		prom.GaugeOpts{
+			Name:        "service_in_flight_requests",
+			Help:        "Number of requests this service is serving, excluding those queued.",
+			ConstLabels: constLabels,
+		})
+
+	serviceQueueDepth = prom.NewGauge(
+		prom.GaugeOpts{
+			Name:        "service_queue_depth",
+			Help:        "Number of requests waiting for this service to serve them.",
+			ConstLabels: constLabels,
+		})
+
+	serviceQueueWaitSeconds = prom.NewHistogram(
+		prom.HistogramOpts{
+			Name:        "service_queue_wait_seconds",
+			Help:        "Duration in seconds requests waited to be served by this service.",
+			Buckets:     durationBuckets,
+			ConstLabels: constLabels,
+		})
+
+	serviceRejectedRequestsTotal = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name:        "service_rejected_requests_total",
+			Help:        "Number of requests this service refused to serve, by why.",
+			ConstLabels: constLabels,
+		}, []string{"reason"})
+
+	serviceFaultsInjectedTotal = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name:        "service_faults_injected_total",
+			Help:        "Number of requests affected by an injected fault.",
+			ConstLabels: constLabels,
+		}, []string{"fault"})
+
+	serviceFaultActive = prom.NewGaugeVec(
+		prom.GaugeOpts{
+			Name:        "service_fault_active",
+			Help:        "Whether a fault of each type is injected (1) or not (0).",
+			ConstLabels: constLabels,
+		}, []string{"fault"})
+
+	serviceConfigReloadsTotal = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name:        "service_config_reloads_total",
+			Help:        "Number of changes to the service graph file, by whether they were applied.",
+			ConstLabels: constLabels,
+		}, []string{"result"})
+
+	serviceConfigLastReloadSuccessTimestampSeconds = prom.NewGauge(
+		prom.GaugeOpts{
+			Name:        "service_config_last_reload_success_timestamp_seconds",
+			Help:        "Unix time at which the service graph was last loaded.",
+			ConstLabels: constLabels,
+		})
+	serviceConfigLastReloadSuccessTimestampSeconds.Set(
+		float64(time.Now().UnixNano()) / 1e9)
+
 	prom.MustRegister(serviceIncomingRequestsTotal)
+	prom.MustRegister(serviceIncomingRequestTransitSeconds)
 
 	prom.MustRegister(serviceOutgoingRequestsTotal)
 	prom.MustRegister(serviceOutgoingRequestSize)
+	prom.MustRegister(serviceOutgoingRequestDurationSeconds)
+	prom.MustRegister(serviceOutgoingResponsesTotal)
+	prom.MustRegister(serviceOutgoingRequestErrorsTotal)
+	prom.MustRegister(serviceOutgoingMeshOverheadSeconds)
+	prom.MustRegister(servicePathMeshOverheadSeconds)
 
 	prom.MustRegister(serviceRequestDurationSeconds)
 	prom.MustRegister(serviceResponseSize)
 
+	prom.MustRegister(serviceInFlightRequests)
+	prom.MustRegister(serviceQueueDepth)
+	prom.MustRegister(serviceQueueWaitSeconds)
+	prom.MustRegister(serviceRejectedRequestsTotal)
+
+	prom.MustRegister(serviceFaultsInjectedTotal)
+	prom.MustRegister(serviceFaultActive)
+
+	prom.MustRegister(serviceConfigReloadsTotal)
+	prom.MustRegister(serviceConfigLastReloadSuccessTimestampSeconds)
+
 	return promhttp.Handler()
 }
 
+// constLabelsFrom converts Kubernetes-style labels into Prometheus labels.
+// Characters which are invalid in label names, such as '.' and '/', are
+// replaced by '_'. Labels which would clash with variable labels are dropped.
+func constLabelsFrom(labels map[string]string) prom.Labels {
+	constLabels := make(prom.Labels, len(labels))
+	for key, value := range labels {
+		name := invalidLabelNameChars.ReplaceAllString(key, "_")
+		if name[0] >= '0' && name[0] <= '9' {
+			name = "_" + name
+		}
+		if variableLabelNames[name] || strings.HasPrefix(name, "__") {
+			log.Warnf(`ignoring label "%s": "%s" is reserved`, key, name)
+			continue
+		}
+		constLabels[name] = value
+	}
+	return constLabels
+}
+
 // RecordRequestReceived increments the Prometheus counter for incoming
 // requests.
 func RecordRequestReceived() {
 	serviceIncomingRequestsTotal.Inc()
 }
 
+// RecordRequestTransit observes the time a request took to reach this service
+// from its caller. Clocks of different hosts are not synchronized exactly, so
+// negative durations are ignored.
+func RecordRequestTransit(duration time.Duration) {
+	if duration >= 0 {
+		serviceIncomingRequestTransitSeconds.Observe(duration.Seconds())
+	}
+}
+
 // RecordRequestSent increments the Prometheus counter for outgoing requests
 // and records an outgoing request size.
 func RecordRequestSent(destinationService string, size uint64) {
@@ -80,6 +315,39 @@ func RecordRequestSent(destinationService string, size uint64) {
 		float64(size))
 }
 
+// RecordResponseReceived observes the duration of a request to
+// destinationService, up to reading the whole response, and counts its HTTP
+// status code.
+func RecordResponseReceived(
+	destinationService string, duration time.Duration, code int) {
+	serviceOutgoingRequestDurationSeconds.WithLabelValues(
+		destinationService).Observe(duration.Seconds())
+	serviceOutgoingResponsesTotal.WithLabelValues(
+		destinationService, strconv.Itoa(code)).Inc()
+}
+
+// RecordRequestFailed counts a request to destinationService which got no
+// response, by the kind of error, such as "timeout".
+func RecordRequestFailed(destinationService string, kind string) {
+	serviceOutgoingRequestErrorsTotal.WithLabelValues(
+		destinationService, kind).Inc()
+}
+
+// RecordMeshOverhead observes the time the mesh added to a request to
+// destinationService: hopOverhead on the hop itself and pathOverhead including
+// the calls it caused, by path, the services from the entrypoint to
+// destinationService.
+func RecordMeshOverhead(
+	destinationService string,
+	path string,
+	hopOverhead time.Duration,
+	pathOverhead time.Duration) {
+	serviceOutgoingMeshOverheadSeconds.WithLabelValues(
+		destinationService).Observe(hopOverhead.Seconds())
+	servicePathMeshOverheadSeconds.WithLabelValues(path).Observe(
+		pathOverhead.Seconds())
+}
+
 // RecordResponseSent observes the time-to-response duration and size for the
 // HTTP status code.
 func RecordResponseSent(duration time.Duration, size uint64, code int) {
@@ -88,3 +356,80 @@ func RecordResponseSent(duration time.Duration, size uint64, code int) {
 		duration.Seconds())
 	serviceResponseSize.WithLabelValues(strCode).Observe(float64(size))
 }
+
+// RecordConfigReload counts a change to the service graph file, and whether it
+// was applied.
+func RecordConfigReload(success bool) {
+	if success {
+		serviceConfigReloadsTotal.WithLabelValues("success").Inc()
+		serviceConfigLastReloadSuccessTimestampSeconds.Set(
+			float64(time.Now().UnixNano()) / 1e9)
+	} else {
+		serviceConfigReloadsTotal.WithLabelValues("failure").Inc()
+	}
+}
+
+// RecordRequestStarted counts a request as in flight until
+// RecordRequestFinished is called.
+func RecordRequestStarted() {
+	serviceInFlightRequests.Inc()
+}
+
+// RecordRequestFinished counts a request as no longer in flight.
+func RecordRequestFinished() {
+	serviceInFlightRequests.Dec()
+}
+
+// RecordRequestQueued counts a request as queued until RecordRequestDequeued
+// is called.
+func RecordRequestQueued() {
+	serviceQueueDepth.Inc()
+}
+
+// RecordRequestDequeued counts a request as no longer queued and observes the
+// time it waited.
+func RecordRequestDequeued(wait time.Duration) {
+	serviceQueueDepth.Dec()
+	serviceQueueWaitSeconds.Observe(wait.Seconds())
+}
+
+// RecordRequestRejected counts a request refused for reason.
+func RecordRequestRejected(reason string) {
+	serviceRejectedRequestsTotal.WithLabelValues(reason).Inc()
+}
+
+// RecordFaultInjected counts a request affected by an injected fault.
+func RecordFaultInjected(faultType string) {
+	serviceFaultsInjectedTotal.WithLabelValues(faultType).Inc()
+}
+
+// SetFaultActive records whether a fault of faultType is injected.
+func SetFaultActive(faultType string, active bool) {
+	value := 0.0
+	if active {
+		value = 1
+	}
+	serviceFaultActive.WithLabelValues(faultType).Set(value)
+}
+
+// ParseBuckets parses comma-separated histogram bucket upper bounds, like
+// "0.005,0.01,0.1,1". The bounds must be positive and increasing.
+func ParseBuckets(s string) ([]float64, error) {
+	fields := strings.Split(s, ",")
+	buckets := make([]float64, 0, len(fields))
+	for _, field := range fields {
+		bucket, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, err
+		}
+		if bucket <= 0 {
+			return nil, fmt.Errorf("bucket %v is not positive", bucket)
+		}
+		if n := len(buckets); n > 0 && bucket <= buckets[n-1] {
+			return nil, fmt.Errorf(
+				"bucket %v does not increase on %v", bucket, buckets[n-1])
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
@@ -0,0 +1,53 @@
+package prometheus
+
+import (
+	"reflect"
+	"testing"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+func TestConstLabelsFrom(t *testing.T) {
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		expected prom.Labels
+	}{
+		{
+			"valid names",
+			map[string]string{"team": "a", "tier_1": "b"},
+			prom.Labels{"team": "a", "tier_1": "b"},
+		},
+		{
+			"invalid characters",
+			map[string]string{"app.kubernetes.io/name": "a", "1st": "b"},
+			prom.Labels{"app_kubernetes_io_name": "a", "_1st": "b"},
+		},
+		{
+			"variable labels",
+			map[string]string{"code": "a", "reason": "b", "team": "c"},
+			prom.Labels{"team": "c"},
+		},
+		{
+			"histogram and summary labels",
+			map[string]string{"le": "a", "quantile": "b", "team": "c"},
+			prom.Labels{"team": "c"},
+		},
+		{
+			"reserved prefix",
+			map[string]string{"__name": "a", "team": "b"},
+			prom.Labels{"team": "b"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			if actual := constLabelsFrom(test.labels); !reflect.DeepEqual(test.expected, actual) {
+				t.Errorf("expected %v; actual %v", test.expected, actual)
+			}
+		})
+	}
+}
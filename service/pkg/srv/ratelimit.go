@@ -0,0 +1,141 @@
+package srv
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
+)
+
+// rejectedReasonRateLimited is the reason recorded for requests rejected by
+// the rate limit.
+const rejectedReasonRateLimited = "rate_limited"
+
+// rateLimiter enforces a svc.RateLimit with a token bucket, shared by every
+// caller or one for each service in the graph. Callers which are not in the
+// graph share one bucket, so that the number of buckets is bounded by the
+// graph rather than by the callers' headers. A nil *rateLimiter imposes no
+// limit.
+type rateLimiter struct {
+	// now returns the current time.
+	now func() time.Time
+
+	// mu guards the limit too, as a reload may change it.
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	perCaller bool
+	// serviceTypes holds the services of the graph, which are the callers
+	// given their own buckets.
+	serviceTypes map[string]svctype.ServiceType
+	buckets      map[string]*tokenBucket
+}
+
+// newRateLimiter returns the limiter described by service, in a graph of the
+// services in serviceTypes, or nil if it has no rate limit.
+func newRateLimiter(
+	service svc.Service,
+	serviceTypes map[string]svctype.ServiceType) *rateLimiter {
+	if service.RateLimit == nil {
+		return nil
+	}
+	l := &rateLimiter{now: time.Now}
+	l.configureLocked(*service.RateLimit, serviceTypes)
+	return l
+}
+
+// reload returns the limiter described by service and serviceTypes. It is l,
+// if both l and service have a rate limit, so that the buckets keep the tokens
+// they hold, up to the new burst. They are emptied only if perCaller changes,
+// and the buckets of callers which left the graph are dropped.
+func (l *rateLimiter) reload(
+	service svc.Service,
+	serviceTypes map[string]svctype.ServiceType) *rateLimiter {
+	if l == nil || service.RateLimit == nil {
+		return newRateLimiter(service, serviceTypes)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.configureLocked(*service.RateLimit, serviceTypes)
+	return l
+}
+
+func (l *rateLimiter) configureLocked(
+	limit svc.RateLimit, serviceTypes map[string]svctype.ServiceType) {
+	burst := float64(limit.Burst)
+	if burst == 0 {
+		burst = math.Max(1, math.Ceil(limit.RequestsPerSecond))
+	}
+	if l.buckets == nil || limit.PerCaller != l.perCaller {
+		l.buckets = map[string]*tokenBucket{}
+	}
+	for caller, bucket := range l.buckets {
+		if _, ok := serviceTypes[caller]; caller != "" && !ok {
+			delete(l.buckets, caller)
+			continue
+		}
+		bucket.tokens = math.Min(burst, bucket.tokens)
+	}
+	l.rate = limit.RequestsPerSecond
+	l.burst = burst
+	l.perCaller = limit.PerCaller
+	l.serviceTypes = serviceTypes
+}
+
+// allow takes a token from the bucket of caller, the name of the calling
+// service. If the bucket is empty, it returns false and how long until it
+// holds a token.
+func (l *rateLimiter) allow(caller string) (ok bool, retryAfter time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.serviceTypes[caller]; !l.perCaller || !ok {
+		caller = ""
+	}
+	now := l.now()
+	bucket, exists := l.buckets[caller]
+	if !exists {
+		bucket = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[caller] = bucket
+	}
+	return bucket.take(now, l.rate, l.burst)
+}
+
+// tokenBucket holds tokens which refill at a steady rate up to a burst.
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take refills b for the time since it was last updated and takes a token if
+// there is one. Otherwise it returns how long until there will be.
+func (b *tokenBucket) take(
+	now time.Time, rate, burst float64) (ok bool, retryAfter time.Duration) {
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// retryAfterSeconds formats d as the value of a Retry-After header, which is
+// a whole number of seconds.
+func retryAfterSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// callerOf returns the name of the service which sent a request with header,
+// or an empty string if it was not sent by a service. The header is set by the
+// caller, so the name may not be of a service in the graph.
+func callerOf(header http.Header) string {
+	path := header.Get(pathHeaderKey)
+	return path[strings.LastIndex(path, pathSeparator)+1:]
+}
@@ -0,0 +1,255 @@
+package srv
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
+)
+
+// fakeClock is a clock which moves only when it is advanced.
+type fakeClock struct {
+	t time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{time.Unix(1500000000, 0)}
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+// testServiceTypes are the services of the graph the rate limiters are in.
+var testServiceTypes = map[string]svctype.ServiceType{
+	"a": svctype.ServiceHTTP,
+	"b": svctype.ServiceHTTP,
+}
+
+func TestTokenBucket_Take(t *testing.T) {
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		// ok and retryAfter are the outcome of taking a token, and remaining
+		// the tokens left.
+		ok         bool
+		retryAfter time.Duration
+		remaining  float64
+	}{
+		{"a full bucket", 3, 0, true, 0, 2},
+		{"an empty bucket", 0, 0, false, 500 * time.Millisecond, 0},
+		{"half a token", 0.5, 0, false, 250 * time.Millisecond, 0.5},
+		{"a refilled token", 0, 500 * time.Millisecond, true, 0, 0},
+		{"a refill beyond the burst", 1, 10 * time.Second, true, 0, 2},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			// The bucket refills at 2 tokens a second, up to 3.
+			clock := newFakeClock()
+			bucket := &tokenBucket{tokens: test.tokens, updated: clock.now()}
+			clock.advance(test.elapsed)
+			ok, retryAfter := bucket.take(clock.now(), 2, 3)
+			if ok != test.ok || retryAfter != test.retryAfter {
+				t.Errorf("expected %v, %v; actual %v, %v",
+					test.ok, test.retryAfter, ok, retryAfter)
+			}
+			if bucket.tokens != test.remaining {
+				t.Errorf("expected %v tokens to remain; actual %v",
+					test.remaining, bucket.tokens)
+			}
+		})
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		d       time.Duration
+		seconds int
+	}{
+		{0, 0},
+		{time.Nanosecond, 1},
+		{250 * time.Millisecond, 1},
+		{time.Second, 1},
+		{time.Second + time.Millisecond, 2},
+		{90 * time.Second, 90},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.d.String(), func(t *testing.T) {
+			t.Parallel()
+
+			if seconds := retryAfterSeconds(test.d); seconds != test.seconds {
+				t.Errorf("expected %d; actual %d", test.seconds, seconds)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_Allow(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit svc.RateLimit
+		// callers are the callers of successive requests, and allowed whether
+		// each is allowed.
+		callers []string
+		allowed []bool
+	}{
+		{
+			"a shared bucket",
+			svc.RateLimit{RequestsPerSecond: 1, Burst: 2},
+			[]string{"a", "b", "a"},
+			[]bool{true, true, false},
+		},
+		{
+			"a bucket per caller",
+			svc.RateLimit{RequestsPerSecond: 1, Burst: 2, PerCaller: true},
+			[]string{"a", "a", "a", "b"},
+			[]bool{true, true, false, true},
+		},
+		{
+			"a shared bucket for callers outside the graph",
+			svc.RateLimit{RequestsPerSecond: 1, Burst: 2, PerCaller: true},
+			[]string{"x", "y", "", "a"},
+			[]bool{true, true, false, true},
+		},
+		{
+			"a burst of the rate rounded up",
+			svc.RateLimit{RequestsPerSecond: 1.5},
+			[]string{"", "", ""},
+			[]bool{true, true, false},
+		},
+		{
+			"a burst of at least 1",
+			svc.RateLimit{RequestsPerSecond: 0.1},
+			[]string{"", ""},
+			[]bool{true, false},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			l := newRateLimiter(svc.Service{RateLimit: &test.limit}, testServiceTypes)
+			clock := newFakeClock()
+			l.now = clock.now
+			for i, caller := range test.callers {
+				ok, retryAfter := l.allow(caller)
+				if ok != test.allowed[i] {
+					t.Errorf("expected request %d from %q to be allowed %v",
+						i, caller, test.allowed[i])
+				}
+				if !ok && retryAfter <= 0 {
+					t.Errorf("expected request %d to be retried later; actual %v",
+						i, retryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiter_Reload(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit *svc.RateLimit
+		// tokens is the number of requests allowed after the reload.
+		tokens int
+	}{
+		{"the same limit", &svc.RateLimit{RequestsPerSecond: 1, Burst: 3}, 1},
+		{"a larger burst", &svc.RateLimit{RequestsPerSecond: 1, Burst: 10}, 1},
+		{"a smaller burst", &svc.RateLimit{RequestsPerSecond: 1, Burst: 0}, 1},
+		{
+			"a bucket per caller",
+			&svc.RateLimit{RequestsPerSecond: 1, Burst: 3, PerCaller: true},
+			3,
+		},
+		{"no limit", nil, -1},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			l := newRateLimiter(
+				svc.Service{RateLimit: &svc.RateLimit{RequestsPerSecond: 1, Burst: 3}},
+				testServiceTypes)
+			clock := newFakeClock()
+			l.now = clock.now
+			l.allow("a")
+			l.allow("a")
+
+			l = l.reload(svc.Service{RateLimit: test.limit}, testServiceTypes)
+			if test.tokens < 0 {
+				if l != nil {
+					t.Errorf("expected no limit; actual %v", l)
+				}
+				return
+			}
+			for i := 0; i < test.tokens; i++ {
+				if ok, _ := l.allow("a"); !ok {
+					t.Fatalf("expected %d requests to be allowed; actual %d",
+						test.tokens, i)
+				}
+			}
+			if ok, _ := l.allow("a"); ok {
+				t.Errorf("expected only %d requests to be allowed", test.tokens)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_Reload_DropsCallers(t *testing.T) {
+	service := svc.Service{
+		RateLimit: &svc.RateLimit{RequestsPerSecond: 1, Burst: 1, PerCaller: true}}
+	l := newRateLimiter(service, testServiceTypes)
+	clock := newFakeClock()
+	l.now = clock.now
+	l.allow("a")
+	l.allow("b")
+
+	l.reload(service, map[string]svctype.ServiceType{"b": svctype.ServiceHTTP})
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("expected the bucket of a caller which left the graph to be dropped")
+	}
+	if ok, _ := l.allow("b"); ok {
+		t.Error("expected the bucket of a caller in the graph to be kept")
+	}
+}
+
+func TestCallerOf(t *testing.T) {
+	tests := []struct {
+		path   string
+		caller string
+	}{
+		{"", ""},
+		{"a", "a"},
+		{"a" + pathSeparator + "b", "b"},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.path, func(t *testing.T) {
+			t.Parallel()
+
+			header := http.Header{}
+			header.Set(pathHeaderKey, test.path)
+			if caller := callerOf(header); caller != test.caller {
+				t.Errorf("expected %q; actual %q", test.caller, caller)
+			}
+		})
+	}
+}
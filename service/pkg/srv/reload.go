@@ -0,0 +1,125 @@
+package srv
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/maxfouquet/isotope/service/pkg/srv/prometheus"
+	"istio.io/fortio/log"
+)
+
+// ReloadingHandler emulates a service using the service graph YAML file at a
+// path, and swaps in a new Handler whenever the file changes. Kubernetes
+// updates a mounted ConfigMap by swapping a symlink, so the file is compared by
+// content rather than by modification time.
+//
+// Each request is served entirely by the Handler current when it arrived, so
+// reloading never interrupts requests in flight.
+type ReloadingHandler struct {
+	path        string
+	serviceName string
+	port        int
+
+	handler atomic.Value // Handler
+
+	// mu serializes reloads, and guards graphYAML and rejectedYAML.
+	mu        sync.Mutex
+	graphYAML []byte
+	// rejectedYAML is the content of the file when it was last rejected, so
+	// that it is not rejected again until it changes. readFailed is true if
+	// the file could not be read when it was last checked.
+	rejectedYAML []byte
+	readFailed   bool
+}
+
+// NewReloadingHandler makes a ReloadingHandler for the service with name
+// serviceName in the service graph represented by the YAML file at path. The
+// other services are called on port.
+func NewReloadingHandler(
+	path string, serviceName string, port int) (*ReloadingHandler, error) {
+	h := &ReloadingHandler{path: path, serviceName: serviceName, port: port}
+	graphYAML, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	handler, err := handlerFromServiceGraphYAMLBytes(
+		graphYAML, serviceName, port, Handler{})
+	if err != nil {
+		return nil, err
+	}
+	h.handler.Store(handler)
+	h.graphYAML = graphYAML
+	return h, nil
+}
+
+// Handler returns the Handler which currently serves requests.
+func (h *ReloadingHandler) Handler() Handler {
+	return h.handler.Load().(Handler)
+}
+
+func (h *ReloadingHandler) ServeHTTP(
+	writer http.ResponseWriter, request *http.Request) {
+	h.Handler().ServeHTTP(writer, request)
+}
+
+// Reload reads the service graph file and, if it has changed, replaces the
+// current Handler. If the new graph is invalid, or no longer contains the
+// service, the current Handler is kept and an error is returned. The error is
+// returned only once for each change: the same rejected content, or a file
+// which still cannot be read, is ignored. changed is true if a new Handler was
+// swapped in.
+func (h *ReloadingHandler) Reload() (changed bool, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	graphYAML, err := ioutil.ReadFile(h.path)
+	if err != nil {
+		if h.readFailed {
+			err = nil
+		}
+		h.readFailed = true
+		return
+	}
+	h.readFailed = false
+	if bytes.Equal(graphYAML, h.graphYAML) ||
+		(h.rejectedYAML != nil && bytes.Equal(graphYAML, h.rejectedYAML)) {
+		return
+	}
+	handler, err := handlerFromServiceGraphYAMLBytes(
+		graphYAML, h.serviceName, h.port, h.Handler())
+	if err != nil {
+		h.rejectedYAML = graphYAML
+		return
+	}
+	h.handler.Store(handler)
+	h.graphYAML = graphYAML
+	h.rejectedYAML = nil
+	changed = true
+	return
+}
+
+// Watch calls Reload every interval until stop is closed, logging and
+// recording the outcome of each reload which finds a change.
+func (h *ReloadingHandler) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			changed, err := h.Reload()
+			if err != nil {
+				log.Errf("keeping the current service graph: %s", err)
+				prometheus.RecordConfigReload(false)
+			} else if changed {
+				log.Infof("reloaded the service graph from %s", h.path)
+				prometheus.RecordConfigReload(true)
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package srv
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// limitsGraph returns a service graph in which service a has the given
+// concurrency and rate limits and latency target.
+func limitsGraph(maxConcurrency int, requestsPerSecond int, latencyTarget string) []byte {
+	return []byte(fmt.Sprintf(`apiVersion: v1alpha1
+kind: MockServiceGraph
+services:
+- name: a
+  maxConcurrency: %d
+  rateLimit:
+    requestsPerSecond: %d
+  loadShedding:
+    latencyTarget: %s
+`, maxConcurrency, requestsPerSecond, latencyTarget))
+}
+
+func TestReloadingHandler_Reload_KeepsLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		graph []byte
+	}{
+		{"unchanged limits", limitsGraph(1, 10, "1s")},
+		{"changed limits", limitsGraph(2, 20, "2s")},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir, err := ioutil.TempDir("", "isotope")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "service-graph.yaml")
+			if err := ioutil.WriteFile(path, limitsGraph(1, 10, "1s"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			h, err := NewReloadingHandler(path, "a", 8080)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := h.Handler()
+			if err := before.limiter.acquire(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			// The graph differs in its script so that it is always reloaded.
+			graph := append(test.graph, "  script:\n  - sleep: 1ms\n"...)
+			if err := ioutil.WriteFile(path, graph, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if changed, err := h.Reload(); !changed || err != nil {
+				t.Fatalf("expected the graph to be reloaded; actual %v, %v", changed, err)
+			}
+
+			after := h.Handler()
+			if after.limiter != before.limiter {
+				t.Errorf("expected the concurrency limiter to be kept")
+			}
+			if after.rateLimiter != before.rateLimiter {
+				t.Errorf("expected the rate limiter to be kept")
+			}
+			if after.shedder != before.shedder {
+				t.Errorf("expected the load shedder to be kept")
+			}
+			if after.limiter.inFlight != 1 {
+				t.Errorf("expected the request in flight to be counted; actual %d",
+					after.limiter.inFlight)
+			}
+			if max := after.Service.MaxConcurrency; after.limiter.max != max {
+				t.Errorf("expected a limit of %d; actual %d", max, after.limiter.max)
+			}
+		})
+	}
+}
+
+func TestReloadingHandler_Reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isotope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "service-graph.yaml")
+	valid := limitsGraph(1, 10, "1s")
+	if err := ioutil.WriteFile(path, valid, 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewReloadingHandler(path, "a", 8080)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withoutService := []byte("apiVersion: v1alpha1\nkind: MockServiceGraph\nservices:\n- name: b\n")
+	steps := []struct {
+		name string
+		// content is written to the file, or the file is removed if it is nil.
+		content []byte
+		changed bool
+		err     bool
+	}{
+		{"unchanged", valid, false, false},
+		{"rejected", withoutService, false, true},
+		{"rejected again", withoutService, false, false},
+		{"removed", nil, false, true},
+		{"still removed", nil, false, false},
+		{"restored while rejected", withoutService, false, false},
+		{"changed", limitsGraph(2, 10, "1s"), true, false},
+		{"rejected after a change", withoutService, false, true},
+	}
+	for _, step := range steps {
+		if step.content == nil {
+			err = os.Remove(path)
+		} else {
+			err = ioutil.WriteFile(path, step.content, 0644)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		changed, err := h.Reload()
+		if changed != step.changed || (err != nil) != step.err {
+			t.Errorf("%s: expected changed %v and error %v; actual %v, %v",
+				step.name, step.changed, step.err, changed, err)
+		}
+	}
+}
@@ -2,27 +2,35 @@ package srv
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/http"
+	"time"
 
-	"github.com/Tahler/isotope/convert/pkg/consts"
-	"github.com/Tahler/isotope/convert/pkg/graph/size"
-	"github.com/Tahler/isotope/convert/pkg/graph/svctype"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/size"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svctype"
+	"github.com/maxfouquet/isotope/service/pkg/srv/tracing"
 	"istio.io/fortio/log"
 )
 
 func sendRequest(
+	ctx context.Context,
 	destName string,
 	destType svctype.ServiceType,
+	port int,
 	size size.ByteSize,
-	requestHeader http.Header) (*http.Response, error) {
-	url := fmt.Sprintf("http://%s:%v", destName, consts.ServicePort)
+	requestHeader http.Header,
+	span *tracing.Span) (*http.Response, error) {
+	url := fmt.Sprintf("http://%s:%v", destName, port)
 	request, err := buildRequest(url, size, requestHeader)
 	if err != nil {
 		return nil, err
 	}
 	log.Debugf("sending request to %s (%s)", destName, url)
-	return http.DefaultClient.Do(request)
+	span.SetAttribute("http.url", url)
+	span.Inject(request.Header)
+	setTime(request.Header, sentAtHeaderKey, time.Now())
+	return http.DefaultClient.Do(request.WithContext(ctx))
 }
 
 func buildRequest(url string, size size.ByteSize, requestHeader http.Header) (
@@ -0,0 +1,126 @@
+package srv
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+)
+
+const (
+	// rejectedReasonLoadShed is the reason recorded for requests shed because
+	// the service is slow.
+	rejectedReasonLoadShed = "load_shed"
+
+	// latencyWindow is the period over which the latency of a service is
+	// averaged to decide whether to shed requests.
+	latencyWindow = time.Second
+)
+
+// loadShedder enforces a svc.LoadShedding. It sheds requests whose priority is
+// below minPriority while the mean time to serve a request over the last
+// complete latencyWindow is above target. A nil *loadShedder sheds nothing.
+type loadShedder struct {
+	// now returns the current time.
+	now func() time.Time
+
+	// mu guards the settings too, as a reload may change them.
+	mu          sync.Mutex
+	target      time.Duration
+	minPriority int
+	// windowStart is the start of the window being measured, in which count
+	// requests took total to serve.
+	windowStart time.Time
+	total       time.Duration
+	count       int
+	// latency is the mean of the last complete window, or 0 if it served no
+	// requests.
+	latency time.Duration
+}
+
+// newLoadShedder returns the shedder described by service, or nil if it sheds
+// no requests.
+func newLoadShedder(service svc.Service) *loadShedder {
+	if service.LoadShedding == nil {
+		return nil
+	}
+	s := &loadShedder{now: time.Now}
+	s.windowStart = s.now()
+	s.configureLocked(*service.LoadShedding)
+	return s
+}
+
+// reload returns the shedder described by service. It is s, if both s and
+// service shed load, so that the latency measured so far still counts.
+func (s *loadShedder) reload(service svc.Service) *loadShedder {
+	if s == nil || service.LoadShedding == nil {
+		return newLoadShedder(service)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configureLocked(*service.LoadShedding)
+	return s
+}
+
+func (s *loadShedder) configureLocked(shedding svc.LoadShedding) {
+	s.target = time.Duration(shedding.LatencyTarget)
+	s.minPriority = shedding.MinPriority
+	if s.minPriority == 0 {
+		s.minPriority = 1
+	}
+}
+
+// shed returns true if a request with header should be rejected.
+func (s *loadShedder) shed(header http.Header) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if priorityOf(header) >= s.minPriority {
+		return false
+	}
+	s.rollLocked(s.now())
+	return s.latency > s.target
+}
+
+// observe records that a request took duration to serve.
+func (s *loadShedder) observe(duration time.Duration) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rollLocked(s.now())
+	s.total += duration
+	s.count++
+}
+
+// rollLocked starts a new window if the current one has ended by now. If the
+// service served no requests in the last window, such as when every request
+// was shed, its latency is 0 so that it starts serving them again.
+func (s *loadShedder) rollLocked(now time.Time) {
+	elapsed := now.Sub(s.windowStart)
+	if elapsed < latencyWindow {
+		return
+	}
+	s.latency = 0
+	if s.count > 0 && elapsed < 2*latencyWindow {
+		s.latency = s.total / time.Duration(s.count)
+	}
+	s.windowStart = now.Add(-(elapsed % latencyWindow))
+	s.total = 0
+	s.count = 0
+}
+
+// priorityOf returns the priority set on a request with header, or 0 if it has
+// none.
+func priorityOf(header http.Header) int {
+	priority, err := strconv.Atoi(header.Get(svc.PriorityHeaderKey))
+	if err != nil {
+		return 0
+	}
+	return priority
+}
@@ -0,0 +1,185 @@
+package srv
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/maxfouquet/isotope/convert/pkg/graph/policy"
+	"github.com/maxfouquet/isotope/convert/pkg/graph/svc"
+)
+
+func sheddingService(target time.Duration, minPriority int) svc.Service {
+	return svc.Service{LoadShedding: &svc.LoadShedding{
+		LatencyTarget: policy.Duration(target),
+		MinPriority:   minPriority,
+	}}
+}
+
+func priorityHeader(priority int) http.Header {
+	header := http.Header{}
+	if priority != 0 {
+		header.Set(svc.PriorityHeaderKey, strconv.Itoa(priority))
+	}
+	return header
+}
+
+func TestLoadShedder_Shed(t *testing.T) {
+	tests := []struct {
+		name        string
+		minPriority int
+		// observed are the durations of the requests served in the first
+		// window, and elapsed the time since it started.
+		observed []time.Duration
+		elapsed  time.Duration
+		priority int
+		shed     bool
+	}{
+		{
+			"a slow window",
+			0,
+			[]time.Duration{150 * time.Millisecond, 250 * time.Millisecond},
+			latencyWindow,
+			0,
+			true,
+		},
+		{
+			"a slow window and a priority",
+			0,
+			[]time.Duration{200 * time.Millisecond},
+			latencyWindow,
+			1,
+			false,
+		},
+		{
+			"a slow window and a priority below the minimum",
+			3,
+			[]time.Duration{200 * time.Millisecond},
+			latencyWindow,
+			2,
+			true,
+		},
+		{
+			"a fast window",
+			0,
+			[]time.Duration{50 * time.Millisecond, 100 * time.Millisecond},
+			latencyWindow,
+			0,
+			false,
+		},
+		{
+			"a slow window which is not over",
+			0,
+			[]time.Duration{200 * time.Millisecond},
+			latencyWindow - time.Millisecond,
+			0,
+			false,
+		},
+		{
+			"a slow window followed by an idle one",
+			0,
+			[]time.Duration{200 * time.Millisecond},
+			2 * latencyWindow,
+			0,
+			false,
+		},
+		{"an idle window", 0, nil, latencyWindow, 0, false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newLoadShedder(sheddingService(100*time.Millisecond, test.minPriority))
+			clock := newFakeClock()
+			s.now = clock.now
+			s.windowStart = clock.now()
+			for _, d := range test.observed {
+				s.observe(d)
+			}
+			clock.advance(test.elapsed)
+			if shed := s.shed(priorityHeader(test.priority)); shed != test.shed {
+				t.Errorf("expected shed %v; actual %v", test.shed, shed)
+			}
+		})
+	}
+}
+
+func TestLoadShedder_Shed_Recovers(t *testing.T) {
+	s := newLoadShedder(sheddingService(100*time.Millisecond, 0))
+	clock := newFakeClock()
+	s.now = clock.now
+	s.windowStart = clock.now()
+
+	s.observe(200 * time.Millisecond)
+	clock.advance(latencyWindow)
+	if !s.shed(http.Header{}) {
+		t.Fatal("expected requests to be shed after a slow window")
+	}
+	// Every request in the window is shed, so none is observed.
+	clock.advance(latencyWindow / 2)
+	s.shed(http.Header{})
+	clock.advance(latencyWindow / 2)
+	if s.shed(http.Header{}) {
+		t.Error("expected requests to be served after a window without any")
+	}
+}
+
+func TestLoadShedder_Reload(t *testing.T) {
+	tests := []struct {
+		name    string
+		service svc.Service
+		shed    bool
+	}{
+		{"the same target", sheddingService(100*time.Millisecond, 0), true},
+		{"a higher target", sheddingService(300*time.Millisecond, 0), false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := newLoadShedder(sheddingService(100*time.Millisecond, 0))
+			clock := newFakeClock()
+			s.now = clock.now
+			s.windowStart = clock.now()
+			s.observe(200 * time.Millisecond)
+
+			if reloaded := s.reload(test.service); reloaded != s {
+				t.Fatal("expected the shedder to be kept")
+			}
+			clock.advance(latencyWindow)
+			if shed := s.shed(http.Header{}); shed != test.shed {
+				t.Errorf("expected shed %v; actual %v", test.shed, shed)
+			}
+		})
+	}
+}
+
+func TestPriorityOf(t *testing.T) {
+	tests := []struct {
+		value    string
+		priority int
+	}{
+		{"", 0},
+		{"2", 2},
+		{"-1", -1},
+		{"high", 0},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.value, func(t *testing.T) {
+			t.Parallel()
+
+			header := http.Header{}
+			header.Set(svc.PriorityHeaderKey, test.value)
+			if priority := priorityOf(header); priority != test.priority {
+				t.Errorf("expected %d; actual %d", test.priority, priority)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exporter sends finished spans of a service to a tracing backend.
+type Exporter interface {
+	Export(serviceName string, spans []*Span) error
+}
+
+// OTLPHTTPExporter sends spans to an OpenTelemetry collector with OTLP/HTTP,
+// encoded as JSON.
+type OTLPHTTPExporter struct {
+	// Endpoint is the base URL of the collector, like "http://localhost:4318".
+	Endpoint string
+	Client   *http.Client
+}
+
+// NewOTLPHTTPExporter returns an OTLPHTTPExporter for the collector at
+// endpoint.
+func NewOTLPHTTPExporter(endpoint string) *OTLPHTTPExporter {
+	return &OTLPHTTPExporter{
+		Endpoint: endpoint,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Export posts spans to the collector's "/v1/traces" endpoint.
+func (e *OTLPHTTPExporter) Export(serviceName string, spans []*Span) error {
+	body, err := json.Marshal(encodeOTLP(serviceName, spans))
+	if err != nil {
+		return err
+	}
+	url := strings.TrimSuffix(e.Endpoint, "/") + "/v1/traces"
+	response, err := e.Client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(response.Body)
+		return OTLPExportError{url, response.StatusCode, string(message)}
+	}
+	return nil
+}
+
+// FileExporter appends spans to a local file, one OTLP JSON document per line,
+// so that traces can be checked without a collector.
+type FileExporter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileExporter returns a FileExporter which appends to the file at path,
+// creating it if needed.
+func NewFileExporter(path string) (*FileExporter, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{file: file}, nil
+}
+
+// Export writes spans as one line of the file.
+func (e *FileExporter) Export(serviceName string, spans []*Span) error {
+	line, err := json.Marshal(encodeOTLP(serviceName, spans))
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.file.Write(append(line, '\n'))
+	return err
+}
+
+// The OTLP JSON encoding of spans. See
+// https://github.com/open-telemetry/opentelemetry-proto.
+type (
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              Kind           `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            *otlpStatus    `json:"status,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// otlpStatusCodeError is the OTLP status code of a failed span.
+const otlpStatusCodeError = 2
+
+// scopeName names the instrumentation which produced the spans.
+const scopeName = "github.com/maxfouquet/isotope/service"
+
+func encodeOTLP(serviceName string, spans []*Span) otlpTraces {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        encodeAttributes(s.Attributes),
+		}
+		if s.ParentSpanID.IsValid() {
+			span.ParentSpanID = s.ParentSpanID.String()
+		}
+		if s.Error != "" {
+			span.Status = &otlpStatus{otlpStatusCodeError, s.Error}
+		}
+		s.mu.Unlock()
+		encoded = append(encoded, span)
+	}
+	return otlpTraces{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: encodeAttributes(
+						map[string]interface{}{"service.name": serviceName}),
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{Scope: otlpScope{Name: scopeName}, Spans: encoded},
+				},
+			},
+		},
+	}
+}
+
+// encodeAttributes encodes attributes as OTLP key-values, sorted by key.
+func encodeAttributes(attributes map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	encoded := make([]otlpKeyValue, 0, len(keys))
+	for _, key := range keys {
+		var value map[string]interface{}
+		switch v := attributes[key].(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{
+				"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		encoded = append(encoded, otlpKeyValue{key, value})
+	}
+	return encoded
+}
+
+// OTLPExportError is returned when a collector rejects spans.
+type OTLPExportError struct {
+	URL        string
+	StatusCode int
+	Message    string
+}
+
+func (e OTLPExportError) Error() string {
+	return fmt.Sprintf(
+		"%s responded with status %d: %s", e.URL, e.StatusCode, e.Message)
+}
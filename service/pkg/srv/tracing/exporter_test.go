@@ -0,0 +1,118 @@
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileExporter_Export(t *testing.T) {
+	dir, err := ioutil.TempDir("", "isotope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spans.jsonl")
+	exporter, err := NewFileExporter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Unix(1500000000, 0)
+	server := &Span{
+		Name:       "serve",
+		Kind:       KindServer,
+		Context:    SpanContext{testTraceID, testParentSpanID, true},
+		Start:      start,
+		End:        start.Add(3 * time.Millisecond),
+		Attributes: map[string]interface{}{},
+	}
+	client := &Span{
+		Name:         "call b",
+		Kind:         KindClient,
+		Context:      SpanContext{testTraceID, testSpanID, true},
+		ParentSpanID: testParentSpanID,
+		Start:        start.Add(time.Millisecond),
+		End:          start.Add(2 * time.Millisecond),
+		Attributes: map[string]interface{}{
+			"peer.service":     "b",
+			"http.status_code": 500,
+			"isotope.size":     int64(1024),
+			"isotope.hedged":   true,
+			"isotope.fraction": 0.5,
+		},
+	}
+	client.SetError(errors.New("service b responded with 500"))
+	for _, spans := range [][]*Span{{server}, {client}} {
+		if err := exporter.Export("a", spans); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a line for each export; actual %q", contents)
+	}
+	var actual interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &actual); err != nil {
+		t.Fatal(err)
+	}
+
+	var expected interface{}
+	err = json.Unmarshal([]byte(`{
+		"resourceSpans": [{
+			"resource": {
+				"attributes": [
+					{"key": "service.name", "value": {"stringValue": "a"}}
+				]
+			},
+			"scopeSpans": [{
+				"scope": {"name": "github.com/maxfouquet/isotope/service"},
+				"spans": [{
+					"traceId": "4bf92f3577b34da6a3ce929d0e0e4736",
+					"spanId": "00f067aa0ba902b7",
+					"parentSpanId": "53995c3f42cd8ad8",
+					"name": "call b",
+					"kind": 3,
+					"startTimeUnixNano": "1500000000001000000",
+					"endTimeUnixNano": "1500000000002000000",
+					"attributes": [
+						{"key": "http.status_code", "value": {"intValue": "500"}},
+						{"key": "isotope.fraction", "value": {"doubleValue": 0.5}},
+						{"key": "isotope.hedged", "value": {"boolValue": true}},
+						{"key": "isotope.size", "value": {"intValue": "1024"}},
+						{"key": "peer.service", "value": {"stringValue": "b"}}
+					],
+					"status": {"code": 2, "message": "service b responded with 500"}
+				}]
+			}]
+		}]
+	}`), &expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v; actual %v", expected, actual)
+	}
+
+	// A root span has no parent, attributes or status.
+	var root otlpTraces
+	if err := json.Unmarshal([]byte(lines[0]), &root); err != nil {
+		t.Fatal(err)
+	}
+	span := root.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if span.ParentSpanID != "" || span.Attributes != nil || span.Status != nil {
+		t.Errorf("expected a root span without attributes or status; actual %+v",
+			span)
+	}
+}
@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx which carries s.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil if there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Middleware returns a handler which records a server span for each request,
+// as a child of the span propagated by the caller, and passes it to next in
+// the request's context. If t is nil, it returns next.
+func Middleware(t *Tracer, next http.Handler) http.Handler {
+	if t == nil {
+		return next
+	}
+	return http.HandlerFunc(func(
+		writer http.ResponseWriter, request *http.Request) {
+		parent, _ := Extract(request.Header)
+		span := t.StartServerSpan(request.Method, parent)
+		span.SetAttribute("http.method", request.Method)
+		span.SetAttribute("http.target", request.URL.RequestURI())
+		defer span.Finish()
+
+		recorder := &statusRecorder{ResponseWriter: writer}
+		next.ServeHTTP(
+			recorder, request.WithContext(
+				ContextWithSpan(request.Context(), span)))
+		if recorder.status != 0 {
+			span.SetAttribute("http.status_code", recorder.status)
+			if recorder.status >= http.StatusInternalServerError {
+				span.SetError(errors.New(
+					"responded with status " + strconv.Itoa(recorder.status)))
+			}
+		}
+	})
+}
+
+// statusRecorder records the status of a response. It can be hijacked if the
+// writer it wraps can, so that faults which drop connections still work.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response cannot be hijacked")
+	}
+	return hijacker.Hijack()
+}
@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Headers which propagate the span context between services. They must be in
+// Train-Case.
+const (
+	// TraceparentHeaderKey is the W3C Trace Context header.
+	TraceparentHeaderKey = "Traceparent"
+	// TracestateHeaderKey is the vendor-specific W3C Trace Context header,
+	// which is forwarded unchanged.
+	TracestateHeaderKey = "Tracestate"
+
+	b3TraceIDHeaderKey      = "X-B3-Traceid"
+	b3SpanIDHeaderKey       = "X-B3-Spanid"
+	b3ParentSpanIDHeaderKey = "X-B3-Parentspanid"
+	b3SampledHeaderKey      = "X-B3-Sampled"
+	b3FlagsHeaderKey        = "X-B3-Flags"
+)
+
+// Extract returns the span context propagated in header by a W3C traceparent
+// or, failing that, B3 headers, and false if there is none.
+func Extract(header http.Header) (SpanContext, bool) {
+	if sc, ok := parseTraceparent(header.Get(TraceparentHeaderKey)); ok {
+		return sc, true
+	}
+	return extractB3(header)
+}
+
+// Inject sets the W3C traceparent and the B3 headers of header to propagate
+// s, replacing those which were forwarded from the incoming request, so that
+// the spans of the mesh's proxies are children of s.
+func (s *Span) Inject(header http.Header) {
+	if s == nil {
+		return
+	}
+	sc := s.Context
+	header.Set(TraceparentHeaderKey, formatTraceparent(sc))
+	header.Set(b3TraceIDHeaderKey, sc.TraceID.String())
+	header.Set(b3SpanIDHeaderKey, sc.SpanID.String())
+	if s.ParentSpanID.IsValid() {
+		header.Set(b3ParentSpanIDHeaderKey, s.ParentSpanID.String())
+	} else {
+		header.Del(b3ParentSpanIDHeaderKey)
+	}
+	header.Del(b3FlagsHeaderKey)
+	if sc.Sampled {
+		header.Set(b3SampledHeaderKey, "1")
+	} else {
+		header.Set(b3SampledHeaderKey, "0")
+	}
+}
+
+// formatTraceparent formats sc as a version 00 traceparent.
+func formatTraceparent(sc SpanContext) string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// parseTraceparent parses a traceparent like
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func parseTraceparent(value string) (sc SpanContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		(parts[0] == "00" && len(parts) != 4) {
+		return
+	}
+	if !decodeHex(sc.TraceID[:], parts[1]) ||
+		!decodeHex(sc.SpanID[:], parts[2]) {
+		return
+	}
+	var flags [1]byte
+	if !decodeHex(flags[:], parts[3]) {
+		return
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+// extractB3 extracts the span context of B3 multi-headers. 64-bit trace IDs
+// are padded to 128 bits. Absent a sampling decision, the trace is sampled.
+func extractB3(header http.Header) (sc SpanContext, ok bool) {
+	traceID := header.Get(b3TraceIDHeaderKey)
+	if len(traceID) == 16 {
+		traceID = strings.Repeat("0", 16) + traceID
+	}
+	if !decodeHex(sc.TraceID[:], traceID) ||
+		!decodeHex(sc.SpanID[:], header.Get(b3SpanIDHeaderKey)) {
+		return
+	}
+	sc.Sampled = header.Get(b3SampledHeaderKey) != "0" ||
+		header.Get(b3FlagsHeaderKey) == "1"
+	return sc, sc.IsValid()
+}
+
+// decodeHex decodes s, which must be the lowercase hex of exactly len(dst)
+// bytes, into dst.
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
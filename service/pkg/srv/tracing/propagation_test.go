@@ -0,0 +1,213 @@
+package tracing
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+var (
+	testTraceID = TraceID{
+		0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6,
+		0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	testSpanID       = SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+	testParentSpanID = SpanID{0x53, 0x99, 0x5c, 0x3f, 0x42, 0xcd, 0x8a, 0xd8}
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		sc     SpanContext
+		ok     bool
+	}{
+		{
+			"sampled traceparent",
+			map[string]string{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			SpanContext{testTraceID, testSpanID, true},
+			true,
+		},
+		{
+			"unsampled traceparent",
+			map[string]string{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			},
+			SpanContext{testTraceID, testSpanID, false},
+			true,
+		},
+		{
+			"traceparent of a later version",
+			map[string]string{
+				"traceparent": "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			},
+			SpanContext{testTraceID, testSpanID, true},
+			true,
+		},
+		{
+			"traceparent of an invalid version",
+			map[string]string{
+				"traceparent": "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			SpanContext{},
+			false,
+		},
+		{
+			"traceparent in uppercase",
+			map[string]string{
+				"traceparent": "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01",
+			},
+			SpanContext{},
+			false,
+		},
+		{
+			"traceparent with a zero trace ID",
+			map[string]string{
+				"traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+			},
+			SpanContext{},
+			false,
+		},
+		{
+			"traceparent before B3",
+			map[string]string{
+				"traceparent":  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+				"x-b3-traceid": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"x-b3-spanid":  "53995c3f42cd8ad8",
+				"x-b3-sampled": "1",
+			},
+			SpanContext{testTraceID, testSpanID, false},
+			true,
+		},
+		{
+			"B3 without a sampling decision",
+			map[string]string{
+				"x-b3-traceid": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"x-b3-spanid":  "00f067aa0ba902b7",
+			},
+			SpanContext{testTraceID, testSpanID, true},
+			true,
+		},
+		{
+			"unsampled B3",
+			map[string]string{
+				"x-b3-traceid": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"x-b3-spanid":  "00f067aa0ba902b7",
+				"x-b3-sampled": "0",
+			},
+			SpanContext{testTraceID, testSpanID, false},
+			true,
+		},
+		{
+			"debug B3",
+			map[string]string{
+				"x-b3-traceid": "4bf92f3577b34da6a3ce929d0e0e4736",
+				"x-b3-spanid":  "00f067aa0ba902b7",
+				"x-b3-sampled": "0",
+				"x-b3-flags":   "1",
+			},
+			SpanContext{testTraceID, testSpanID, true},
+			true,
+		},
+		{
+			"B3 with a 64-bit trace ID",
+			map[string]string{
+				"x-b3-traceid": "a3ce929d0e0e4736",
+				"x-b3-spanid":  "00f067aa0ba902b7",
+			},
+			SpanContext{
+				TraceID{8: 0xa3, 9: 0xce, 10: 0x92, 11: 0x9d, 12: 0x0e, 13: 0x0e,
+					14: 0x47, 15: 0x36},
+				testSpanID,
+				true,
+			},
+			true,
+		},
+		{
+			"B3 without a span ID",
+			map[string]string{"x-b3-traceid": "4bf92f3577b34da6a3ce929d0e0e4736"},
+			SpanContext{},
+			false,
+		},
+		{"no headers", map[string]string{}, SpanContext{}, false},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			header := http.Header{}
+			for key, value := range test.header {
+				header.Set(key, value)
+			}
+			sc, ok := Extract(header)
+			if ok != test.ok {
+				t.Errorf("expected ok %v; actual %v", test.ok, ok)
+			}
+			if ok && sc != test.sc {
+				t.Errorf("expected %v; actual %v", test.sc, sc)
+			}
+		})
+	}
+}
+
+func TestSpan_Inject(t *testing.T) {
+	tests := []struct {
+		name   string
+		span   *Span
+		header http.Header
+	}{
+		{
+			"sampled child",
+			&Span{
+				Context:      SpanContext{testTraceID, testSpanID, true},
+				ParentSpanID: testParentSpanID,
+			},
+			http.Header{
+				"Traceparent":       {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+				"X-B3-Traceid":      {"4bf92f3577b34da6a3ce929d0e0e4736"},
+				"X-B3-Spanid":       {"00f067aa0ba902b7"},
+				"X-B3-Parentspanid": {"53995c3f42cd8ad8"},
+				"X-B3-Sampled":      {"1"},
+			},
+		},
+		{
+			"unsampled root",
+			&Span{Context: SpanContext{testTraceID, testSpanID, false}},
+			http.Header{
+				"Traceparent":  {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+				"X-B3-Traceid": {"4bf92f3577b34da6a3ce929d0e0e4736"},
+				"X-B3-Spanid":  {"00f067aa0ba902b7"},
+				"X-B3-Sampled": {"0"},
+			},
+		},
+		{"nil span", nil, http.Header{}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			// The headers forwarded from the incoming request are replaced.
+			header := http.Header{}
+			if test.span != nil {
+				header.Set("X-B3-Parentspanid", "1111111111111111")
+				header.Set("X-B3-Flags", "1")
+			}
+			test.span.Inject(header)
+			if !reflect.DeepEqual(test.header, header) {
+				t.Errorf("expected %v; actual %v", test.header, header)
+			}
+
+			if test.span != nil {
+				sc, ok := Extract(header)
+				if !ok || sc != test.span.Context {
+					t.Errorf("expected to extract %v; actual %v", test.span.Context, sc)
+				}
+			}
+		})
+	}
+}
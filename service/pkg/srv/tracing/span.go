@@ -0,0 +1,123 @@
+// Package tracing emits OpenTelemetry spans for the requests a mock service
+// serves and the steps of its script. Spans are encoded as OTLP JSON, so they
+// can be sent to any OpenTelemetry collector without depending on its SDK.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid returns false if id is all zeros.
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid returns false if id is all zeros.
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// SpanContext is the part of a span which is propagated to other services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Sampled is true if the spans of the trace are exported.
+	Sampled bool
+}
+
+// IsValid returns true if sc identifies a span.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Kind describes the relationship of a span to the other spans of its trace.
+// Its values are those of OTLP.
+type Kind int
+
+const (
+	// KindInternal is a span of work within the service.
+	KindInternal Kind = 1
+	// KindServer is a span of a request served by the service.
+	KindServer Kind = 2
+	// KindClient is a span of a request sent by the service.
+	KindClient Kind = 3
+)
+
+// Span is an operation within a trace. A nil *Span is a span which is not
+// recorded, so callers need not check whether tracing is enabled.
+type Span struct {
+	tracer *Tracer
+
+	Name         string
+	Kind         Kind
+	Context      SpanContext
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	// Error is the message of the error which failed the span, if any.
+	Error string
+
+	mu sync.Mutex
+}
+
+// StartChild starts a span of kind named name whose parent is s.
+func (s *Span) StartChild(name string, kind Kind) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.start(name, kind, s.Context)
+}
+
+// SetAttribute sets the attribute key of s to value, which should be a string,
+// bool, integer or float64.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attributes[key] = value
+}
+
+// SetError marks s as failed by err.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Error = err.Error()
+}
+
+// Finish ends s and, if its trace is sampled, exports it.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.End = time.Now()
+	s.mu.Unlock()
+	if s.Context.Sampled {
+		s.tracer.export(s)
+	}
+}
+
+func newTraceID() (id TraceID) {
+	rand.Read(id[:])
+	return
+}
+
+func newSpanID() (id SpanID) {
+	rand.Read(id[:])
+	return
+}
@@ -0,0 +1,136 @@
+package tracing
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"istio.io/fortio/log"
+)
+
+const (
+	// maxQueuedSpans is the most spans which wait to be exported. Spans which
+	// finish while the queue is full are dropped rather than delaying requests.
+	maxQueuedSpans = 4096
+	// maxBatchSize is the most spans exported at once.
+	maxBatchSize = 512
+	// exportInterval is how often queued spans are exported.
+	exportInterval = time.Second
+)
+
+// Tracer starts spans for a service and exports them in batches.
+type Tracer struct {
+	serviceName  string
+	exporter     Exporter
+	samplingRate float64
+
+	spans   chan *Span
+	flushes chan chan struct{}
+	dropped sync.Once
+}
+
+// NewTracer returns a Tracer which exports the spans of serviceName with
+// exporter. New traces are sampled with a probability of samplingRate, from 0
+// to 1; traces propagated from callers keep their sampling decision.
+func NewTracer(
+	serviceName string, exporter Exporter, samplingRate float64) *Tracer {
+	t := &Tracer{
+		serviceName:  serviceName,
+		exporter:     exporter,
+		samplingRate: samplingRate,
+		spans:        make(chan *Span, maxQueuedSpans),
+		flushes:      make(chan chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// StartServerSpan starts a span named name for a request served by the
+// service, as a child of the span propagated by the caller, if any. A nil
+// *Tracer starts no span.
+func (t *Tracer) StartServerSpan(name string, parent SpanContext) *Span {
+	if t == nil {
+		return nil
+	}
+	if !parent.IsValid() {
+		parent = SpanContext{
+			TraceID: newTraceID(),
+			Sampled: rand.Float64() < t.samplingRate,
+		}
+	}
+	return t.start(name, KindServer, parent)
+}
+
+func (t *Tracer) start(name string, kind Kind, parent SpanContext) *Span {
+	return &Span{
+		tracer: t,
+		Name:   name,
+		Kind:   kind,
+		Context: SpanContext{
+			TraceID: parent.TraceID,
+			SpanID:  newSpanID(),
+			Sampled: parent.Sampled,
+		},
+		ParentSpanID: parent.SpanID,
+		Start:        time.Now(),
+		Attributes:   map[string]interface{}{},
+	}
+}
+
+// Flush exports every finished span and waits for the export to complete.
+func (t *Tracer) Flush() {
+	if t == nil {
+		return
+	}
+	done := make(chan struct{})
+	t.flushes <- done
+	<-done
+}
+
+func (t *Tracer) export(s *Span) {
+	select {
+	case t.spans <- s:
+	default:
+		t.dropped.Do(func() {
+			log.Warnf("dropping spans: more than %d are waiting to be exported",
+				maxQueuedSpans)
+		})
+	}
+}
+
+// run exports the queued spans every exportInterval, or as soon as a batch is
+// full.
+func (t *Tracer) run() {
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, maxBatchSize)
+	exportBatch := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.Export(t.serviceName, batch); err != nil {
+			log.Errf("exporting %d spans: %s", len(batch), err)
+		}
+		batch = make([]*Span, 0, maxBatchSize)
+	}
+	for {
+		select {
+		case s := <-t.spans:
+			batch = append(batch, s)
+			if len(batch) == maxBatchSize {
+				exportBatch()
+			}
+		case <-ticker.C:
+			exportBatch()
+		case done := <-t.flushes:
+			for n := len(t.spans); n > 0; n-- {
+				batch = append(batch, <-t.spans)
+				if len(batch) == maxBatchSize {
+					exportBatch()
+				}
+			}
+			exportBatch()
+			close(done)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"sync"
+	"testing"
+)
+
+// recordingExporter records the spans exported to it.
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (e *recordingExporter) Export(serviceName string, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func TestTracer_StartServerSpan(t *testing.T) {
+	tests := []struct {
+		name         string
+		samplingRate float64
+		parent       SpanContext
+		sampled      bool
+	}{
+		{"new trace at rate 1", 1, SpanContext{}, true},
+		{"new trace at rate 0", 0, SpanContext{}, false},
+		{
+			"sampled parent at rate 0",
+			0,
+			SpanContext{testTraceID, testSpanID, true},
+			true,
+		},
+		{
+			"unsampled parent at rate 1",
+			1,
+			SpanContext{testTraceID, testSpanID, false},
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			exporter := &recordingExporter{}
+			tracer := NewTracer("a", exporter, test.samplingRate)
+			server := tracer.StartServerSpan("serve", test.parent)
+			client := server.StartChild("call b", KindClient)
+			client.Finish()
+			server.Finish()
+			tracer.Flush()
+
+			for _, span := range []*Span{server, client} {
+				if span.Context.Sampled != test.sampled {
+					t.Errorf("expected %s to be sampled %v", span.Name, test.sampled)
+				}
+				if !span.Context.IsValid() {
+					t.Errorf("expected %s to have a valid context; actual %v",
+						span.Name, span.Context)
+				}
+			}
+			if test.parent.IsValid() {
+				if server.Context.TraceID != test.parent.TraceID ||
+					server.ParentSpanID != test.parent.SpanID {
+					t.Errorf("expected %v to be the parent of %v",
+						test.parent, server.Context)
+				}
+			} else if server.ParentSpanID.IsValid() {
+				t.Errorf("expected a root span; actual parent %s", server.ParentSpanID)
+			}
+			if client.Context.TraceID != server.Context.TraceID ||
+				client.ParentSpanID != server.Context.SpanID {
+				t.Errorf("expected %v to be the parent of %v",
+					server.Context, client.Context)
+			}
+
+			expected := 0
+			if test.sampled {
+				expected = 2
+			}
+			if len(exporter.spans) != expected {
+				t.Errorf("expected %d spans to be exported; actual %d",
+					expected, len(exporter.spans))
+			}
+		})
+	}
+}
+
+func TestTracer_Nil(t *testing.T) {
+	var tracer *Tracer
+	span := tracer.StartServerSpan("serve", SpanContext{})
+	if span != nil {
+		t.Errorf("expected no span; actual %v", span)
+	}
+	span.StartChild("call b", KindClient).Finish()
+	tracer.Flush()
+}